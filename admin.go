@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/notify"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/reconcile"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/source"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/spotifysearch"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	models "github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+	"go.uber.org/zap"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+func runQueue(ctx context.Context, c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		return queueList(ctx, c, args[1:])
+	case "add":
+		return queueAdd(ctx, c, args[1:])
+	case "deactivate":
+		return queueDeactivate(ctx, c, args[1:])
+	}
+	return fmt.Errorf("%w: unknown queue command %q", errUsage, args[0])
+}
+
+// queueList prints the active requests as a table, or every request with -all
+func queueList(ctx context.Context, c *cli, args []string) error {
+	var all, asJSON bool
+	rest, err := flags("queue list", args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&all, "all", false, "include deactivated and completed requests")
+		fs.BoolVar(&asJSON, "json", false, "print one JSON request per line")
+	})
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errUsage
+	}
+	if err := c.connect(ctx); err != nil {
+		return err
+	}
+
+	var requests []models.DownloadQueueRequest
+	if all {
+		records, err := c.db.DumpDownloadRequests(ctx)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			requests = append(requests, r.DownloadQueueRequest)
+		}
+	} else if requests, err = c.db.GetActiveRequests(ctx); err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(c.out)
+		for _, r := range requests {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tTRACKS\tCREATOR\tCREATED\tNAME")
+	for _, r := range requests {
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\t%d\t%s\t%s\n", r.ID, utils.RequestStatus(r), r.FoundTrackCount,
+			r.ExpectedTrackCount, r.CreatorID, time.Unix(r.CreatedAt, 0).UTC().Format(time.DateTime), r.Name)
+	}
+	return w.Flush()
+}
+
+// queueAdd queues a link the way sending it to the bot does, for the user given with -creator
+func queueAdd(ctx context.Context, c *cli, args []string) error {
+	var creator int64
+	rest, err := flags("queue add", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&creator, "creator", 0, "Telegram user ID the request is made for, notified like they sent the link (required)")
+	})
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errUsage
+	}
+	// A request without a creator would belong to nobody and its completion notice would go nowhere
+	if creator == 0 {
+		return fmt.Errorf("%w: -creator is required", errUsage)
+	}
+	link := rest[0]
+	if err := c.connect(ctx); err != nil {
+		return err
+	}
+
+	resolver, err := c.resolvers(ctx).For(link)
+	if err != nil {
+		return fmt.Errorf("failed to queue %s: %w", link, err)
+	}
+	res, err := resolver.Resolve(ctx, link)
+	if err != nil {
+		return fmt.Errorf("failed to resolve link: %w", err)
+	}
+	if res.TracksErr != nil {
+		c.log.Warn("Failed to get tracks, queueing without them", zap.Error(res.TracksErr))
+	}
+
+	sourceName := resolver.Name()
+	if res.Match != nil {
+		sourceName, link = res.Source, res.Link
+		c.log.Info("Link translated", zap.String("source", sourceName), zap.String("link", link))
+	}
+
+	if err := c.db.NewDownloadRequest(ctx, sourceName, link, res.Name, creator, db.Chat{}, res.TrackCount, res.Tracks, nil); err != nil {
+		return fmt.Errorf("failed to add download request: %w", err)
+	}
+	if err := utils.SendDoneWebhook(c.cfg.WebhookURL); err != nil {
+		c.log.Error("Failed to send webhook", zap.Error(err))
+	}
+
+	fmt.Fprintf(c.out, "queued %s (%d tracks)\n", res.Name, res.TrackCount)
+	return nil
+}
+
+func queueDeactivate(ctx context.Context, c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	if err := c.connect(ctx); err != nil {
+		return err
+	}
+
+	for _, id := range args {
+		if err := c.db.DeactivateRequest(ctx, id); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "deactivated %s\n", id)
+	}
+	return nil
+}
+
+// runReconcile runs one reconciliation pass over the active requests, like the watcher does
+// each interval, telling users about progress through the bot unless -notify=false
+func runReconcile(ctx context.Context, c *cli, args []string) error {
+	notifyUsers := true
+	rest, err := flags("reconcile", args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&notifyUsers, "notify", true, "send the progress and completion notifications users opted into")
+	})
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errUsage
+	}
+	if err := c.connect(ctx); err != nil {
+		return err
+	}
+
+	reconciler := reconcile.New(c.db, c.log)
+	if notifyUsers {
+		// Offline skips getMe, sending works all the same
+		bot, err := telebot.NewBot(telebot.Settings{Token: c.cfg.BotToken, Offline: true})
+		if err != nil {
+			return fmt.Errorf("failed to create bot: %w", err)
+		}
+		catalog, err := c.cfg.Catalog()
+		if err != nil {
+			return fmt.Errorf("failed to load messages: %w", err)
+		}
+		reconciler.Observe(notify.New(c.db, bot, c.log, catalog))
+	}
+
+	if err := reconciler.RefreshMatchKeys(ctx); err != nil {
+		return err
+	}
+	requests, err := c.db.GetActiveRequests(ctx)
+	if err != nil {
+		return err
+	}
+	requests, err = reconciler.Run(ctx, requests)
+	if err != nil {
+		return err
+	}
+
+	completed := 0
+	for _, r := range requests {
+		if !r.Active {
+			completed++
+		}
+	}
+	fmt.Fprintf(c.out, "reconciled %d active requests, %d completed\n", len(requests), completed)
+	return nil
+}
+
+// runStats prints what GET /stats returns
+func runStats(ctx context.Context, c *cli, args []string) error {
+	var since, interval string
+	rest, err := flags("stats", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&since, "since", "", "window such as 7d, 4w or 2024-01-01, all time when empty")
+		fs.StringVar(&interval, "interval", db.IntervalDay, "time series bucket, day or week")
+	})
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 || (interval != db.IntervalDay && interval != db.IntervalWeek) {
+		return errUsage
+	}
+
+	opts := db.StatsOptions{Interval: interval}
+	if since != "" {
+		if opts.Since, err = utils.ParseSince(since, time.Now()); err != nil {
+			return fmt.Errorf("%w: %w", errUsage, err)
+		}
+	}
+	if err := c.connect(ctx); err != nil {
+		return err
+	}
+
+	stats, err := c.db.GetDetailedStats(ctx, opts)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(stats)
+}
+
+// resolvers are built on first use, only queue add talks to Spotify
+func (c *cli) resolvers(ctx context.Context) source.Resolvers {
+	if c.sources == nil {
+		c.sources = sources(c.cfg,
+			spotify.NewSpotifyService(ctx, c.cfg.SpotifyClientID, c.cfg.SpotifyClientSecret, c.log),
+			spotifysearch.New(ctx, c.cfg.SpotifyClientID, c.cfg.SpotifyClientSecret))
+	}
+	return c.sources
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/backup"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"go.uber.org/zap"
+)
+
+// backupFlags are the flags of export and import, without -file the backup is written to
+// stdout or read from stdin
+func backupFlags(name string, args []string) (format, file, collection string, err error) {
+	rest, err := flags(name, args, func(fs *flag.FlagSet) {
+		fs.StringVar(&format, "format", backup.JSONL, "backup format, jsonl or csv")
+		fs.StringVar(&file, "file", "", "backup file, stdout or stdin when empty")
+	})
+	if err != nil {
+		return "", "", "", err
+	}
+	if len(rest) != 1 {
+		return "", "", "", errUsage
+	}
+	return format, file, rest[0], nil
+}
+
+// runExport writes the backup to a temporary file next to -file and renames it into place, so
+// a failed export never replaces an earlier backup
+func runExport(ctx context.Context, c *cli, args []string) error {
+	format, file, collection, err := backupFlags("export", args)
+	if err != nil {
+		return err
+	}
+	if err := backup.Check(collection, format); err != nil {
+		return err
+	}
+	if err := c.connect(ctx); err != nil {
+		return err
+	}
+
+	if file == "" {
+		n, err := backup.Export(ctx, c.db, c.out, collection, format)
+		if err != nil {
+			return err
+		}
+		c.log.Info("Exported backup", zap.String("collection", collection), zap.Int("records", n))
+		return nil
+	}
+
+	// CreateTemp makes the file private, which suits a backup of users' requests
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".backup-*")
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := backup.Export(ctx, c.db, tmp, collection, format)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("failed to save backup: %w", err)
+	}
+
+	c.log.Info("Exported backup", zap.String("collection", collection), zap.Int("records", n))
+	return nil
+}
+
+func runImport(ctx context.Context, c *cli, args []string) error {
+	format, file, collection, err := backupFlags("import", args)
+	if err != nil {
+		return err
+	}
+	if err := backup.Check(collection, format); err != nil {
+		return err
+	}
+	if err := c.connect(ctx); err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	n, err := backup.Import(ctx, c.db, in, collection, format)
+	if err != nil {
+		return err
+	}
+
+	c.log.Info("Imported backup", zap.String("collection", collection), zap.Int("records", n))
+	return nil
+}
+
+// maxImportBytes caps the body of POST /api/v1/import, which is read into memory
+const maxImportBytes = 64 << 20
+
+// requireToken serves next only to requests bearing token, and to none when token is empty
+func requireToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.Error(w, "Backups over HTTP are disabled, set IMPORT_TOKEN to enable them", http.StatusForbidden)
+			return
+		}
+		got, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !bearer || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// exportHandler serves GET /api/v1/export
+func exportHandler(database db.Database, log *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collection, format := backupParams(r)
+		w.Header().Set("Content-Type", backup.ContentType(format))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": collection + "." + format}))
+		if _, err := backup.Export(r.Context(), database, w, collection, format); err != nil {
+			if errors.Is(err, backup.ErrUnsupported) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Error("Failed to export backup", zap.Error(err), zap.String("collection", collection))
+			http.Error(w, "Failed to export backup", http.StatusInternalServerError)
+		}
+	}
+}
+
+// importHandler serves POST /api/v1/import
+func importHandler(database db.Database, log *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collection, format := backupParams(r)
+		n, err := backup.Import(r.Context(), database, http.MaxBytesReader(w, r.Body, maxImportBytes), collection, format)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Backup too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if errors.Is(err, backup.ErrUnsupported) || errors.Is(err, backup.ErrInvalid) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Error("Failed to import backup", zap.Error(err), zap.String("collection", collection))
+			http.Error(w, "Failed to import backup", http.StatusInternalServerError)
+			return
+		}
+
+		log.Info("Imported backup", zap.String("collection", collection), zap.Int("records", n))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Imported int `json:"imported"`
+		}{n})
+	}
+}
+
+// backupParams reads ?collection= and ?format= of the backup endpoints, the format defaults to JSON Lines
+func backupParams(r *http.Request) (string, string) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = backup.JSONL
+	}
+	return r.URL.Query().Get("collection"), format
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/source"
+	models "github.com/supperdoggy/spot-models"
+	"go.uber.org/zap"
+)
+
+func TestBackupEndpoints(t *testing.T) {
+	const path = "/api/v1/export?collection=download-queue-requests"
+
+	tests := []struct {
+		name    string
+		token   string
+		method  string
+		auth    string
+		body    string
+		status  int
+		content string
+	}{
+		{name: "export without a configured token", method: http.MethodGet, auth: "Bearer secret", status: http.StatusForbidden},
+		{name: "export without a token", token: "secret", method: http.MethodGet, status: http.StatusUnauthorized},
+		{name: "export with a wrong token", token: "secret", method: http.MethodGet, auth: "Bearer wrong", status: http.StatusUnauthorized},
+		{
+			name: "export", token: "secret", method: http.MethodGet, auth: "Bearer secret",
+			status: http.StatusOK, content: `"creator_id":42`,
+		},
+		{name: "import without a token", token: "secret", method: http.MethodPost, body: "{}", status: http.StatusUnauthorized},
+		{
+			name: "import", token: "secret", method: http.MethodPost, auth: "Bearer secret",
+			body: `{"id":"b","spotify_url":"` + albumURL + `"}`, status: http.StatusOK, content: `"imported":1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := db.NewMemoryDatabase()
+			err := mem.RestoreDownloadRequests(context.Background(), []db.DownloadRequestRecord{{
+				DownloadQueueRequest: models.DownloadQueueRequest{ID: "a", SpotifyURL: albumURL, CreatorID: 42},
+				Source:               source.Spotify,
+			}})
+			if err != nil {
+				t.Fatalf("RestoreDownloadRequests() unexpected error: %v", err)
+			}
+
+			handler := exportHandler(mem, zap.NewNop())
+			if tt.method == http.MethodPost {
+				handler = importHandler(mem, zap.NewNop())
+			}
+			req := httptest.NewRequest(tt.method, path, strings.NewReader(tt.body))
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			requireToken(tt.token, handler)(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.content) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body, tt.content)
+			}
+			if tt.status != http.StatusOK && strings.Contains(rec.Body.String(), "creator_id") {
+				t.Errorf("body = %q leaks the backup", rec.Body)
+			}
+		})
+	}
+}
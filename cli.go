@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/config"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/source"
+	"go.uber.org/zap"
+)
+
+// command is an admin subcommand, run as "album-queue <name> [args]"
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, c *cli, args []string) error
+}
+
+var commands = []command{
+	{name: "serve", summary: "run the bot, the default without a command"},
+	{name: "queue", args: "list|add|deactivate ...", summary: "list, add or deactivate download requests", run: runQueue},
+	{name: "reconcile", args: "[-notify=false]", summary: "check every active request against the library once", run: runReconcile},
+	{name: "stats", args: "[-since 30d] [-interval day|week]", summary: "print queue and library statistics as JSON", run: runStats},
+	{name: "migrate", summary: "apply pending database migrations", run: runMigrate},
+	{name: "export", args: "[-format jsonl|csv] [-file path] <collection>", summary: "back up a request collection", run: runExport},
+	{name: "import", args: "[-format jsonl|csv] [-file path] <collection>", summary: "restore a request collection", run: runImport},
+}
+
+var (
+	// errUsage makes run print the command's usage, for arguments it can't make sense of
+	errUsage = errors.New("invalid arguments")
+	// errFlags is a flag error the flag package has already printed with the flags
+	errFlags = errors.New("invalid flags")
+)
+
+// cli is what the admin commands share. Everything but log is set up by connect, so
+// commands can check their arguments before touching the config or database.
+type cli struct {
+	log *zap.Logger
+	out io.Writer
+
+	cfg *config.Config
+	db  db.Database
+	// sources resolve links for queue add, see resolvers
+	sources source.Resolvers
+}
+
+// run dispatches args to a command and returns the exit code
+func run(args []string) int {
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	switch name {
+	case "serve":
+		serve()
+		return 0
+	case "help", "-h", "-help", "--help":
+		usage(os.Stdout)
+		return 0
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage(os.Stderr)
+		return 2
+	}
+
+	// Logs go to stderr, stdout is the command's output
+	log, err := zap.NewProduction()
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = log.Sync() }()
+
+	ctx := context.Background()
+	c := &cli{log: log, out: os.Stdout}
+	defer c.close(ctx)
+
+	err = cmd.run(ctx, c, args)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errFlags):
+		return 2
+	case errors.Is(err, errUsage):
+		fmt.Fprintf(os.Stderr, "%v\nusage: album-queue %s %s\n", err, cmd.name, cmd.args)
+		return 2
+	case err != nil:
+		log.Error("Command failed", zap.String("command", name), zap.Error(err))
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: album-queue [command]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+// flags parses the flags of a command and returns its remaining arguments
+func flags(name string, args []string, define func(fs *flag.FlagSet)) ([]string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	define(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, errFlags
+	}
+	return fs.Args(), nil
+}
+
+// connect loads the config and opens the database, which applies pending migrations.
+// A database set beforehand, as tests do, is kept.
+func (c *cli) connect(ctx context.Context) error {
+	if c.db != nil {
+		return nil
+	}
+
+	cfg, err := config.NewConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	database, err := db.Open(ctx, c.log, cfg.DatabaseURL, cfg.DatabaseName)
+	if err != nil {
+		return fmt.Errorf("failed to create database connection: %w", err)
+	}
+
+	c.cfg, c.db = cfg, database
+	return nil
+}
+
+func (c *cli) close(ctx context.Context) {
+	if c.db == nil {
+		return
+	}
+	if err := c.db.Close(ctx); err != nil {
+		c.log.Error("Failed to close database", zap.Error(err))
+	}
+}
+
+func runMigrate(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	if err := c.connect(ctx); err != nil {
+		return err
+	}
+
+	c.log.Info("Database migrations applied")
+	return nil
+}
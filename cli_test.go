@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/backup"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/config"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/source"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/spotifytest"
+	models "github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+	"go.uber.org/zap"
+)
+
+const albumURL = "https://open.spotify.com/album/ok-computer"
+
+var okComputer = []spotify.TrackMetadata{
+	{Artist: "Radiohead", Title: "Airbag"},
+	{Artist: "Radiohead", Title: "Paranoid Android"},
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		// output must appear in what the command prints, missing must not
+		output  string
+		missing string
+		err     error
+		// errText must appear in the error when err is nil
+		errText     string
+		wantWebhook bool
+		check       func(t *testing.T, mem *db.MemoryDatabase)
+	}{
+		{
+			name:    "queue list shows active requests",
+			args:    []string{"queue", "list"},
+			output:  "active  active  0/2     0        1970-01-01 00:01:40  OK Computer\n",
+			missing: "Kid A",
+		},
+		{
+			name:   "queue list json",
+			args:   []string{"queue", "list", "-json"},
+			output: `"name":"OK Computer"`,
+		},
+		{
+			name:   "queue list all includes deactivated requests",
+			args:   []string{"queue", "list", "-all"},
+			output: "deactivated",
+		},
+		{
+			name: "queue list rejects arguments",
+			args: []string{"queue", "list", "extra"},
+			err:  errUsage,
+		},
+		{
+			name:        "queue add resolves and queues the link",
+			args:        []string{"queue", "add", "-creator", "42", albumURL},
+			output:      "queued OK Computer (2 tracks)",
+			wantWebhook: true,
+			check: func(t *testing.T, mem *db.MemoryDatabase) {
+				requests, _ := mem.GetUserRequests(context.Background(), 42)
+				if len(requests) != 1 || requests[0].SpotifyURL != albumURL || len(requests[0].TrackMetadata) != 2 ||
+					mem.Source(requests[0].ID) != source.Spotify {
+					t.Errorf("stored requests = %+v", requests)
+				}
+			},
+		},
+		{
+			name:    "queue add rejects unsupported link",
+			args:    []string{"queue", "add", "-creator", "42", "https://example.com/album/1"},
+			errText: "unsupported",
+		},
+		{
+			name: "queue add requires a creator",
+			args: []string{"queue", "add", albumURL},
+			err:  errUsage,
+		},
+		{
+			name: "queue add requires a link",
+			args: []string{"queue", "add"},
+			err:  errUsage,
+		},
+		{
+			name:   "queue deactivate",
+			args:   []string{"queue", "deactivate", "active"},
+			output: "deactivated active",
+			check: func(t *testing.T, mem *db.MemoryDatabase) {
+				if active, _ := mem.GetActiveRequests(context.Background()); len(active) != 0 {
+					t.Errorf("active requests = %+v", active)
+				}
+			},
+		},
+		{
+			name:    "queue deactivate unknown request",
+			args:    []string{"queue", "deactivate", "missing"},
+			errText: "not found",
+		},
+		{
+			name: "queue needs a subcommand",
+			args: []string{"queue", "purge"},
+			err:  errUsage,
+		},
+		{
+			name:   "reconcile completes downloaded requests",
+			args:   []string{"reconcile", "-notify=false"},
+			output: "reconciled 1 active requests, 1 completed",
+			check: func(t *testing.T, mem *db.MemoryDatabase) {
+				request, _ := mem.GetDownloadRequest(context.Background(), "active")
+				if request.Active || request.FoundTrackCount != 2 {
+					t.Errorf("request after reconcile = %+v", request)
+				}
+			},
+		},
+		{
+			name:   "stats prints detailed stats",
+			args:   []string{"stats", "-since", "2000-01-01", "-interval", "week"},
+			output: `"total_download_requests": 2`,
+		},
+		{
+			name: "stats rejects unknown interval",
+			args: []string{"stats", "-interval", "month"},
+			err:  errUsage,
+		},
+		{
+			name: "stats rejects malformed window",
+			args: []string{"stats", "-since", "lately"},
+			err:  errUsage,
+		},
+		{
+			name:   "export",
+			args:   []string{"export", "-format", "csv", "download-queue-requests"},
+			output: "active,spotify,https://open.spotify.com/album/ok-computer,OK Computer,true",
+		},
+		{
+			name:    "export unknown collection",
+			args:    []string{"export", "music-files"},
+			errText: "unsupported",
+		},
+		{
+			name:    "import unknown format",
+			args:    []string{"import", "-format", "xml", "download-queue-requests"},
+			errText: "unsupported",
+		},
+		{
+			name: "unknown flag",
+			args: []string{"export", "-gzip", "download-queue-requests"},
+			err:  errFlags,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mem := db.NewMemoryDatabase()
+			mem.AddMusicFiles(
+				models.MusicFile{Artist: "Radiohead", Title: "Airbag"},
+				models.MusicFile{Artist: "Radiohead", Title: "Paranoid Android"},
+			)
+			err := mem.RestoreDownloadRequests(ctx, []db.DownloadRequestRecord{
+				{
+					DownloadQueueRequest: models.DownloadQueueRequest{
+						ID: "active", SpotifyURL: albumURL, Name: "OK Computer", Active: true, CreatedAt: 100,
+						ExpectedTrackCount: 2, TrackMetadata: okComputer,
+					},
+					Source: source.Spotify,
+				},
+				{
+					DownloadQueueRequest: models.DownloadQueueRequest{ID: "old", SpotifyURL: albumURL, Name: "Kid A", CreatedAt: 50},
+					Source:               source.Spotify,
+				},
+			})
+			if err != nil {
+				t.Fatalf("RestoreDownloadRequests() unexpected error: %v", err)
+			}
+
+			var webhooks atomic.Int32
+			webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				webhooks.Add(1)
+			}))
+			defer webhook.Close()
+
+			var out bytes.Buffer
+			c := &cli{
+				log:     zap.NewNop(),
+				out:     &out,
+				cfg:     &config.Config{WebhookURL: webhook.URL},
+				db:      mem,
+				sources: source.Resolvers{source.NewSpotify(spotifytest.NewFake().AddObject(albumURL, "OK Computer", okComputer...))},
+			}
+
+			var cmd *command
+			for i := range commands {
+				if commands[i].name == tt.args[0] {
+					cmd = &commands[i]
+				}
+			}
+			err = cmd.run(ctx, c, tt.args[1:])
+
+			switch {
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("run() error = %v, want %v", err, tt.err)
+				}
+			case tt.errText != "":
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("run() error = %v, want %q", err, tt.errText)
+				}
+			case err != nil:
+				t.Fatalf("run() unexpected error: %v", err)
+			}
+
+			if !strings.Contains(out.String(), tt.output) {
+				t.Errorf("output %q does not contain %q", out.String(), tt.output)
+			}
+			if tt.missing != "" && strings.Contains(out.String(), tt.missing) {
+				t.Errorf("output %q contains %q", out.String(), tt.missing)
+			}
+			if got := webhooks.Load() > 0; got != tt.wantWebhook {
+				t.Errorf("webhook called = %v, want %v", got, tt.wantWebhook)
+			}
+			if tt.check != nil {
+				tt.check(t, mem)
+			}
+		})
+	}
+}
+
+func TestExport_File(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		want       string
+		wantErr    bool
+	}{
+		{name: "replaces the earlier backup", collection: "download-queue-requests", want: `"name":"OK Computer"`},
+		{name: "keeps the earlier backup on error", collection: "music-files", want: "earlier backup", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mem := db.NewMemoryDatabase()
+			err := mem.RestoreDownloadRequests(ctx, []db.DownloadRequestRecord{{
+				DownloadQueueRequest: models.DownloadQueueRequest{ID: "active", SpotifyURL: albumURL, Name: "OK Computer", Active: true},
+				Source:               source.Spotify,
+			}})
+			if err != nil {
+				t.Fatalf("RestoreDownloadRequests() unexpected error: %v", err)
+			}
+
+			dir := t.TempDir()
+			file := filepath.Join(dir, "queue.jsonl")
+			if err := os.WriteFile(file, []byte("earlier backup"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			c := &cli{log: zap.NewNop(), out: io.Discard, cfg: &config.Config{}, db: mem}
+			err = runExport(ctx, c, []string{"-file", file, tt.collection})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runExport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), tt.want) {
+				t.Errorf("backup = %q, want it to contain %q", data, tt.want)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("dir has %d files, want only the backup", len(entries))
+			}
+		})
+	}
+}
+
+func TestBackup_ValidatesBeforeConnecting(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(context.Context, *cli, []string) error
+		args []string
+	}{
+		{name: "export", run: runExport, args: []string{"music-files"}},
+		{name: "import", run: runImport, args: []string{"-format", "xml", "download-queue-requests"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Without a database connecting would fail on the missing config instead
+			c := &cli{log: zap.NewNop(), out: io.Discard}
+			err := tt.run(context.Background(), c, tt.args)
+			if !errors.Is(err, backup.ErrUnsupported) {
+				t.Errorf("run() error = %v, want %v", err, backup.ErrUnsupported)
+			}
+			if c.db != nil {
+				t.Error("run() connected to the database")
+			}
+		})
+	}
+}
@@ -3,21 +3,39 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"mime"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/config"
 	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
 	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/handler"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/health"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/metrics"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/notify"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/playlist"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/reconcile"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/source"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/spotifysearch"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/telegram"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	models "github.com/supperdoggy/spot-models"
 	"github.com/supperdoggy/spot-models/spotify"
 	"go.uber.org/zap"
 	"gopkg.in/tucnak/telebot.v2"
 )
 
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// serve runs the bot, its HTTP server and the background reconciliation until SIGINT or SIGTERM
+func serve() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -32,24 +50,44 @@ func main() {
 		log.Fatal("Failed to load config", zap.Error(err))
 	}
 
-	log.Info("Loaded config")
+	log.Info("Loaded config", zap.Any("config", cfg.Redacted()))
+
+	var (
+		poller        telebot.Poller = &telebot.LongPoller{Timeout: 10 * time.Second}
+		webhookPoller *telegram.WebhookPoller
+	)
+	if cfg.TelegramMode == config.TelegramModeWebhook {
+		webhookPoller = telegram.NewWebhookPoller(log, cfg.TelegramWebhookURL, cfg.TelegramWebhookSecret,
+			cfg.TelegramWebhookCert, cfg.TelegramWebhookMaxConnections)
+		poller = webhookPoller
+	}
 
 	bot, err := telebot.NewBot(telebot.Settings{
 		Token:  cfg.BotToken,
-		Poller: &telebot.LongPoller{Timeout: 10 * time.Second},
+		Poller: poller,
 	})
 	if err != nil {
 		log.Fatal("Failed to create bot", zap.Error(err))
 	}
 
-	database, err := db.NewDatabase(ctx, log, cfg.DatabaseURL, cfg.DatabaseName)
+	if webhookPoller == nil {
+		// A webhook left over from webhook mode would make getUpdates fail
+		if err := bot.RemoveWebhook(); err != nil {
+			log.Error("Failed to remove telegram webhook", zap.Error(err))
+		}
+	}
+	log.Info("Telegram updates configured", zap.String("mode", cfg.TelegramMode))
+
+	storage, err := db.Open(ctx, log, cfg.DatabaseURL, cfg.DatabaseName)
 	if err != nil {
 		log.Fatal("Failed to create database connection", zap.Error(err))
 	}
+	database := metrics.InstrumentDatabase(storage)
 
 	log.Info("Database connection established")
 
-	spotifyService := spotify.NewSpotifyService(ctx, cfg.SpotifyClientID, cfg.SpotifyClientSecret, log)
+	spotifyService := metrics.InstrumentSpotify(spotify.NewSpotifyService(ctx, cfg.SpotifyClientID, cfg.SpotifyClientSecret, log))
+	spotifySearch := metrics.InstrumentSpotifySearch(spotifysearch.New(ctx, cfg.SpotifyClientID, cfg.SpotifyClientSecret))
 	log.Info("Spotify service initialized")
 
 	// Health check server with graceful shutdown
@@ -58,12 +96,31 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("OK"))
 	})
-	http.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("Ready"))
-	})
+
+	// Readiness probes are cached so frequent polling doesn't hit every dependency
+	readiness := health.NewChecker(10*time.Second, 5*time.Second)
+	readiness.Register("mongo", database.Ping)
+	readiness.Register("spotify", health.SpotifyTokenProbe(cfg.SpotifyClientID, cfg.SpotifyClientSecret))
+	readiness.Register("telegram", health.TelegramProbe(bot))
+	readiness.Register("webhook", health.ReachabilityProbe(cfg.WebhookURL))
+	http.Handle("/ready", readiness.Handler())
+
 	http.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
-		stats, err := database.GetStats(r.Context())
+		opts := db.StatsOptions{Interval: r.URL.Query().Get("interval")}
+		if window := r.URL.Query().Get("since"); window != "" {
+			since, err := utils.ParseSince(window, time.Now())
+			if err != nil {
+				http.Error(w, "Invalid since window", http.StatusBadRequest)
+				return
+			}
+			opts.Since = since
+		}
+		if opts.Interval != "" && opts.Interval != db.IntervalDay && opts.Interval != db.IntervalWeek {
+			http.Error(w, "Invalid interval", http.StatusBadRequest)
+			return
+		}
+
+		stats, err := database.GetDetailedStats(r.Context(), opts)
 		if err != nil {
 			log.Error("Failed to get stats", zap.Error(err))
 			http.Error(w, "Failed to get stats", http.StatusInternalServerError)
@@ -73,6 +130,68 @@ func main() {
 		_ = json.NewEncoder(w).Encode(stats)
 	})
 
+	if err := metrics.RegisterStats(database, log); err != nil {
+		log.Fatal("Failed to register stats metrics", zap.Error(err))
+	}
+	http.Handle("/metrics", metrics.Handler())
+	if webhookPoller != nil {
+		http.Handle(cfg.TelegramWebhookPath(), webhookPoller)
+	}
+	http.HandleFunc("/api/v1/users/{id}/requests", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid user id", http.StatusBadRequest)
+			return
+		}
+
+		requests, err := database.GetUserRequests(r.Context(), userID)
+		if err != nil {
+			log.Error("Failed to get user requests", zap.Error(err), zap.Int64("user_id", userID))
+			http.Error(w, "Failed to get user requests", http.StatusInternalServerError)
+			return
+		}
+
+		stats, err := database.GetUserStats(r.Context(), userID)
+		if err != nil {
+			log.Error("Failed to get user stats", zap.Error(err), zap.Int64("user_id", userID))
+			http.Error(w, "Failed to get user stats", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Stats    *db.UserStats                 `json:"stats"`
+			Requests []models.DownloadQueueRequest `json:"requests"`
+		}{stats, requests})
+	})
+	// Backups hold every request with its creator and chat, so both directions need the token
+	http.HandleFunc("GET /api/v1/export", requireToken(cfg.ImportToken, exportHandler(database, log)))
+	http.HandleFunc("POST /api/v1/import", requireToken(cfg.ImportToken, importHandler(database, log)))
+	http.HandleFunc("/api/v1/requests/{id}/playlist.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		request, err := database.GetDownloadRequest(r.Context(), id)
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, "Request not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Error("Failed to get download request", zap.Error(err), zap.String("id", id))
+			http.Error(w, "Failed to get download request", http.StatusInternalServerError)
+			return
+		}
+
+		p, err := playlist.Build(r.Context(), database, *request)
+		if err != nil {
+			log.Error("Failed to build playlist", zap.Error(err), zap.String("id", id))
+			http.Error(w, "Failed to build playlist", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", playlist.ContentType+"; charset=utf-8")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": p.FileName()}))
+		_ = p.WriteM3U8(w)
+	})
+
 	go func() {
 		log.Info("Starting health check server on :8080")
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -105,7 +224,34 @@ func main() {
 		}
 	}()
 
-	h := handler.NewHandler(database, spotifyService, log, bot, cfg.WebhookURL, cfg.BotWhitelist)
+	catalog, err := cfg.Catalog()
+	if err != nil {
+		log.Fatal("Failed to load messages", zap.Error(err))
+	}
+
+	// One reconciler for the watcher and /queue, so users hear about progress either way
+	notifier := notify.New(database, bot, log, catalog)
+	reconciler := reconcile.New(database, log)
+	reconciler.Observe(notifier)
+
+	// Count newly indexed files against active requests as they arrive
+	go reconciler.NewWatcher(reconcile.WatcherSettings{
+		Stream:         cfg.ReconcileWatch,
+		Interval:       cfg.ReconcileInterval,
+		SafetyInterval: cfg.ReconcileSafetyInterval,
+		MinBackoff:     time.Second,
+		MaxBackoff:     5 * time.Minute,
+	}).Run(ctx)
+
+	h := handler.NewHandler(database, reconciler, log, bot, handler.Settings{
+		WhiteList:      cfg.BotWhitelist,
+		GroupWhiteList: cfg.BotGroupWhitelist,
+		DoneWebhook:    cfg.WebhookURL,
+		PlaylistDir:    cfg.PlaylistDir,
+		Sources:        sources(cfg, spotifyService, spotifySearch),
+		Search:         spotifySearch,
+		Messages:       catalog,
+	})
 
 	bot.Handle("/start", h.Start)
 	bot.Handle(telebot.OnText, h.HandleText)
@@ -113,6 +259,77 @@ func main() {
 	bot.Handle("/deactivate", h.HandleDeactivate)
 	bot.Handle("/p", h.HandlePlaylist)
 	bot.Handle("/pnp", h.HandlePlaylistNoPull)
+	bot.Handle("/mine", h.HandleMine)
+	bot.Handle("/stats", h.HandleStats)
+	bot.Handle("/lang", h.HandleLang)
+	bot.Handle("/playlist", h.HandlePlaylistDefault)
+	bot.Handle("/settings", h.HandleSettings)
+	bot.Handle(&handler.SettingsButton, h.HandleSettingsCallback)
+	bot.Handle("/find", h.HandleFind)
+	bot.Handle(&handler.FindButton, h.HandleFindCallback)
+	bot.Handle("/export", h.HandleExport)
+	bot.Handle(&handler.PickButton, h.HandlePickCallback)
+	bot.Handle(telebot.OnQuery, h.HandleInlineQuery)
+	bot.Handle(telebot.OnChosenInlineResult, h.HandleInlineChosen)
+
+	// Reload on SIGHUP or when a mounted secret file rotates
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		rotated := config.WatchFiles(ctx, cfg.SecretPaths(), cfg.SecretPollInterval)
+
+		current := cfg
+		for {
+			select {
+			case <-hup:
+			case <-rotated:
+				log.Info("Secret file changed, reloading config")
+			case <-ctx.Done():
+				return
+			}
+
+			next, err := config.NewConfig()
+			if err != nil {
+				log.Error("Config reload failed, keeping current config", zap.Error(err))
+				continue
+			}
+			if changed := current.RestartRequired(next); len(changed) > 0 {
+				log.Warn("Config changes need a restart to take effect", zap.Strings("settings", changed))
+			}
+
+			if next.SpotifyClientID != current.SpotifyClientID || next.SpotifyClientSecret != current.SpotifyClientSecret {
+				spotifyService = metrics.InstrumentSpotify(spotify.NewSpotifyService(ctx, next.SpotifyClientID, next.SpotifyClientSecret, log))
+				spotifySearch = metrics.InstrumentSpotifySearch(spotifysearch.New(ctx, next.SpotifyClientID, next.SpotifyClientSecret))
+				readiness.Register("spotify", health.SpotifyTokenProbe(next.SpotifyClientID, next.SpotifyClientSecret))
+				log.Info("Spotify credentials rotated")
+			}
+			if webhookPoller != nil && next.TelegramWebhookSecret != current.TelegramWebhookSecret {
+				if err := webhookPoller.RotateSecret(bot, next.TelegramWebhookSecret); err != nil {
+					log.Error("Failed to rotate telegram webhook secret", zap.Error(err))
+					next.TelegramWebhookSecret = current.TelegramWebhookSecret
+				} else {
+					log.Info("Telegram webhook secret rotated")
+				}
+			}
+
+			// Validation already built the catalog once, so this can't fail
+			catalog, _ := next.Catalog()
+			h.Reload(handler.Settings{
+				WhiteList:      next.BotWhitelist,
+				GroupWhiteList: next.BotGroupWhitelist,
+				DoneWebhook:    next.WebhookURL,
+				PlaylistDir:    next.PlaylistDir,
+				Sources:        sources(next, spotifyService, spotifySearch),
+				Search:         spotifySearch,
+				Messages:       catalog,
+			})
+			notifier.Reload(catalog)
+			readiness.Register("webhook", health.ReachabilityProbe(next.WebhookURL))
+			current = next
+			log.Info("Config reloaded", zap.Any("config", next.Redacted()))
+		}
+	}()
 
 	// Graceful shutdown
 	shutdownDone := make(chan struct{})
@@ -148,3 +365,19 @@ func main() {
 	<-shutdownDone
 	log.Info("Shutdown complete")
 }
+
+// sources lists the services links can be queued from. YouTube Music needs an API key.
+// Apple Music and Deezer links are matched to the same release on Spotify.
+func sources(cfg *config.Config, spotifyService spotify.SpotifyService, search metrics.SpotifySearcher) source.Resolvers {
+	spotifyResolver := source.NewSpotify(spotifyService)
+	resolvers := source.Resolvers{
+		spotifyResolver,
+		source.NewBandcamp(nil),
+		source.NewTranslator(source.NewAppleMusic(nil), search, spotifyResolver),
+		source.NewTranslator(source.NewDeezer(nil), search, spotifyResolver),
+	}
+	if cfg.YouTubeAPIKey != "" {
+		resolvers = append(resolvers, source.NewYouTubeMusic(source.NewYouTubeClient(cfg.YouTubeAPIKey)))
+	}
+	return resolvers
+}
@@ -0,0 +1,257 @@
+// Package backup dumps the download and playlist request queues as JSON Lines or CSV and restores
+// them, so the queue survives moving between databases and test environments can be seeded from
+// production. Restoring is idempotent: records replace the requests with the same ID.
+package backup
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+)
+
+// Collections that can be backed up, named after their Mongo collections
+const (
+	DownloadRequests = "download-queue-requests"
+	PlaylistRequests = "playlist-requests"
+)
+
+// Backup formats
+const (
+	JSONL = "jsonl"
+	CSV   = "csv"
+)
+
+// Collections lists the collections in the order a full backup should handle them
+var Collections = []string{DownloadRequests, PlaylistRequests}
+
+var (
+	// ErrUnsupported is wrapped when the collection or format isn't one of the above
+	ErrUnsupported = errors.New("unsupported")
+	// ErrInvalid is wrapped when a backup being imported can't be read
+	ErrInvalid = errors.New("invalid backup")
+)
+
+// ContentType is the MIME type of format
+func ContentType(format string) string {
+	if format == CSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Export writes every request of collection to w and returns how many it wrote
+func Export(ctx context.Context, database db.Database, w io.Writer, collection, format string) (int, error) {
+	if err := Check(collection, format); err != nil {
+		return 0, err
+	}
+
+	switch collection {
+	case DownloadRequests:
+		records, err := database.DumpDownloadRequests(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return len(records), write(w, format, records, downloadColumns, downloadRow)
+	default:
+		requests, err := database.DumpPlaylistRequests(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return len(requests), write(w, format, requests, playlistColumns, playlistRow)
+	}
+}
+
+// Import reads requests of collection from r and restores them, returning how many it restored.
+// Nothing is restored if any record can't be read.
+func Import(ctx context.Context, database db.Database, r io.Reader, collection, format string) (int, error) {
+	if err := Check(collection, format); err != nil {
+		return 0, err
+	}
+
+	switch collection {
+	case DownloadRequests:
+		records, err := read(r, format, parseDownload, func(r db.DownloadRequestRecord) string { return r.ID })
+		if err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrInvalid, err)
+		}
+		for i := range records {
+			// Like the source migrations, requests from before other sources existed came from Spotify
+			if records[i].Source == "" {
+				records[i].Source = utils.SourceSpotify
+			}
+		}
+		return len(records), database.RestoreDownloadRequests(ctx, records)
+	default:
+		requests, err := read(r, format, parsePlaylist, func(r db.PlaylistRequestRecord) string { return r.ID })
+		if err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrInvalid, err)
+		}
+		return len(requests), database.RestorePlaylistRequests(ctx, requests)
+	}
+}
+
+// Check returns ErrUnsupported for a collection or format Export and Import don't handle
+func Check(collection, format string) error {
+	if collection != DownloadRequests && collection != PlaylistRequests {
+		return fmt.Errorf("collection %q is %w, use %s or %s", collection, ErrUnsupported, DownloadRequests, PlaylistRequests)
+	}
+	if format != JSONL && format != CSV {
+		return fmt.Errorf("format %q is %w, use %s or %s", format, ErrUnsupported, JSONL, CSV)
+	}
+	return nil
+}
+
+// write encodes items one JSON object per line, or as CSV rows under a header of columns
+func write[T any](w io.Writer, format string, items []T, columns []string, row func(T) ([]string, error)) error {
+	if format == JSONL {
+		enc := json.NewEncoder(w)
+		for _, item := range items {
+			if err := enc.Encode(item); err != nil {
+				return fmt.Errorf("failed to write record: %w", err)
+			}
+		}
+		return nil
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	for _, item := range items {
+		values, err := row(item)
+		if err != nil {
+			return err
+		}
+		if err := cw.Write(values); err != nil {
+			return fmt.Errorf("failed to write record: %w", err)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// read decodes every record in r, rejecting records without an ID since restoring matches on it
+func read[T any](r io.Reader, format string, parse func(*fields) T, id func(T) string) ([]T, error) {
+	var items []T
+	add := func(n int, item T) error {
+		if id(item) == "" {
+			return fmt.Errorf("record %d has no id", n)
+		}
+		items = append(items, item)
+		return nil
+	}
+
+	if format == JSONL {
+		dec := json.NewDecoder(r)
+		for n := 1; ; n++ {
+			var item T
+			err := dec.Decode(&item)
+			if err == io.EOF {
+				return items, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read record %d: %w", n, err)
+			}
+			if err := add(n, item); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	f := &fields{index: make(map[string]int, len(header))}
+	for i, name := range header {
+		f.index[name] = i
+	}
+	if _, ok := f.index["id"]; !ok {
+		return nil, errors.New("header has no id column")
+	}
+
+	for n := 1; ; n++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read record %d: %w", n, err)
+		}
+
+		f.row, f.err = row, nil
+		item := parse(f)
+		if f.err != nil {
+			return nil, fmt.Errorf("failed to read record %d: %w", n, f.err)
+		}
+		if err := add(n, item); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fields reads a CSV row by column name. Missing columns and empty values read as zero values,
+// the first malformed value is kept in err.
+type fields struct {
+	index map[string]int
+	row   []string
+	err   error
+}
+
+func (f *fields) str(name string) string {
+	i, ok := f.index[name]
+	if !ok || i >= len(f.row) {
+		return ""
+	}
+	return f.row[i]
+}
+
+func (f *fields) int64(name string) int64 {
+	s := f.str(name)
+	if s == "" {
+		return 0
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil && f.err == nil {
+		f.err = fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return n
+}
+
+func (f *fields) int(name string) int {
+	return int(f.int64(name))
+}
+
+func (f *fields) bool(name string) bool {
+	s := f.str(name)
+	if s == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil && f.err == nil {
+		f.err = fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return b
+}
+
+// json decodes a column holding JSON, used for lists that don't fit a single CSV value
+func (f *fields) json(name string, v any) {
+	s := f.str(name)
+	if s == "" {
+		return
+	}
+	if err := json.Unmarshal([]byte(s), v); err != nil && f.err == nil {
+		f.err = fmt.Errorf("invalid %s: %w", name, err)
+	}
+}
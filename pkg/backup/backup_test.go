@@ -0,0 +1,219 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	models "github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+var (
+	records = []db.DownloadRequestRecord{
+		{
+			DownloadQueueRequest: models.DownloadQueueRequest{
+				ID: "a", SpotifyURL: "https://open.spotify.com/album/1", Name: `OK "Computer", 1997`, Active: true,
+				CreatedAt: 100, UpdatedAt: 100, CreatorID: 1, ExpectedTrackCount: 2,
+				TrackMetadata: []spotify.TrackMetadata{{Artist: "Radiohead", Title: "Airbag"}, {Artist: "Radiohead", Title: "Lucky"}},
+			},
+			Source: utils.SourceSpotify,
+		},
+		{
+			DownloadQueueRequest: models.DownloadQueueRequest{
+				ID: "b", SpotifyURL: "https://open.spotify.com/album/2", Name: "Dummy", Errored: true, RetryCount: 3,
+				CreatedAt: 200, UpdatedAt: 300, CreatorID: 2, ExpectedTrackCount: 1, FoundTrackCount: 1,
+				TrackMetadata: []spotify.TrackMetadata{{Artist: "Portishead", Title: "Roads"}},
+			},
+			Source:    utils.SourceYouTubeMusic,
+			Chat:      db.Chat{ID: -100, MessageID: 7},
+			Selection: []int{4},
+		},
+	}
+	playlists = []db.PlaylistRequestRecord{
+		{
+			PlaylistRequest: models.PlaylistRequest{ID: "p", SpotifyURL: "https://open.spotify.com/playlist/1", Active: true, CreatedAt: 100, CreatorID: 1, NoPull: true},
+			Chat:            db.Chat{ID: -100, MessageID: 8},
+		},
+	}
+)
+
+func seeded(t *testing.T) *db.MemoryDatabase {
+	t.Helper()
+
+	mem := db.NewMemoryDatabase()
+	if err := mem.RestoreDownloadRequests(context.Background(), records); err != nil {
+		t.Fatalf("RestoreDownloadRequests() unexpected error: %v", err)
+	}
+	if err := mem.RestorePlaylistRequests(context.Background(), playlists); err != nil {
+		t.Fatalf("RestorePlaylistRequests() unexpected error: %v", err)
+	}
+	return mem
+}
+
+func TestExportImport(t *testing.T) {
+	for _, format := range []string{JSONL, CSV} {
+		t.Run(format, func(t *testing.T) {
+			ctx := context.Background()
+			from, to := seeded(t), db.NewMemoryDatabase()
+
+			for _, collection := range Collections {
+				var buf bytes.Buffer
+				if _, err := Export(ctx, from, &buf, collection, format); err != nil {
+					t.Fatalf("Export(%s) unexpected error: %v", collection, err)
+				}
+				dump := buf.String()
+
+				// Importing twice restores each request once
+				for range 2 {
+					if _, err := Import(ctx, to, strings.NewReader(dump), collection, format); err != nil {
+						t.Fatalf("Import(%s) unexpected error: %v", collection, err)
+					}
+				}
+			}
+
+			restored, _ := to.DumpDownloadRequests(ctx)
+			if !reflect.DeepEqual(restored, records) {
+				t.Errorf("restored download requests = %+v, want %+v", restored, records)
+			}
+			restoredPlaylists, _ := to.DumpPlaylistRequests(ctx)
+			if !reflect.DeepEqual(restoredPlaylists, playlists) {
+				t.Errorf("restored playlist requests = %+v, want %+v", restoredPlaylists, playlists)
+			}
+		})
+	}
+}
+
+func TestExport_CSV(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := Export(context.Background(), seeded(t), &buf, PlaylistRequests, CSV)
+	if err != nil {
+		t.Fatalf("Export() unexpected error: %v", err)
+	}
+
+	expected := "id,spotify_url,active,created_at,creator_id,chat_id,chat_message_id,no_pull\n" +
+		"p,https://open.spotify.com/playlist/1,true,100,1,-100,8,true\n"
+	if n != 1 || buf.String() != expected {
+		t.Errorf("Export() = %d, %q, want 1, %q", n, buf.String(), expected)
+	}
+}
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		format     string
+		input      string
+		expected   int
+		// err must appear in the error, empty means success
+		err   string
+		check func(t *testing.T, mem *db.MemoryDatabase)
+	}{
+		{
+			name:       "csv with columns in any order and some missing",
+			collection: PlaylistRequests,
+			format:     CSV,
+			input:      "spotify_url,id\nhttps://open.spotify.com/playlist/1,p1\nhttps://open.spotify.com/playlist/2,p2\n",
+			expected:   2,
+		},
+		{
+			name:       "request without a source came from spotify",
+			collection: DownloadRequests,
+			format:     JSONL,
+			input:      `{"id":"a","spotify_url":"https://open.spotify.com/album/1"}` + "\n",
+			expected:   1,
+			check: func(t *testing.T, mem *db.MemoryDatabase) {
+				if got := mem.Source("a"); got != utils.SourceSpotify {
+					t.Errorf("Source() = %q, want %q", got, utils.SourceSpotify)
+				}
+			},
+		},
+		{
+			name:       "empty csv",
+			collection: PlaylistRequests,
+			format:     CSV,
+		},
+		{
+			name:       "empty jsonl",
+			collection: DownloadRequests,
+			format:     JSONL,
+		},
+		{
+			name:       "csv without id column",
+			collection: PlaylistRequests,
+			format:     CSV,
+			input:      "spotify_url\nhttps://open.spotify.com/playlist/1\n",
+			err:        "header has no id column",
+		},
+		{
+			name:       "record without id",
+			collection: DownloadRequests,
+			format:     JSONL,
+			input:      `{"id":"a","name":"OK Computer"}` + "\n" + `{"name":"Dummy"}` + "\n",
+			err:        "record 2 has no id",
+		},
+		{
+			name:       "malformed csv value",
+			collection: DownloadRequests,
+			format:     CSV,
+			input:      "id,created_at\na,yesterday\n",
+			err:        "record 1: invalid created_at",
+		},
+		{
+			name:       "malformed json",
+			collection: DownloadRequests,
+			format:     JSONL,
+			input:      `{"id":"a"` + "\n",
+			err:        "failed to read record 1",
+		},
+		{
+			name:       "unknown collection",
+			collection: "music-files",
+			format:     JSONL,
+			err:        `collection "music-files" is unsupported`,
+		},
+		{
+			name:       "unknown format",
+			collection: DownloadRequests,
+			format:     "xml",
+			err:        `format "xml" is unsupported`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := db.NewMemoryDatabase()
+			n, err := Import(context.Background(), mem, strings.NewReader(tt.input), tt.collection, tt.format)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Import() error = %v, want %q", err, tt.err)
+				}
+				if requests, _ := mem.DumpDownloadRequests(context.Background()); len(requests) != 0 {
+					t.Errorf("failed import restored %d requests", len(requests))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Import() unexpected error: %v", err)
+			}
+			if n != tt.expected {
+				t.Errorf("Import() = %d, want %d", n, tt.expected)
+			}
+			if tt.check != nil {
+				tt.check(t, mem)
+			}
+		})
+	}
+
+	if _, err := Import(context.Background(), db.NewMemoryDatabase(), strings.NewReader(""), "x", JSONL); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Import() error = %v, want ErrUnsupported", err)
+	}
+	if _, err := Import(context.Background(), db.NewMemoryDatabase(), strings.NewReader("{}"), PlaylistRequests, JSONL); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Import() error = %v, want ErrInvalid", err)
+	}
+}
@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	models "github.com/supperdoggy/spot-models"
+)
+
+// downloadColumns are the CSV columns of download requests, named like their JSON fields.
+// track_metadata and selection hold JSON arrays.
+var downloadColumns = []string{
+	"id", "source", "spotify_url", "name", "active", "errored", "retry_count", "created_at", "updated_at",
+	"creator_id", "chat_id", "chat_message_id", "expected_track_count", "found_track_count",
+	"track_metadata", "selection",
+}
+
+func downloadRow(r db.DownloadRequestRecord) ([]string, error) {
+	tracks, err := json.Marshal(r.TrackMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode track metadata of %s: %w", r.ID, err)
+	}
+	// Whole releases have no selection, left empty rather than null
+	var selection []byte
+	if r.Selection != nil {
+		if selection, err = json.Marshal(r.Selection); err != nil {
+			return nil, fmt.Errorf("failed to encode selection of %s: %w", r.ID, err)
+		}
+	}
+
+	return []string{
+		r.ID, r.Source, r.SpotifyURL, r.Name,
+		strconv.FormatBool(r.Active), strconv.FormatBool(r.Errored), strconv.Itoa(r.RetryCount),
+		strconv.FormatInt(r.CreatedAt, 10), strconv.FormatInt(r.UpdatedAt, 10),
+		strconv.FormatInt(r.CreatorID, 10), strconv.FormatInt(r.Chat.ID, 10), strconv.Itoa(r.Chat.MessageID),
+		strconv.Itoa(r.ExpectedTrackCount), strconv.Itoa(r.FoundTrackCount),
+		string(tracks), string(selection),
+	}, nil
+}
+
+func parseDownload(f *fields) db.DownloadRequestRecord {
+	r := db.DownloadRequestRecord{
+		DownloadQueueRequest: models.DownloadQueueRequest{
+			ID:                 f.str("id"),
+			SpotifyURL:         f.str("spotify_url"),
+			Name:               f.str("name"),
+			Active:             f.bool("active"),
+			Errored:            f.bool("errored"),
+			RetryCount:         f.int("retry_count"),
+			CreatedAt:          f.int64("created_at"),
+			UpdatedAt:          f.int64("updated_at"),
+			CreatorID:          f.int64("creator_id"),
+			ExpectedTrackCount: f.int("expected_track_count"),
+			FoundTrackCount:    f.int("found_track_count"),
+		},
+		Source: f.str("source"),
+		Chat:   db.Chat{ID: f.int64("chat_id"), MessageID: f.int("chat_message_id")},
+	}
+	f.json("track_metadata", &r.TrackMetadata)
+	f.json("selection", &r.Selection)
+	return r
+}
+
+// playlistColumns are the CSV columns of playlist requests, named like their JSON fields
+var playlistColumns = []string{"id", "spotify_url", "active", "created_at", "creator_id", "chat_id", "chat_message_id", "no_pull"}
+
+func playlistRow(r db.PlaylistRequestRecord) ([]string, error) {
+	return []string{
+		r.ID, r.SpotifyURL, strconv.FormatBool(r.Active), strconv.FormatInt(r.CreatedAt, 10),
+		strconv.FormatInt(r.CreatorID, 10), strconv.FormatInt(r.Chat.ID, 10), strconv.Itoa(r.Chat.MessageID),
+		strconv.FormatBool(r.NoPull),
+	}, nil
+}
+
+func parsePlaylist(f *fields) db.PlaylistRequestRecord {
+	return db.PlaylistRequestRecord{
+		PlaylistRequest: models.PlaylistRequest{
+			ID:         f.str("id"),
+			SpotifyURL: f.str("spotify_url"),
+			Active:     f.bool("active"),
+			CreatedAt:  f.int64("created_at"),
+			CreatorID:  f.int64("creator_id"),
+			NoPull:     f.bool("no_pull"),
+		},
+		Chat: db.Chat{ID: f.int64("chat_id"), MessageID: f.int("chat_message_id")},
+	}
+}
@@ -1,26 +1,315 @@
 package config
 
-import "github.com/kelseyhightower/envconfig"
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/i18n"
+	"gopkg.in/yaml.v3"
+)
+
+// Telegram update delivery modes
+const (
+	TelegramModePolling = "polling"
+	TelegramModeWebhook = "webhook"
+)
+
+// FileEnv names the optional YAML or TOML config file. Environment variables override its values.
+const FileEnv = "CONFIG_FILE"
+
+// redacted replaces secret values in logged config
+const redacted = "[redacted]"
 
 type Config struct {
-	DatabaseURL  string `envconfig:"DATABASE_URL" required:"true"`
-	DatabaseName string `envconfig:"DATABASE_NAME" required:"true"`
+	DatabaseURL     string `envconfig:"DATABASE_URL" yaml:"database_url" toml:"database_url"`
+	DatabaseURLFile string `envconfig:"DATABASE_URL_FILE" yaml:"database_url_file" toml:"database_url_file"`
+	DatabaseName    string `envconfig:"DATABASE_NAME" yaml:"database_name" toml:"database_name"`
+
+	BotToken     string  `envconfig:"BOT_TOKEN" yaml:"bot_token" toml:"bot_token"`
+	BotTokenFile string  `envconfig:"BOT_TOKEN_FILE" yaml:"bot_token_file" toml:"bot_token_file"`
+	BotWhitelist []int64 `envconfig:"BOT_WHITELIST" yaml:"bot_whitelist" toml:"bot_whitelist"`
+	// BotGroupWhitelist limits the group chats the bot works in, any group is allowed when it is empty
+	BotGroupWhitelist []int64 `envconfig:"BOT_GROUP_WHITELIST" yaml:"bot_group_whitelist" toml:"bot_group_whitelist"`
+
+	TelegramMode                  string `envconfig:"TELEGRAM_MODE" yaml:"telegram_mode" toml:"telegram_mode"`
+	TelegramWebhookURL            string `envconfig:"TELEGRAM_WEBHOOK_URL" yaml:"telegram_webhook_url" toml:"telegram_webhook_url"`
+	TelegramWebhookSecret         string `envconfig:"TELEGRAM_WEBHOOK_SECRET" yaml:"telegram_webhook_secret" toml:"telegram_webhook_secret"`
+	TelegramWebhookSecretFile     string `envconfig:"TELEGRAM_WEBHOOK_SECRET_FILE" yaml:"telegram_webhook_secret_file" toml:"telegram_webhook_secret_file"`
+	TelegramWebhookCert           string `envconfig:"TELEGRAM_WEBHOOK_CERT" yaml:"telegram_webhook_cert" toml:"telegram_webhook_cert"`
+	TelegramWebhookMaxConnections int    `envconfig:"TELEGRAM_WEBHOOK_MAX_CONNECTIONS" yaml:"telegram_webhook_max_connections" toml:"telegram_webhook_max_connections"`
 
-	BotToken     string  `envconfig:"BOT_TOKEN" required:"true"`
-	BotWhitelist []int64 `envconfig:"BOT_WHITELIST" required:"true"`
+	WebhookURL string `envconfig:"WEBHOOK_URL" yaml:"webhook_url" toml:"webhook_url"`
 
-	WebhookURL string `envconfig:"WEBHOOK_URL" required:"true"`
+	SpotifyClientID         string `envconfig:"SPOTIFY_CLIENT_ID" yaml:"spotify_client_id" toml:"spotify_client_id"`
+	SpotifyClientSecret     string `envconfig:"SPOTIFY_CLIENT_SECRET" yaml:"spotify_client_secret" toml:"spotify_client_secret"`
+	SpotifyClientSecretFile string `envconfig:"SPOTIFY_CLIENT_SECRET_FILE" yaml:"spotify_client_secret_file" toml:"spotify_client_secret_file"`
 
-	SpotifyClientID     string `envconfig:"SPOTIFY_CLIENT_ID" required:"true"`
-	SpotifyClientSecret string `envconfig:"SPOTIFY_CLIENT_SECRET" required:"true"`
+	// YouTubeAPIKey enables music.youtube.com links, they are rejected without it
+	YouTubeAPIKey     string `envconfig:"YOUTUBE_API_KEY" yaml:"youtube_api_key" toml:"youtube_api_key"`
+	YouTubeAPIKeyFile string `envconfig:"YOUTUBE_API_KEY_FILE" yaml:"youtube_api_key_file" toml:"youtube_api_key_file"`
+
+	// ImportToken enables the HTTP backup endpoints for requests bearing it, they are disabled without it
+	ImportToken     string `envconfig:"IMPORT_TOKEN" yaml:"import_token" toml:"import_token"`
+	ImportTokenFile string `envconfig:"IMPORT_TOKEN_FILE" yaml:"import_token_file" toml:"import_token_file"`
+
+	// PlaylistDir is where /export saves playlists for a media server to pick up, they are sent
+	// as documents when it is empty
+	PlaylistDir string `envconfig:"PLAYLIST_DIR" yaml:"playlist_dir" toml:"playlist_dir"`
+
+	DefaultLanguage string `envconfig:"DEFAULT_LANGUAGE" yaml:"default_language" toml:"default_language"`
+	// Messages overrides bot replies by locale and message key, it can only be set in the config file
+	Messages map[string]map[string]string `ignored:"true" yaml:"messages" toml:"messages"`
+
+	ReconcileInterval time.Duration `envconfig:"RECONCILE_INTERVAL" yaml:"reconcile_interval" toml:"reconcile_interval"`
+	// ReconcileWatch follows the music-files change stream when the database supports it
+	ReconcileWatch bool `envconfig:"RECONCILE_WATCH" yaml:"reconcile_watch" toml:"reconcile_watch"`
+	// ReconcileSafetyInterval is how often every active request is reconciled while the change stream runs
+	ReconcileSafetyInterval time.Duration `envconfig:"RECONCILE_SAFETY_INTERVAL" yaml:"reconcile_safety_interval" toml:"reconcile_safety_interval"`
+	SecretPollInterval      time.Duration `envconfig:"SECRET_POLL_INTERVAL" yaml:"secret_poll_interval" toml:"secret_poll_interval"`
 }
 
+// NewConfig loads defaults, then the file named by CONFIG_FILE if set, then environment overrides,
+// and validates the result. It is called again on SIGHUP to reload.
 func NewConfig() (*Config, error) {
-	cfg := new(Config)
-	err := envconfig.Process("", cfg)
-	if err != nil {
+	cfg := &Config{
+		TelegramMode:            TelegramModePolling,
+		DefaultLanguage:         i18n.Ukrainian,
+		ReconcileInterval:       5 * time.Minute,
+		ReconcileWatch:          true,
+		ReconcileSafetyInterval: time.Hour,
+		SecretPollInterval:      30 * time.Second,
+	}
+
+	if path := os.Getenv(FileEnv); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// No field has a default or required tag, so envconfig only touches variables that are set
+	if err := envconfig.Process("", cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.readSecretFiles(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
 
 	return cfg, nil
 }
+
+func (c *Config) loadFile(path string) error {
+	var unmarshal func([]byte, interface{}) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		unmarshal = yaml.Unmarshal
+	case ".toml":
+		unmarshal = toml.Unmarshal
+	default:
+		return fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := unmarshal(data, c); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// secretFile pairs a secret with the *_FILE setting it can be read from
+type secretFile struct {
+	name  string
+	path  string
+	value *string
+	// reloadable secrets are applied without a restart when their file rotates
+	reloadable bool
+}
+
+func (c *Config) secretFiles() []secretFile {
+	return []secretFile{
+		// The bot and the database connection are shared by everything and hold these for
+		// their lifetime, so a rotated file only takes effect after a restart
+		{"DATABASE_URL_FILE", c.DatabaseURLFile, &c.DatabaseURL, false},
+		{"BOT_TOKEN_FILE", c.BotTokenFile, &c.BotToken, false},
+		{"TELEGRAM_WEBHOOK_SECRET_FILE", c.TelegramWebhookSecretFile, &c.TelegramWebhookSecret, true},
+		{"SPOTIFY_CLIENT_SECRET_FILE", c.SpotifyClientSecretFile, &c.SpotifyClientSecret, true},
+		{"YOUTUBE_API_KEY_FILE", c.YouTubeAPIKeyFile, &c.YouTubeAPIKey, true},
+		// The import handler keeps the token it was started with
+		{"IMPORT_TOKEN_FILE", c.ImportTokenFile, &c.ImportToken, false},
+	}
+}
+
+// readSecretFiles fills secrets from their *_FILE paths, which take precedence over plain values
+func (c *Config) readSecretFiles() error {
+	for _, secret := range c.secretFiles() {
+		if secret.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(secret.path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", secret.name, err)
+		}
+		*secret.value = strings.TrimSpace(string(data))
+	}
+	return nil
+}
+
+// SecretPaths lists the secret files in use that are applied on reload, to be watched for
+// rotation. Secrets that need a restart, like DATABASE_URL_FILE and BOT_TOKEN_FILE, are left out.
+func (c *Config) SecretPaths() []string {
+	var paths []string
+	for _, secret := range c.secretFiles() {
+		if secret.path != "" && secret.reloadable {
+			paths = append(paths, secret.path)
+		}
+	}
+	return paths
+}
+
+// Redacted returns a copy that is safe to log: secrets are masked and the
+// database URL keeps everything but its password.
+func (c *Config) Redacted() Config {
+	r := *c
+	for _, secret := range r.secretFiles() {
+		if *secret.value != "" {
+			*secret.value = redacted
+		}
+	}
+	if u, err := url.Parse(c.DatabaseURL); err == nil {
+		r.DatabaseURL = u.Redacted()
+	}
+	return r
+}
+
+// Validate reports every problem with the config at once
+func (c *Config) Validate() error {
+	var errs []error
+
+	required := []struct {
+		name  string
+		value string
+	}{
+		{"DATABASE_URL or DATABASE_URL_FILE", c.DatabaseURL},
+		{"DATABASE_NAME", c.DatabaseName},
+		{"BOT_TOKEN or BOT_TOKEN_FILE", c.BotToken},
+		{"WEBHOOK_URL", c.WebhookURL},
+		{"SPOTIFY_CLIENT_ID", c.SpotifyClientID},
+		{"SPOTIFY_CLIENT_SECRET or SPOTIFY_CLIENT_SECRET_FILE", c.SpotifyClientSecret},
+	}
+	for _, field := range required {
+		if field.value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", field.name))
+		}
+	}
+
+	if len(c.BotWhitelist) == 0 {
+		errs = append(errs, errors.New("BOT_WHITELIST must list at least one Telegram user ID"))
+	}
+
+	if c.WebhookURL != "" {
+		u, err := url.Parse(c.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("WEBHOOK_URL must be an http or https URL, got %q", c.WebhookURL))
+		}
+	}
+
+	if c.ReconcileInterval <= 0 {
+		errs = append(errs, fmt.Errorf("RECONCILE_INTERVAL must be positive, got %s", c.ReconcileInterval))
+	}
+	if c.ReconcileSafetyInterval <= 0 {
+		errs = append(errs, fmt.Errorf("RECONCILE_SAFETY_INTERVAL must be positive, got %s", c.ReconcileSafetyInterval))
+	}
+	if c.SecretPollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("SECRET_POLL_INTERVAL must be positive, got %s", c.SecretPollInterval))
+	}
+
+	if err := c.validateTelegram(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := c.Catalog(); err != nil {
+		errs = append(errs, fmt.Errorf("invalid messages: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// RestartRequired lists the settings that differ in next but only take effect after a restart.
+// Everything else is applied on reload.
+func (c *Config) RestartRequired(next *Config) []string {
+	var changed []string
+	check := func(name string, same bool) {
+		if !same {
+			changed = append(changed, name)
+		}
+	}
+
+	check("DATABASE_URL", c.DatabaseURL == next.DatabaseURL)
+	check("DATABASE_NAME", c.DatabaseName == next.DatabaseName)
+	check("BOT_TOKEN", c.BotToken == next.BotToken)
+	check("TELEGRAM_MODE", c.TelegramMode == next.TelegramMode)
+	check("TELEGRAM_WEBHOOK_URL", c.TelegramWebhookURL == next.TelegramWebhookURL)
+	check("TELEGRAM_WEBHOOK_CERT", c.TelegramWebhookCert == next.TelegramWebhookCert)
+	check("TELEGRAM_WEBHOOK_MAX_CONNECTIONS", c.TelegramWebhookMaxConnections == next.TelegramWebhookMaxConnections)
+	check("RECONCILE_INTERVAL", c.ReconcileInterval == next.ReconcileInterval)
+	check("RECONCILE_WATCH", c.ReconcileWatch == next.ReconcileWatch)
+	check("RECONCILE_SAFETY_INTERVAL", c.ReconcileSafetyInterval == next.ReconcileSafetyInterval)
+	check("SECRET_POLL_INTERVAL", c.SecretPollInterval == next.SecretPollInterval)
+	check("IMPORT_TOKEN", c.ImportToken == next.ImportToken)
+
+	return changed
+}
+
+// Catalog builds the bot's message catalog with the configured overrides
+func (c *Config) Catalog() (*i18n.Catalog, error) {
+	return i18n.New(c.DefaultLanguage, c.Messages)
+}
+
+// TelegramWebhookPath is the path on the HTTP server that receives Telegram updates
+func (c *Config) TelegramWebhookPath() string {
+	u, err := url.Parse(c.TelegramWebhookURL)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
+
+func (c *Config) validateTelegram() error {
+	switch c.TelegramMode {
+	case TelegramModePolling:
+		return nil
+	case TelegramModeWebhook:
+	default:
+		return fmt.Errorf("TELEGRAM_MODE must be %q or %q, got %q", TelegramModePolling, TelegramModeWebhook, c.TelegramMode)
+	}
+
+	u, err := url.Parse(c.TelegramWebhookURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("TELEGRAM_WEBHOOK_URL must be an https URL in webhook mode, got %q", c.TelegramWebhookURL)
+	}
+	if u.Path == "" || u.Path == "/" {
+		return fmt.Errorf("TELEGRAM_WEBHOOK_URL must have a path to mount the webhook on, got %q", c.TelegramWebhookURL)
+	}
+	// The webhook is served next to /health and /metrics, the secret is all that keeps
+	// forged updates from impersonating whitelisted users
+	if c.TelegramWebhookSecret == "" {
+		return errors.New("TELEGRAM_WEBHOOK_SECRET or TELEGRAM_WEBHOOK_SECRET_FILE is required in webhook mode")
+	}
+
+	return nil
+}
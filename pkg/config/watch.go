@@ -0,0 +1,58 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"time"
+)
+
+// WatchFiles polls paths every interval and signals on the returned channel when
+// any of their contents change, such as a Kubernetes secret being rotated. Signals
+// are coalesced: a pending one is not duplicated. Files that can't be read are
+// skipped until they reappear, so a half-finished swap isn't reported.
+func WatchFiles(ctx context.Context, paths []string, interval time.Duration) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	if len(paths) == 0 {
+		return changed
+	}
+
+	seen := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		seen[path], _ = os.ReadFile(path)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			rotated := false
+			for _, path := range paths {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					continue
+				}
+				if !bytes.Equal(data, seen[path]) {
+					seen[path] = data
+					rotated = true
+				}
+			}
+
+			if rotated {
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return changed
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	models "github.com/supperdoggy/spot-models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DownloadRequestRecord is a download request with the fields this service keeps beside the
+// shared model, everything needed to restore it into any backend
+type DownloadRequestRecord struct {
+	models.DownloadQueueRequest
+
+	Source    string `json:"source"`
+	Chat      Chat   `json:"chat"`
+	Selection []int  `json:"selection,omitempty"`
+}
+
+// PlaylistRequestRecord is a playlist request with the group chat it was made in
+type PlaylistRequestRecord struct {
+	models.PlaylistRequest
+
+	Chat Chat `json:"chat"`
+}
+
+// dumpSort keeps dumps in the order requests were made, so they diff well
+var dumpSort = bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}
+
+func (d *db) DumpDownloadRequests(ctx context.Context) ([]DownloadRequestRecord, error) {
+	cursor, err := d.downloadQueueRequestCollection.Find(ctx, bson.M{}, options.Find().SetSort(dumpSort))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find download requests: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var documents []downloadRequestDocument
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("failed to decode download requests: %w", err)
+	}
+
+	records := make([]DownloadRequestRecord, 0, len(documents))
+	for _, doc := range documents {
+		record := DownloadRequestRecord{
+			DownloadQueueRequest: doc.DownloadQueueRequest,
+			Source:               doc.Source,
+			Selection:            doc.Selection,
+		}
+		if doc.Chat != nil {
+			record.Chat = *doc.Chat
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func (d *db) DumpPlaylistRequests(ctx context.Context) ([]PlaylistRequestRecord, error) {
+	cursor, err := d.playlistRequestCollection.Find(ctx, bson.M{}, options.Find().SetSort(dumpSort))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find playlist requests: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var documents []playlistRequestDocument
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("failed to decode playlist requests: %w", err)
+	}
+
+	records := make([]PlaylistRequestRecord, 0, len(documents))
+	for _, doc := range documents {
+		record := PlaylistRequestRecord{PlaylistRequest: doc.PlaylistRequest}
+		if doc.Chat != nil {
+			record.Chat = *doc.Chat
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// RestoreDownloadRequests replaces the requests with the records' IDs, inserting those that are missing
+func (d *db) RestoreDownloadRequests(ctx context.Context, records []DownloadRequestRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(records))
+	for _, record := range records {
+		spotifyID, _ := utils.SpotifyID(record.SpotifyURL)
+		document := downloadRequestDocument{
+			DownloadQueueRequest: record.DownloadQueueRequest,
+			SpotifyID:            spotifyID,
+			Status:               utils.RequestStatus(record.DownloadQueueRequest),
+			Source:               record.Source,
+			Selection:            record.Selection,
+		}
+		if record.Chat.IsGroup() {
+			chat := record.Chat
+			document.Chat = &chat
+		}
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": record.ID}).SetReplacement(document).SetUpsert(true))
+	}
+
+	if _, err := d.downloadQueueRequestCollection.BulkWrite(ctx, writes); err != nil {
+		return fmt.Errorf("failed to restore download requests: %w", err)
+	}
+
+	return nil
+}
+
+// RestorePlaylistRequests replaces the requests with the same IDs, inserting those that are missing
+func (d *db) RestorePlaylistRequests(ctx context.Context, records []PlaylistRequestRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(records))
+	for _, record := range records {
+		spotifyID, _ := utils.SpotifyID(record.SpotifyURL)
+		document := playlistRequestDocument{PlaylistRequest: record.PlaylistRequest, SpotifyID: spotifyID}
+		if record.Chat.IsGroup() {
+			chat := record.Chat
+			document.Chat = &chat
+		}
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": record.ID}).SetReplacement(document).SetUpsert(true))
+	}
+
+	if _, err := d.playlistRequestCollection.BulkWrite(ctx, writes); err != nil {
+		return fmt.Errorf("failed to restore playlist requests: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,353 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	models "github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+// backend opens an empty Database and a way to seed its music files
+type backend func(t *testing.T) (Database, func(files ...models.MusicFile))
+
+// testConformance runs the behaviour every Database implementation must share
+func testConformance(t *testing.T, open backend) {
+	t.Run("FindMusicFiles", func(t *testing.T) { testFindMusicFiles(t, open) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, open) })
+	t.Run("RequestLifecycle", func(t *testing.T) { testRequestLifecycle(t, open) })
+	t.Run("RequestChat", func(t *testing.T) { testRequestChat(t, open) })
+	t.Run("UserPreferences", func(t *testing.T) { testUserPreferences(t, open) })
+	t.Run("DumpRestore", func(t *testing.T) { testDumpRestore(t, open) })
+}
+
+func testDumpRestore(t *testing.T, open backend) {
+	m, _ := open(t)
+	ctx := context.Background()
+
+	records := []DownloadRequestRecord{
+		{
+			DownloadQueueRequest: models.DownloadQueueRequest{
+				ID: "b", SpotifyURL: "https://open.spotify.com/album/2", Name: "Dummy", Active: false,
+				Errored: true, RetryCount: 3, CreatedAt: 200, UpdatedAt: 300, CreatorID: 2,
+				ExpectedTrackCount: 1, FoundTrackCount: 1,
+				TrackMetadata: []spotify.TrackMetadata{{Artist: "Portishead", Title: "Roads"}},
+			},
+			Source:    utils.SourceSpotify,
+			Chat:      Chat{ID: -100, MessageID: 7},
+			Selection: []int{4},
+		},
+		{
+			DownloadQueueRequest: models.DownloadQueueRequest{
+				ID: "a", SpotifyURL: "https://open.spotify.com/album/1", Name: "OK Computer", Active: true,
+				CreatedAt: 100, UpdatedAt: 100, CreatorID: 1, ExpectedTrackCount: 2,
+				TrackMetadata: []spotify.TrackMetadata{{Artist: "Radiohead", Title: "Airbag"}, {Artist: "Radiohead", Title: "Lucky"}},
+			},
+			Source: utils.SourceYouTubeMusic,
+		},
+	}
+	playlists := []PlaylistRequestRecord{
+		{
+			PlaylistRequest: models.PlaylistRequest{ID: "p", SpotifyURL: "https://open.spotify.com/playlist/1", Active: true, CreatedAt: 100, CreatorID: 1, NoPull: true},
+			Chat:            Chat{ID: -100, MessageID: 9},
+		},
+		{
+			PlaylistRequest: models.PlaylistRequest{ID: "q", SpotifyURL: "https://open.spotify.com/playlist/2", Active: true, CreatedAt: 200, CreatorID: 2},
+		},
+	}
+
+	// Restoring the same backup twice leaves one copy of each request
+	for range 2 {
+		if err := m.RestoreDownloadRequests(ctx, records); err != nil {
+			t.Fatalf("RestoreDownloadRequests() unexpected error: %v", err)
+		}
+		if err := m.RestorePlaylistRequests(ctx, playlists); err != nil {
+			t.Fatalf("RestorePlaylistRequests() unexpected error: %v", err)
+		}
+	}
+
+	dumped, err := m.DumpDownloadRequests(ctx)
+	if err != nil {
+		t.Fatalf("DumpDownloadRequests() unexpected error: %v", err)
+	}
+	if expected := []DownloadRequestRecord{records[1], records[0]}; !reflect.DeepEqual(dumped, expected) {
+		t.Errorf("DumpDownloadRequests() = %+v, want %+v in creation order", dumped, expected)
+	}
+
+	dumpedPlaylists, err := m.DumpPlaylistRequests(ctx)
+	if err != nil {
+		t.Fatalf("DumpPlaylistRequests() unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(dumpedPlaylists, playlists) {
+		t.Errorf("DumpPlaylistRequests() = %+v, want %+v", dumpedPlaylists, playlists)
+	}
+
+	chat, err := m.GetRequestChat(ctx, "b")
+	if err != nil || chat != records[0].Chat {
+		t.Errorf("GetRequestChat(b) = %+v, %v, want the restored chat", chat, err)
+	}
+
+	// A restore overwrites what changed since the backup
+	if err := m.DeactivateRequest(ctx, "a"); err != nil {
+		t.Fatalf("DeactivateRequest() unexpected error: %v", err)
+	}
+	if err := m.RestoreDownloadRequests(ctx, records[1:]); err != nil {
+		t.Fatalf("RestoreDownloadRequests() unexpected error: %v", err)
+	}
+	request, err := m.GetDownloadRequest(ctx, "a")
+	if err != nil {
+		t.Fatalf("GetDownloadRequest() unexpected error: %v", err)
+	}
+	if !request.Active {
+		t.Error("restored request is still deactivated")
+	}
+}
+
+func testUserPreferences(t *testing.T, open backend) {
+	m, _ := open(t)
+	ctx := context.Background()
+
+	prefs, err := m.GetUserPreferences(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUserPreferences() unexpected error: %v", err)
+	}
+	if prefs.UserID != 1 || prefs.Language != "" {
+		t.Errorf("GetUserPreferences() for a new user = %+v, want defaults", prefs)
+	}
+
+	saved := UserPreferences{UserID: 1, NotifyCompletion: true, PlaylistNoPull: true, QuietFrom: 22, QuietTo: 8}
+	for _, lang := range []string{"en", "uk"} {
+		saved.Language = lang
+		if err := m.SaveUserPreferences(ctx, saved); err != nil {
+			t.Fatalf("SaveUserPreferences() unexpected error: %v", err)
+		}
+		prefs, err = m.GetUserPreferences(ctx, 1)
+		if err != nil {
+			t.Fatalf("GetUserPreferences() unexpected error: %v", err)
+		}
+		prefs.UpdatedAt = saved.UpdatedAt
+		if *prefs != saved {
+			t.Errorf("GetUserPreferences() = %+v, want %+v", *prefs, saved)
+		}
+	}
+
+	if other, _ := m.GetUserPreferences(ctx, 2); other.Language != "" {
+		t.Errorf("GetUserPreferences() for another user = %+v, want defaults", other)
+	}
+}
+
+func testFindMusicFiles(t *testing.T, open backend) {
+	m, addFiles := open(t)
+	addFiles(
+		models.MusicFile{Artist: "Radiohead", Title: "Airbag"},
+		models.MusicFile{Artist: "Radiohead", Title: "Paranoid Android"},
+		models.MusicFile{Artist: "Portishead", Title: "Roads"},
+	)
+
+	tests := []struct {
+		name     string
+		artists  []string
+		titles   []string
+		expected int
+		wantErr  bool
+	}{
+		{
+			name:     "matches exact pairs",
+			artists:  []string{"Radiohead", "Portishead"},
+			titles:   []string{"Airbag", "Roads"},
+			expected: 2,
+		},
+		{
+			name:     "artist and title must match together",
+			artists:  []string{"Radiohead", "Portishead"},
+			titles:   []string{"Roads", "Airbag"},
+			expected: 0,
+		},
+		{
+			name:     "matching ignores case and punctuation",
+			artists:  []string{"radiohead", "PORTISHEAD"},
+			titles:   []string{"airbag!", "roads"},
+			expected: 2,
+		},
+		{
+			name:     "duplicate pairs return each file once",
+			artists:  []string{"Radiohead", "Radiohead"},
+			titles:   []string{"Airbag", "Airbag"},
+			expected: 1,
+		},
+		{
+			name:     "no pairs",
+			expected: 0,
+		},
+		{
+			name:    "mismatched lengths",
+			artists: []string{"Radiohead"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := m.FindMusicFiles(context.Background(), tt.artists, tt.titles)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("FindMusicFiles() expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindMusicFiles() unexpected error: %v", err)
+			}
+			if len(files) != tt.expected {
+				t.Errorf("FindMusicFiles() returned %d files, want %d", len(files), tt.expected)
+			}
+		})
+	}
+}
+
+func testNotFound(t *testing.T, open backend) {
+	m, _ := open(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"DeactivateRequest", func() error { return m.DeactivateRequest(ctx, "missing") }},
+		{"UpdateDownloadRequest", func() error {
+			return m.UpdateDownloadRequest(ctx, models.DownloadQueueRequest{ID: "missing"})
+		}},
+		{"GetRequestChat", func() error { _, err := m.GetRequestChat(ctx, "missing"); return err }},
+		{"GetDownloadRequest", func() error { _, err := m.GetDownloadRequest(ctx, "missing"); return err }},
+	}
+
+	for _, tt := range tests {
+		if err := tt.call(); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s() error = %v, want %v", tt.name, err, ErrNotFound)
+		}
+	}
+}
+
+func testRequestChat(t *testing.T, open backend) {
+	m, _ := open(t)
+	ctx := context.Background()
+
+	group := Chat{ID: -1001234567890, MessageID: 42}
+	if err := m.NewDownloadRequest(ctx, utils.SourceSpotify, "https://open.spotify.com/album/1", "OK Computer", 1, group, 0, nil, nil); err != nil {
+		t.Fatalf("NewDownloadRequest() unexpected error: %v", err)
+	}
+	if err := m.NewDownloadRequest(ctx, utils.SourceSpotify, "https://open.spotify.com/album/2", "Dummy", 1, Chat{}, 0, nil, nil); err != nil {
+		t.Fatalf("NewDownloadRequest() unexpected error: %v", err)
+	}
+
+	requests, err := m.GetUserRequests(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUserRequests() unexpected error: %v", err)
+	}
+	for _, r := range requests {
+		expected := Chat{}
+		if r.Name == "OK Computer" {
+			expected = group
+		}
+		chat, err := m.GetRequestChat(ctx, r.ID)
+		if err != nil {
+			t.Fatalf("GetRequestChat(%s) unexpected error: %v", r.Name, err)
+		}
+		if chat != expected {
+			t.Errorf("GetRequestChat(%s) = %+v, want %+v", r.Name, chat, expected)
+		}
+	}
+}
+
+func testRequestLifecycle(t *testing.T, open backend) {
+	m, _ := open(t)
+	ctx := context.Background()
+
+	tracks := []spotify.TrackMetadata{{Artist: "Radiohead", Title: "Airbag"}}
+	if err := m.NewDownloadRequest(ctx, utils.SourceSpotify, "https://open.spotify.com/album/1", "OK Computer", 1, Chat{}, 1, tracks, nil); err != nil {
+		t.Fatalf("NewDownloadRequest() unexpected error: %v", err)
+	}
+	if err := m.NewDownloadRequest(ctx, utils.SourceSpotify, "https://open.spotify.com/album/2", "Dummy", 2, Chat{}, 0, nil, nil); err != nil {
+		t.Fatalf("NewDownloadRequest() unexpected error: %v", err)
+	}
+	if err := m.NewPlaylistRequest(ctx, "https://open.spotify.com/playlist/3", 1, Chat{ID: -100, MessageID: 3}, true); err != nil {
+		t.Fatalf("NewPlaylistRequest() unexpected error: %v", err)
+	}
+
+	active, err := m.GetActiveRequests(ctx)
+	if err != nil {
+		t.Fatalf("GetActiveRequests() unexpected error: %v", err)
+	}
+	if len(active) != 2 {
+		t.Fatalf("GetActiveRequests() returned %d requests, want 2", len(active))
+	}
+
+	// Mutating the returned copy must not leak into the store
+	for _, r := range active {
+		if len(r.TrackMetadata) > 0 {
+			r.TrackMetadata[0].Title = "changed"
+		}
+	}
+	active, err = m.GetActiveRequests(ctx)
+	if err != nil {
+		t.Fatalf("GetActiveRequests() unexpected error: %v", err)
+	}
+
+	var first models.DownloadQueueRequest
+	for _, r := range active {
+		if r.CreatorID == 1 {
+			first = r
+		}
+	}
+	first.FoundTrackCount = 1
+	first.Active = false
+	first.UpdatedAt = first.CreatedAt + 60
+	if err := m.UpdateDownloadRequest(ctx, first); err != nil {
+		t.Fatalf("UpdateDownloadRequest() unexpected error: %v", err)
+	}
+
+	stats, err := m.GetStats(ctx)
+	if err != nil {
+		t.Fatalf("GetStats() unexpected error: %v", err)
+	}
+	expected := Stats{TotalMusicFiles: 0, ActiveDownloadQueue: 1, TotalDownloadRequests: 2, ActivePlaylists: 1}
+	if *stats != expected {
+		t.Errorf("GetStats() = %+v, want %+v", *stats, expected)
+	}
+
+	userStats, err := m.GetUserStats(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUserStats() unexpected error: %v", err)
+	}
+	if userStats.TotalRequests != 1 || userStats.CompletedRequests != 1 || userStats.TracksDelivered != 1 || userStats.AvgCompletionSeconds != 60 {
+		t.Errorf("GetUserStats() = %+v", *userStats)
+	}
+
+	detailed, err := m.GetDetailedStats(ctx, StatsOptions{Since: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("GetDetailedStats() unexpected error: %v", err)
+	}
+	if detailed.WindowRequests != 2 || detailed.CompletedRequests != 1 || detailed.CompletionRate != 0.5 || detailed.MedianCompletionSeconds != 60 {
+		t.Errorf("GetDetailedStats() = %+v", *detailed)
+	}
+
+	userRequests, err := m.GetUserRequests(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUserRequests() unexpected error: %v", err)
+	}
+	if len(userRequests) != 1 || userRequests[0].TrackMetadata[0].Title != "Airbag" {
+		t.Errorf("GetUserRequests() = %+v", userRequests)
+	}
+
+	request, err := m.GetDownloadRequest(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("GetDownloadRequest() unexpected error: %v", err)
+	}
+	if request.Name != "OK Computer" || request.FoundTrackCount != 1 || request.TrackMetadata[0].Title != "Airbag" {
+		t.Errorf("GetDownloadRequest() = %+v", *request)
+	}
+}
@@ -2,9 +2,13 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
 	models "github.com/supperdoggy/spot-models"
 	"github.com/supperdoggy/spot-models/spotify"
 	uuid "github.com/satori/go.uuid"
@@ -15,17 +19,31 @@ import (
 )
 
 type Database interface {
-	NewDownloadRequest(ctx context.Context, url, name string, creatorID int64, expectedTrackCount int, trackMetadata []spotify.TrackMetadata) error
+	NewDownloadRequest(ctx context.Context, source, url, name string, creatorID int64, chat Chat, expectedTrackCount int, trackMetadata []spotify.TrackMetadata, selection []int) error
 	GetActiveRequests(ctx context.Context) ([]models.DownloadQueueRequest, error)
+	GetDownloadRequest(ctx context.Context, id string) (*models.DownloadQueueRequest, error)
 	DeactivateRequest(ctx context.Context, id string) error
-	NewPlaylistRequest(ctx context.Context, url string, creatorID int64, noPull bool) error
+	NewPlaylistRequest(ctx context.Context, url string, creatorID int64, chat Chat, noPull bool) error
 	FindMusicFiles(ctx context.Context, artists, titles []string) ([]models.MusicFile, error)
 	UpdateDownloadRequest(ctx context.Context, request models.DownloadQueueRequest) error
 	Close(ctx context.Context) error
 	Ping(ctx context.Context) error
 	GetStats(ctx context.Context) (*Stats, error)
+	GetDetailedStats(ctx context.Context, opts StatsOptions) (*DetailedStats, error)
+	GetUserRequests(ctx context.Context, creatorID int64) ([]models.DownloadQueueRequest, error)
+	GetRequestChat(ctx context.Context, id string) (Chat, error)
+	GetUserStats(ctx context.Context, creatorID int64) (*UserStats, error)
+	GetUserPreferences(ctx context.Context, userID int64) (*UserPreferences, error)
+	SaveUserPreferences(ctx context.Context, prefs UserPreferences) error
+	DumpDownloadRequests(ctx context.Context) ([]DownloadRequestRecord, error)
+	DumpPlaylistRequests(ctx context.Context) ([]PlaylistRequestRecord, error)
+	RestoreDownloadRequests(ctx context.Context, records []DownloadRequestRecord) error
+	RestorePlaylistRequests(ctx context.Context, records []PlaylistRequestRecord) error
 }
 
+// ErrNotFound is wrapped by lookups of a single record that doesn't exist
+var ErrNotFound = errors.New("not found")
+
 type Stats struct {
 	TotalMusicFiles       int64 `json:"total_music_files"`
 	ActiveDownloadQueue   int64 `json:"active_download_queue"`
@@ -33,6 +51,29 @@ type Stats struct {
 	ActivePlaylists       int64 `json:"active_playlists"`
 }
 
+// UserStats holds per-user totals across all download requests a user has made.
+type UserStats struct {
+	CreatorID            int64   `json:"creator_id"`
+	TotalRequests        int64   `json:"total_requests"`
+	ActiveRequests       int64   `json:"active_requests"`
+	CompletedRequests    int64   `json:"completed_requests"`
+	TracksDelivered      int64   `json:"tracks_delivered"`
+	AvgCompletionSeconds float64 `json:"avg_completion_seconds"`
+}
+
+// Chat is the group chat a download or playlist request was made in. The zero Chat
+// is a private chat with the creator.
+type Chat struct {
+	ID int64 `bson:"id" json:"id"`
+	// MessageID is the message the request was made with, replies to it stay in its thread
+	MessageID int `bson:"message_id" json:"message_id"`
+}
+
+// IsGroup tells whether the request was made in a group rather than a private chat
+func (c Chat) IsGroup() bool {
+	return c.ID != 0
+}
+
 type db struct {
 	conn *mongo.Client
 	log  *zap.Logger
@@ -41,9 +82,55 @@ type db struct {
 	downloadQueueRequestCollection *mongo.Collection
 	playlistRequestCollection      *mongo.Collection
 	musicFilesCollection           *mongo.Collection
+	schemaMigrationsCollection     *mongo.Collection
+	usersCollection                *mongo.Collection
 	dbname                         string
 }
 
+// downloadRequestDocument adds the fields this service maintains on top of the shared model
+type downloadRequestDocument struct {
+	models.DownloadQueueRequest `bson:",inline"`
+
+	SpotifyID string `bson:"spotify_id"`
+	Status    string `bson:"status"`
+	// Source tells the downloader which service to fetch from, see package source
+	Source string `bson:"source"`
+	// Chat is only set for requests made in a group
+	Chat *Chat `bson:"chat,omitempty"`
+	// Selection is only set when some tracks of a release were chosen, it holds their
+	// positions in the release counting from 0, so the downloader fetches just those
+	Selection []int `bson:"selection,omitempty"`
+}
+
+type playlistRequestDocument struct {
+	models.PlaylistRequest `bson:",inline"`
+
+	SpotifyID string `bson:"spotify_id"`
+	// Chat is only set for requests made in a group
+	Chat *Chat `bson:"chat,omitempty"`
+}
+
+// Open picks the Database backend from the DATABASE_URL scheme: memory:// for the
+// in-memory store, sqlite://<path> for embedded SQLite, mongodb:// or mongodb+srv:// for MongoDB.
+func Open(ctx context.Context, log *zap.Logger, rawURL, dbname string) (Database, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "memory":
+		log.Warn("Using in-memory database, nothing will be persisted")
+		return NewMemoryDatabase(), nil
+	case "sqlite":
+		return NewSQLiteDatabase(ctx, log, strings.TrimPrefix(rawURL, "sqlite://"))
+	case "mongodb", "mongodb+srv":
+		return NewDatabase(ctx, log, rawURL, dbname)
+	default:
+		return nil, fmt.Errorf("unsupported database scheme %q", u.Scheme)
+	}
+}
+
 func NewDatabase(ctx context.Context, log *zap.Logger, url, dbname string) (Database, error) {
 	conn, err := mongo.Connect(ctx, options.Client().ApplyURI(url))
 	if err != nil {
@@ -55,15 +142,23 @@ func NewDatabase(ctx context.Context, log *zap.Logger, url, dbname string) (Data
 		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
 	}
 
-	return &db{
-		conn: conn,
-		log:  log,
+	d := &db{
+		conn:   conn,
+		log:    log,
 		dbname: dbname,
 
 		downloadQueueRequestCollection: conn.Database(dbname).Collection("download-queue-requests"),
 		playlistRequestCollection:      conn.Database(dbname).Collection("playlist-requests"),
 		musicFilesCollection:           conn.Database(dbname).Collection("music-files"),
-	}, nil
+		schemaMigrationsCollection:     conn.Database(dbname).Collection("schema_migrations"),
+		usersCollection:                conn.Database(dbname).Collection("users"),
+	}
+
+	if err := d.migrate(ctx); err != nil {
+		return nil, err
+	}
+
+	return d, nil
 }
 
 func (d *db) Close(ctx context.Context) error {
@@ -74,7 +169,7 @@ func (d *db) Ping(ctx context.Context) error {
 	return d.conn.Ping(ctx, nil)
 }
 
-func (d *db) NewDownloadRequest(ctx context.Context, url, name string, creatorID int64, expectedTrackCount int, trackMetadata []spotify.TrackMetadata) error {
+func (d *db) NewDownloadRequest(ctx context.Context, source, url, name string, creatorID int64, chat Chat, expectedTrackCount int, trackMetadata []spotify.TrackMetadata, selection []int) error {
 	id := uuid.NewV4()
 	request := models.DownloadQueueRequest{
 		SpotifyURL:          url,
@@ -89,7 +184,19 @@ func (d *db) NewDownloadRequest(ctx context.Context, url, name string, creatorID
 		TrackMetadata:       trackMetadata,
 	}
 
-	_, err := d.downloadQueueRequestCollection.InsertOne(ctx, request)
+	spotifyID, _ := utils.SpotifyID(url)
+	document := downloadRequestDocument{
+		DownloadQueueRequest: request,
+		SpotifyID:            spotifyID,
+		Status:               utils.RequestStatus(request),
+		Source:               source,
+		Selection:            selection,
+	}
+	if chat.IsGroup() {
+		document.Chat = &chat
+	}
+
+	_, err := d.downloadQueueRequestCollection.InsertOne(ctx, document)
 	if err != nil {
 		return fmt.Errorf("failed to insert download request: %w", err)
 	}
@@ -97,7 +204,26 @@ func (d *db) NewDownloadRequest(ctx context.Context, url, name string, creatorID
 	return nil
 }
 
-func (d *db) NewPlaylistRequest(ctx context.Context, url string, creatorID int64, noPull bool) error {
+func (d *db) GetRequestChat(ctx context.Context, id string) (Chat, error) {
+	var document struct {
+		Chat *Chat `bson:"chat"`
+	}
+	err := d.downloadQueueRequestCollection.FindOne(ctx, bson.M{"_id": id},
+		options.FindOne().SetProjection(bson.M{"chat": 1})).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		return Chat{}, fmt.Errorf("request with id %s %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return Chat{}, fmt.Errorf("failed to get request chat: %w", err)
+	}
+
+	if document.Chat == nil {
+		return Chat{}, nil
+	}
+	return *document.Chat, nil
+}
+
+func (d *db) NewPlaylistRequest(ctx context.Context, url string, creatorID int64, chat Chat, noPull bool) error {
 	id := uuid.NewV4()
 	request := models.PlaylistRequest{
 		SpotifyURL: url,
@@ -108,7 +234,16 @@ func (d *db) NewPlaylistRequest(ctx context.Context, url string, creatorID int64
 		NoPull:     noPull,
 	}
 
-	_, err := d.playlistRequestCollection.InsertOne(ctx, request)
+	spotifyID, _ := utils.SpotifyID(url)
+	document := playlistRequestDocument{
+		PlaylistRequest: request,
+		SpotifyID:       spotifyID,
+	}
+	if chat.IsGroup() {
+		document.Chat = &chat
+	}
+
+	_, err := d.playlistRequestCollection.InsertOne(ctx, document)
 	if err != nil {
 		return fmt.Errorf("failed to insert playlist request: %w", err)
 	}
@@ -132,54 +267,70 @@ func (d *db) GetActiveRequests(ctx context.Context) ([]models.DownloadQueueReque
 	return requests, nil
 }
 
+func (d *db) GetDownloadRequest(ctx context.Context, id string) (*models.DownloadQueueRequest, error) {
+	request := &models.DownloadQueueRequest{}
+	err := d.downloadQueueRequestCollection.FindOne(ctx, bson.M{"_id": id}).Decode(request)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("request with id %s %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get download request: %w", err)
+	}
+
+	return request, nil
+}
+
 func (d *db) DeactivateRequest(ctx context.Context, id string) error {
 	result, err := d.downloadQueueRequestCollection.UpdateOne(
 		ctx,
 		bson.M{"_id": id},
-		bson.M{"$set": bson.M{"active": false, "updated_at": time.Now().Unix()}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"active": false, "updated_at": time.Now().Unix()}}},
+			{{Key: "$set", Value: bson.M{"status": statusExpr}}}},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to deactivate request: %w", err)
 	}
 
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("request with id %s not found", id)
+		return fmt.Errorf("request with id %s %w", id, ErrNotFound)
 	}
 
 	return nil
 }
 
+// FindMusicFiles looks files up by their normalized match_key with $in queries of
+// at most lookupChunk keys, instead of one $or clause per track. It only reads, keys
+// are set by the change stream and KeyNewMusicFiles, and refreshed by RefreshMatchKeys.
 func (d *db) FindMusicFiles(ctx context.Context, artists, titles []string) ([]models.MusicFile, error) {
-	if len(artists) != len(titles) {
-		return nil, fmt.Errorf("artists and titles must have the same length")
-	}
-
-	orPairs := make([]bson.M, 0, len(artists))
-	for i := range artists {
-		orPairs = append(orPairs, bson.M{
-			"artist": artists[i],
-			"title":  titles[i],
-		})
-	}
-
-	cur, err := d.musicFilesCollection.Find(ctx, bson.M{
-		"$or": orPairs,
-	}, options.Find().SetProjection(bson.M{"meta_data": 0}))
+	keys, err := matchKeys(artists, titles)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find music files: %w", err)
+		return nil, err
 	}
-	defer cur.Close(ctx)
 
 	files := make([]models.MusicFile, 0)
-	for cur.Next(ctx) {
-		var file models.MusicFile
-		if err := cur.Decode(&file); err != nil {
-			return nil, fmt.Errorf("failed to decode music file: %w", err)
+	for start := 0; start < len(keys); start += lookupChunk {
+		chunk := keys[start:min(start+lookupChunk, len(keys))]
+
+		cur, err := d.musicFilesCollection.Find(ctx, bson.M{
+			"match_key": bson.M{"$in": chunk},
+		}, options.Find().SetProjection(bson.M{"meta_data": 0}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to find music files: %w", err)
+		}
+
+		for cur.Next(ctx) {
+			var file models.MusicFile
+			if err := cur.Decode(&file); err != nil {
+				cur.Close(ctx)
+				return nil, fmt.Errorf("failed to decode music file: %w", err)
+			}
+			files = append(files, file)
+		}
+		err = cur.Err()
+		cur.Close(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cursor error: %w", err)
 		}
-		files = append(files, file)
-	}
-	if err := cur.Err(); err != nil {
-		return nil, fmt.Errorf("cursor error: %w", err)
 	}
 
 	return files, nil
@@ -196,6 +347,7 @@ func (d *db) UpdateDownloadRequest(ctx context.Context, request models.DownloadQ
 			"name":                 request.Name,
 			"active":              request.Active,
 			"updated_at":          request.UpdatedAt,
+			"status":              utils.RequestStatus(request),
 		}},
 	)
 	if err != nil {
@@ -203,7 +355,7 @@ func (d *db) UpdateDownloadRequest(ctx context.Context, request models.DownloadQ
 	}
 
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("request with id %s not found", request.ID)
+		return fmt.Errorf("request with id %s %w", request.ID, ErrNotFound)
 	}
 
 	return nil
@@ -242,3 +394,73 @@ func (d *db) GetStats(ctx context.Context) (*Stats, error) {
 
 	return stats, nil
 }
+
+func (d *db) GetUserRequests(ctx context.Context, creatorID int64) ([]models.DownloadQueueRequest, error) {
+	var requests []models.DownloadQueueRequest
+
+	cursor, err := d.downloadQueueRequestCollection.Find(ctx,
+		bson.M{"creator_id": creatorID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user requests: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &requests); err != nil {
+		return nil, fmt.Errorf("failed to decode requests: %w", err)
+	}
+
+	return requests, nil
+}
+
+func (d *db) GetUserStats(ctx context.Context, creatorID int64) (*UserStats, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"creator_id": creatorID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":              nil,
+			"total":            bson.M{"$sum": 1},
+			"active":           bson.M{"$sum": bson.M{"$cond": bson.A{"$active", 1, 0}}},
+			"completed":        bson.M{"$sum": bson.M{"$cond": bson.A{completedExpr, 1, 0}}},
+			"tracks_delivered": bson.M{"$sum": "$found_track_count"},
+			"completion_time": bson.M{"$sum": bson.M{"$cond": bson.A{
+				completedExpr,
+				bson.M{"$subtract": bson.A{"$updated_at", "$created_at"}},
+				0,
+			}}},
+		}}},
+	}
+
+	cursor, err := d.downloadQueueRequestCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate user stats: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Total           int64 `bson:"total"`
+		Active          int64 `bson:"active"`
+		Completed       int64 `bson:"completed"`
+		TracksDelivered int64 `bson:"tracks_delivered"`
+		CompletionTime  int64 `bson:"completion_time"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("failed to decode user stats: %w", err)
+	}
+
+	stats := &UserStats{CreatorID: creatorID}
+	if len(results) == 0 {
+		return stats, nil
+	}
+
+	r := results[0]
+	stats.TotalRequests = r.Total
+	stats.ActiveRequests = r.Active
+	stats.CompletedRequests = r.Completed
+	stats.TracksDelivered = r.TracksDelivered
+	if r.Completed > 0 {
+		stats.AvgCompletionSeconds = float64(r.CompletionTime) / float64(r.Completed)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+)
+
+// lookupChunk bounds how many match keys go into a single music file query
+const lookupChunk = 500
+
+// matchKeys turns artist/title pairs into their distinct match keys
+func matchKeys(artists, titles []string) ([]string, error) {
+	if len(artists) != len(titles) {
+		return nil, fmt.Errorf("artists and titles must have the same length")
+	}
+
+	seen := make(map[string]bool, len(artists))
+	keys := make([]string, 0, len(artists))
+	for i := range artists {
+		key := utils.MatchKey(artists[i], titles[i])
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MatchKeyRefresher is implemented by backends whose music files are written by the indexer,
+// which doesn't know about match_key. KeyNewMusicFiles keys new files, RefreshMatchKeys also
+// rekeys retagged ones.
+type MatchKeyRefresher interface {
+	KeyNewMusicFiles(ctx context.Context) error
+	RefreshMatchKeys(ctx context.Context) error
+}
+
+// KeyNewMusicFiles sets match_key on music files without one. It only reads the files it
+// writes, found through the match_key index, so it is cheap enough for every periodic pass.
+func (d *db) KeyNewMusicFiles(ctx context.Context) error {
+	return d.backfillMatchKeys(ctx)
+}
+
+// RefreshMatchKeys sets match_key on every music file whose key is missing or no longer matches
+// its artist and title. It scans the whole collection, so only the reconcile subcommand runs it.
+func (d *db) RefreshMatchKeys(ctx context.Context) error {
+	return d.refreshMatchKeys(ctx, bson.M{})
+}
+
+// backfillMatchKeys sets match_key on music files that don't have one yet
+func (d *db) backfillMatchKeys(ctx context.Context) error {
+	return d.refreshMatchKeys(ctx, bson.M{"match_key": nil})
+}
+
+func (d *db) refreshMatchKeys(ctx context.Context, filter bson.M) error {
+	cur, err := d.musicFilesCollection.Find(ctx, filter,
+		options.Find().SetProjection(bson.M{"artist": 1, "title": 1, "match_key": 1}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to find music files to key: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	writes := make([]mongo.WriteModel, 0, lookupChunk)
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		if _, err := d.musicFilesCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			return fmt.Errorf("failed to set match_key: %w", err)
+		}
+		writes = writes[:0]
+		return nil
+	}
+
+	for cur.Next(ctx) {
+		var file struct {
+			ID       interface{} `bson:"_id"`
+			Artist   string      `bson:"artist"`
+			Title    string      `bson:"title"`
+			MatchKey *string     `bson:"match_key"`
+		}
+		if err := cur.Decode(&file); err != nil {
+			return fmt.Errorf("failed to decode music file: %w", err)
+		}
+
+		key := utils.MatchKey(file.Artist, file.Title)
+		if file.MatchKey != nil && *file.MatchKey == key {
+			continue
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": file.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"match_key": key}}))
+		if len(writes) == lookupChunk {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("cursor error: %w", err)
+	}
+
+	return flush()
+}
@@ -0,0 +1,569 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	models "github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+// MemoryDatabase is a concurrency-safe in-memory Database for tests and local runs
+// without MongoDB. Nothing is persisted between restarts.
+type MemoryDatabase struct {
+	mu sync.RWMutex
+
+	downloadRequests []models.DownloadQueueRequest
+	playlistRequests []models.PlaylistRequest
+	musicFiles       []models.MusicFile
+	users            map[int64]UserPreferences
+	// sources holds the source of each download request by ID, the shared model has no field for it
+	sources map[string]string
+	// chats holds the group chat of download requests made in one
+	chats map[string]Chat
+	// playlistChats holds the group chat of playlist requests made in one
+	playlistChats map[string]Chat
+	// selections holds the chosen track positions of download requests made with a selection
+	selections map[string][]int
+	closed     bool
+}
+
+func NewMemoryDatabase() *MemoryDatabase {
+	return &MemoryDatabase{}
+}
+
+// AddMusicFiles seeds the library, standing in for the indexer
+func (m *MemoryDatabase) AddMusicFiles(files ...models.MusicFile) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.musicFiles = append(m.musicFiles, files...)
+}
+
+// Source returns the source a download request was created with
+func (m *MemoryDatabase) Source(id string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.sources[id]
+}
+
+// Selection returns the track positions a download request was made with, nil if it was made for a whole release
+func (m *MemoryDatabase) Selection(id string) []int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.selections[id])
+}
+
+// PlaylistRequests returns a copy of the stored playlist requests
+func (m *MemoryDatabase) PlaylistRequests() []models.PlaylistRequest {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.playlistRequests)
+}
+
+// PlaylistChat returns the group chat a playlist request was made in, the zero Chat for a private one
+func (m *MemoryDatabase) PlaylistChat(id string) Chat {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.playlistChats[id]
+}
+
+func (m *MemoryDatabase) Close(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	return nil
+}
+
+func (m *MemoryDatabase) Ping(ctx context.Context) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return fmt.Errorf("database is closed")
+	}
+	return nil
+}
+
+func (m *MemoryDatabase) NewDownloadRequest(ctx context.Context, source, url, name string, creatorID int64, chat Chat, expectedTrackCount int, trackMetadata []spotify.TrackMetadata, selection []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := uuid.NewV4().String()
+	if m.sources == nil {
+		m.sources = make(map[string]string)
+	}
+	m.sources[id] = source
+	if chat.IsGroup() {
+		if m.chats == nil {
+			m.chats = make(map[string]Chat)
+		}
+		m.chats[id] = chat
+	}
+	if selection != nil {
+		if m.selections == nil {
+			m.selections = make(map[string][]int)
+		}
+		m.selections[id] = slices.Clone(selection)
+	}
+
+	m.downloadRequests = append(m.downloadRequests, models.DownloadQueueRequest{
+		SpotifyURL:         url,
+		Name:               name,
+		Active:             true,
+		ID:                 id,
+		CreatedAt:          time.Now().Unix(),
+		UpdatedAt:          time.Now().Unix(),
+		CreatorID:          creatorID,
+		ExpectedTrackCount: expectedTrackCount,
+		FoundTrackCount:    0,
+		TrackMetadata:      slices.Clone(trackMetadata),
+	})
+
+	return nil
+}
+
+func (m *MemoryDatabase) NewPlaylistRequest(ctx context.Context, url string, creatorID int64, chat Chat, noPull bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := uuid.NewV4().String()
+	m.playlistRequests = append(m.playlistRequests, models.PlaylistRequest{
+		SpotifyURL: url,
+		Active:     true,
+		ID:         id,
+		CreatedAt:  time.Now().Unix(),
+		CreatorID:  creatorID,
+		NoPull:     noPull,
+	})
+	if chat.IsGroup() {
+		if m.playlistChats == nil {
+			m.playlistChats = make(map[string]Chat)
+		}
+		m.playlistChats[id] = chat
+	}
+
+	return nil
+}
+
+func (m *MemoryDatabase) GetActiveRequests(ctx context.Context) ([]models.DownloadQueueRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var requests []models.DownloadQueueRequest
+	for _, r := range m.downloadRequests {
+		if r.Active {
+			requests = append(requests, cloneRequest(r))
+		}
+	}
+
+	return requests, nil
+}
+
+func (m *MemoryDatabase) DeactivateRequest(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexOf(id)
+	if i < 0 {
+		return fmt.Errorf("request with id %s %w", id, ErrNotFound)
+	}
+
+	m.downloadRequests[i].Active = false
+	m.downloadRequests[i].UpdatedAt = time.Now().Unix()
+	return nil
+}
+
+func (m *MemoryDatabase) GetDownloadRequest(ctx context.Context, id string) (*models.DownloadQueueRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.indexOf(id)
+	if i < 0 {
+		return nil, fmt.Errorf("request with id %s %w", id, ErrNotFound)
+	}
+	request := cloneRequest(m.downloadRequests[i])
+	return &request, nil
+}
+
+func (m *MemoryDatabase) GetRequestChat(ctx context.Context, id string) (Chat, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.indexOf(id) < 0 {
+		return Chat{}, fmt.Errorf("request with id %s %w", id, ErrNotFound)
+	}
+	return m.chats[id], nil
+}
+
+// FindMusicFiles matches files whose normalized artist and title equal one of the
+// given pairs, like the match_key lookup of the other backends.
+func (m *MemoryDatabase) FindMusicFiles(ctx context.Context, artists, titles []string) ([]models.MusicFile, error) {
+	keys, err := matchKeys(artists, titles)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		wanted[key] = true
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	files := make([]models.MusicFile, 0)
+	for _, f := range m.musicFiles {
+		if wanted[utils.MatchKey(f.Artist, f.Title)] {
+			files = append(files, f)
+		}
+	}
+
+	return files, nil
+}
+
+func (m *MemoryDatabase) UpdateDownloadRequest(ctx context.Context, request models.DownloadQueueRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexOf(request.ID)
+	if i < 0 {
+		return fmt.Errorf("request with id %s %w", request.ID, ErrNotFound)
+	}
+
+	r := &m.downloadRequests[i]
+	r.ExpectedTrackCount = request.ExpectedTrackCount
+	r.FoundTrackCount = request.FoundTrackCount
+	r.TrackMetadata = slices.Clone(request.TrackMetadata)
+	r.Name = request.Name
+	r.Active = request.Active
+	r.UpdatedAt = request.UpdatedAt
+	return nil
+}
+
+func (m *MemoryDatabase) DumpDownloadRequests(ctx context.Context) ([]DownloadRequestRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	records := make([]DownloadRequestRecord, 0, len(m.downloadRequests))
+	for _, r := range m.downloadRequests {
+		records = append(records, DownloadRequestRecord{
+			DownloadQueueRequest: cloneRequest(r),
+			Source:               m.sources[r.ID],
+			Chat:                 m.chats[r.ID],
+			Selection:            slices.Clone(m.selections[r.ID]),
+		})
+	}
+	slices.SortStableFunc(records, func(a, b DownloadRequestRecord) int {
+		return dumpOrder(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+	})
+
+	return records, nil
+}
+
+func (m *MemoryDatabase) DumpPlaylistRequests(ctx context.Context) ([]PlaylistRequestRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	records := make([]PlaylistRequestRecord, 0, len(m.playlistRequests))
+	for _, r := range m.playlistRequests {
+		records = append(records, PlaylistRequestRecord{PlaylistRequest: r, Chat: m.playlistChats[r.ID]})
+	}
+	slices.SortStableFunc(records, func(a, b PlaylistRequestRecord) int {
+		return dumpOrder(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+	})
+
+	return records, nil
+}
+
+func (m *MemoryDatabase) RestoreDownloadRequests(ctx context.Context, records []DownloadRequestRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, record := range records {
+		if m.sources == nil {
+			m.sources = make(map[string]string)
+		}
+		m.sources[record.ID] = record.Source
+
+		delete(m.chats, record.ID)
+		if record.Chat.IsGroup() {
+			if m.chats == nil {
+				m.chats = make(map[string]Chat)
+			}
+			m.chats[record.ID] = record.Chat
+		}
+
+		delete(m.selections, record.ID)
+		if record.Selection != nil {
+			if m.selections == nil {
+				m.selections = make(map[string][]int)
+			}
+			m.selections[record.ID] = slices.Clone(record.Selection)
+		}
+
+		request := cloneRequest(record.DownloadQueueRequest)
+		if i := m.indexOf(record.ID); i >= 0 {
+			m.downloadRequests[i] = request
+		} else {
+			m.downloadRequests = append(m.downloadRequests, request)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryDatabase) RestorePlaylistRequests(ctx context.Context, records []PlaylistRequestRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, record := range records {
+		delete(m.playlistChats, record.ID)
+		if record.Chat.IsGroup() {
+			if m.playlistChats == nil {
+				m.playlistChats = make(map[string]Chat)
+			}
+			m.playlistChats[record.ID] = record.Chat
+		}
+
+		i := slices.IndexFunc(m.playlistRequests, func(p models.PlaylistRequest) bool { return p.ID == record.ID })
+		if i >= 0 {
+			m.playlistRequests[i] = record.PlaylistRequest
+		} else {
+			m.playlistRequests = append(m.playlistRequests, record.PlaylistRequest)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryDatabase) GetStats(ctx context.Context) (*Stats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := &Stats{
+		TotalMusicFiles:       int64(len(m.musicFiles)),
+		TotalDownloadRequests: int64(len(m.downloadRequests)),
+	}
+	for _, r := range m.downloadRequests {
+		if r.Active {
+			stats.ActiveDownloadQueue++
+		}
+	}
+	for _, p := range m.playlistRequests {
+		if p.Active {
+			stats.ActivePlaylists++
+		}
+	}
+
+	return stats, nil
+}
+
+func (m *MemoryDatabase) GetDetailedStats(ctx context.Context, opts StatsOptions) (*DetailedStats, error) {
+	if opts.Interval == "" {
+		opts.Interval = IntervalDay
+	}
+	if opts.Interval != IntervalDay && opts.Interval != IntervalWeek {
+		return nil, fmt.Errorf("unsupported interval %q", opts.Interval)
+	}
+	if opts.TopN <= 0 {
+		opts.TopN = defaultTopN
+	}
+
+	base, err := m.GetStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := &DetailedStats{
+		Stats:    *base,
+		Since:    opts.Since,
+		Interval: opts.Interval,
+	}
+
+	buckets := make(map[time.Time]int64)
+	requesters := make(map[int64]int64)
+	var durations []int64
+	for _, r := range m.downloadRequests {
+		if r.CreatedAt < opts.Since.Unix() {
+			continue
+		}
+
+		stats.WindowRequests++
+		if r.Errored {
+			stats.ErroredRequests++
+		}
+		if isCompleted(r) {
+			stats.CompletedRequests++
+			durations = append(durations, r.UpdatedAt-r.CreatedAt)
+		}
+		buckets[truncate(time.Unix(r.CreatedAt, 0), opts.Interval)]++
+		requesters[r.CreatorID]++
+	}
+
+	if stats.WindowRequests > 0 {
+		stats.CompletionRate = float64(stats.CompletedRequests) / float64(stats.WindowRequests)
+	}
+	stats.MedianCompletionSeconds = median(durations)
+
+	for start, n := range buckets {
+		stats.RequestsOverTime = append(stats.RequestsOverTime, TimeBucket{Start: start, Requests: n})
+	}
+	sort.Slice(stats.RequestsOverTime, func(i, j int) bool {
+		return stats.RequestsOverTime[i].Start.Before(stats.RequestsOverTime[j].Start)
+	})
+
+	for id, n := range requesters {
+		stats.TopRequesters = append(stats.TopRequesters, Requester{CreatorID: id, Requests: n})
+	}
+	sort.Slice(stats.TopRequesters, func(i, j int) bool {
+		a, b := stats.TopRequesters[i], stats.TopRequesters[j]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.CreatorID < b.CreatorID
+	})
+	if len(stats.TopRequesters) > opts.TopN {
+		stats.TopRequesters = stats.TopRequesters[:opts.TopN]
+	}
+
+	artists := make(map[string]int64)
+	for _, f := range m.musicFiles {
+		if f.Artist != "" {
+			artists[f.Artist]++
+		}
+	}
+	stats.TopArtists = make([]Artist, 0, len(artists))
+	for name, n := range artists {
+		stats.TopArtists = append(stats.TopArtists, Artist{Artist: name, Tracks: n})
+	}
+	sort.Slice(stats.TopArtists, func(i, j int) bool {
+		a, b := stats.TopArtists[i], stats.TopArtists[j]
+		if a.Tracks != b.Tracks {
+			return a.Tracks > b.Tracks
+		}
+		return a.Artist < b.Artist
+	})
+	if len(stats.TopArtists) > opts.TopN {
+		stats.TopArtists = stats.TopArtists[:opts.TopN]
+	}
+
+	return stats, nil
+}
+
+func (m *MemoryDatabase) GetUserRequests(ctx context.Context, creatorID int64) ([]models.DownloadQueueRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var requests []models.DownloadQueueRequest
+	for _, r := range m.downloadRequests {
+		if r.CreatorID == creatorID {
+			requests = append(requests, cloneRequest(r))
+		}
+	}
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].CreatedAt > requests[j].CreatedAt
+	})
+
+	return requests, nil
+}
+
+func (m *MemoryDatabase) GetUserStats(ctx context.Context, creatorID int64) (*UserStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := &UserStats{CreatorID: creatorID}
+	var completionTime int64
+	for _, r := range m.downloadRequests {
+		if r.CreatorID != creatorID {
+			continue
+		}
+
+		stats.TotalRequests++
+		stats.TracksDelivered += int64(r.FoundTrackCount)
+		if r.Active {
+			stats.ActiveRequests++
+		}
+		if isCompleted(r) {
+			stats.CompletedRequests++
+			completionTime += r.UpdatedAt - r.CreatedAt
+		}
+	}
+	if stats.CompletedRequests > 0 {
+		stats.AvgCompletionSeconds = float64(completionTime) / float64(stats.CompletedRequests)
+	}
+
+	return stats, nil
+}
+
+func (m *MemoryDatabase) indexOf(id string) int {
+	return slices.IndexFunc(m.downloadRequests, func(r models.DownloadQueueRequest) bool {
+		return r.ID == id
+	})
+}
+
+// dumpOrder sorts dumps by creation time then ID, like the other backends' dump queries
+func dumpOrder(aCreated int64, aID string, bCreated int64, bID string) int {
+	if c := cmp.Compare(aCreated, bCreated); c != 0 {
+		return c
+	}
+	return strings.Compare(aID, bID)
+}
+
+func cloneRequest(r models.DownloadQueueRequest) models.DownloadQueueRequest {
+	r.TrackMetadata = slices.Clone(r.TrackMetadata)
+	return r
+}
+
+// isCompleted mirrors completedExpr for backends that filter in Go
+func isCompleted(r models.DownloadQueueRequest) bool {
+	return !r.Active && r.ExpectedTrackCount > 0 && r.FoundTrackCount >= r.ExpectedTrackCount
+}
+
+// truncate matches Mongo's $dateTrunc in UTC, where weeks start on Sunday
+func truncate(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if interval == IntervalWeek {
+		return day.AddDate(0, 0, -int(day.Weekday()))
+	}
+	return day
+}
+
+func (d *MemoryDatabase) GetUserPreferences(ctx context.Context, userID int64) (*UserPreferences, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if prefs, ok := d.users[userID]; ok {
+		return &prefs, nil
+	}
+	return &UserPreferences{UserID: userID}, nil
+}
+
+func (d *MemoryDatabase) SaveUserPreferences(ctx context.Context, prefs UserPreferences) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.users == nil {
+		d.users = make(map[int64]UserPreferences)
+	}
+	prefs.UpdatedAt = time.Now()
+	d.users[prefs.UserID] = prefs
+	return nil
+}
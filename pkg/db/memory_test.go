@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	models "github.com/supperdoggy/spot-models"
+)
+
+var _ Database = (*MemoryDatabase)(nil)
+
+func TestMemoryDatabase(t *testing.T) {
+	testConformance(t, func(t *testing.T) (Database, func(files ...models.MusicFile)) {
+		m := NewMemoryDatabase()
+		return m, m.AddMusicFiles
+	})
+}
+
+func TestMemoryDatabase_Concurrent(t *testing.T) {
+	m := NewMemoryDatabase()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			_ = m.NewDownloadRequest(ctx, utils.SourceSpotify, "https://open.spotify.com/album/x", "x", int64(i), Chat{}, 0, nil, nil)
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, _ = m.GetActiveRequests(ctx)
+			_, _ = m.GetStats(ctx)
+		}()
+	}
+	wg.Wait()
+
+	stats, _ := m.GetStats(ctx)
+	if stats.TotalDownloadRequests != 50 {
+		t.Errorf("TotalDownloadRequests = %d, want 50", stats.TotalDownloadRequests)
+	}
+}
@@ -0,0 +1,284 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type mongoMigration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, d *db) error
+}
+
+// mongoMigrations run in order at startup. Append new ones with the next version,
+// never edit or reorder applied ones.
+var mongoMigrations = []mongoMigration{
+	{version: 1, name: "create_indexes", up: createIndexes},
+	{version: 2, name: "backfill_spotify_id", up: backfillSpotifyID},
+	{version: 3, name: "backfill_status", up: backfillStatus},
+	{version: 4, name: "music_files_match_key", up: createMatchKeys},
+	{version: 5, name: "backfill_source", up: backfillSource},
+}
+
+// migrationClaimTimeout is how long migrate waits for another instance applying a migration
+// before giving up, and migrationClaimPoll how often it checks on it
+const (
+	migrationClaimTimeout = 10 * time.Minute
+	migrationClaimPoll    = time.Second
+)
+
+// appliedMigration is a schema_migrations record. It is inserted before its migration runs to
+// claim it, the unique _id keeping other instances from running it too, and AppliedAt is set
+// once the migration succeeds.
+type appliedMigration struct {
+	Version   int    `bson:"_id"`
+	Name      string `bson:"name"`
+	ClaimedAt int64  `bson:"claimed_at,omitempty"`
+	AppliedAt int64  `bson:"applied_at"`
+}
+
+// migrate applies the migrations newer than the last version recorded in schema_migrations
+func (d *db) migrate(ctx context.Context) error {
+	current, err := d.schemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range mongoMigrations {
+		if m.version <= current {
+			continue
+		}
+
+		claimed, err := d.claimMigration(ctx, m)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		start := time.Now()
+		if err := m.up(ctx, d); err != nil {
+			// Release the claim so the next start retries the migration
+			if _, delErr := d.schemaMigrationsCollection.DeleteOne(ctx, bson.M{"_id": m.version}); delErr != nil {
+				d.log.Error("Failed to release migration claim", zap.Error(delErr), zap.Int("version", m.version))
+			}
+			return fmt.Errorf("failed to apply migration %d_%s: %w", m.version, m.name, err)
+		}
+
+		_, err = d.schemaMigrationsCollection.UpdateOne(ctx,
+			bson.M{"_id": m.version},
+			bson.M{"$set": bson.M{"applied_at": time.Now().Unix()}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record migration %d_%s: %w", m.version, m.name, err)
+		}
+
+		d.log.Info("Applied migration",
+			zap.Int("version", m.version),
+			zap.String("name", m.name),
+			zap.Duration("took", time.Since(start)))
+	}
+
+	return nil
+}
+
+// claimMigration records m as running. It reports false once another instance that held the
+// claim has applied m, and takes over the claim if that instance failed and released it.
+func (d *db) claimMigration(ctx context.Context, m mongoMigration) (bool, error) {
+	deadline := time.Now().Add(migrationClaimTimeout)
+	for {
+		_, err := d.schemaMigrationsCollection.InsertOne(ctx, appliedMigration{
+			Version:   m.version,
+			Name:      m.name,
+			ClaimedAt: time.Now().Unix(),
+		})
+		if err == nil {
+			return true, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return false, fmt.Errorf("failed to claim migration %d_%s: %w", m.version, m.name, err)
+		}
+
+		var claim appliedMigration
+		err = d.schemaMigrationsCollection.FindOne(ctx, bson.M{"_id": m.version}).Decode(&claim)
+		switch {
+		case err == mongo.ErrNoDocuments:
+			// Released by a failed attempt, claim it again
+			continue
+		case err != nil:
+			return false, fmt.Errorf("failed to read migration %d_%s: %w", m.version, m.name, err)
+		case claim.AppliedAt != 0:
+			return false, nil
+		case time.Now().After(deadline):
+			return false, fmt.Errorf("migration %d_%s has been claimed by another instance since %s, "+
+				"delete its schema_migrations document if none is running it",
+				m.version, m.name, time.Unix(claim.ClaimedAt, 0).UTC().Format(time.DateTime))
+		}
+
+		d.log.Info("Waiting for another instance to apply migration",
+			zap.Int("version", m.version), zap.String("name", m.name))
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(migrationClaimPoll):
+		}
+	}
+}
+
+// schemaVersion is the newest applied migration, claims still running don't count
+func (d *db) schemaVersion(ctx context.Context) (int, error) {
+	var last appliedMigration
+	err := d.schemaMigrationsCollection.FindOne(ctx, bson.M{"applied_at": bson.M{"$gt": 0}},
+		options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}}),
+	).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	return last.Version, nil
+}
+
+func createIndexes(ctx context.Context, d *db) error {
+	indexes := map[*mongo.Collection][]mongo.IndexModel{
+		d.downloadQueueRequestCollection: {
+			{Keys: bson.D{{Key: "active", Value: 1}}},
+			{Keys: bson.D{{Key: "creator_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+		d.playlistRequestCollection: {
+			{Keys: bson.D{{Key: "active", Value: 1}}},
+			{Keys: bson.D{{Key: "creator_id", Value: 1}}},
+		},
+		d.musicFilesCollection: {
+			{Keys: bson.D{{Key: "artist", Value: 1}, {Key: "title", Value: 1}}},
+		},
+	}
+
+	for collection, models := range indexes {
+		if _, err := collection.Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("failed to create indexes on %s: %w", collection.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// backfillSpotifyID stores the canonical spotify:<kind>:<id> URI next to the raw link,
+// so the same album shared with different ?si= tokens can be matched.
+func backfillSpotifyID(ctx context.Context, d *db) error {
+	for _, collection := range []*mongo.Collection{d.downloadQueueRequestCollection, d.playlistRequestCollection} {
+		cursor, err := collection.Find(ctx,
+			bson.M{"spotify_id": bson.M{"$exists": false}},
+			options.Find().SetProjection(bson.M{"spotify_url": 1}),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to find %s without spotify_id: %w", collection.Name(), err)
+		}
+
+		var writes []mongo.WriteModel
+		for cursor.Next(ctx) {
+			var doc struct {
+				ID         string `bson:"_id"`
+				SpotifyURL string `bson:"spotify_url"`
+			}
+			if err := cursor.Decode(&doc); err != nil {
+				cursor.Close(ctx)
+				return fmt.Errorf("failed to decode %s: %w", collection.Name(), err)
+			}
+
+			id, _ := utils.SpotifyID(doc.SpotifyURL)
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": doc.ID}).
+				SetUpdate(bson.M{"$set": bson.M{"spotify_id": id}}))
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return fmt.Errorf("cursor error: %w", err)
+		}
+
+		if len(writes) == 0 {
+			continue
+		}
+		if _, err := collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			return fmt.Errorf("failed to backfill spotify_id on %s: %w", collection.Name(), err)
+		}
+	}
+
+	return d.createSpotifyIDIndexes(ctx)
+}
+
+func (d *db) createSpotifyIDIndexes(ctx context.Context) error {
+	for _, collection := range []*mongo.Collection{d.downloadQueueRequestCollection, d.playlistRequestCollection} {
+		if _, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "spotify_id", Value: 1}},
+		}); err != nil {
+			return fmt.Errorf("failed to create spotify_id index on %s: %w", collection.Name(), err)
+		}
+	}
+	return nil
+}
+
+// statusExpr derives utils.RequestStatus inside an update pipeline
+var statusExpr = bson.M{"$switch": bson.M{
+	"branches": bson.A{
+		bson.M{"case": bson.M{"$and": bson.A{"$active", "$errored"}}, "then": utils.StatusErrored},
+		bson.M{"case": "$active", "then": utils.StatusActive},
+		bson.M{"case": completedExpr, "then": utils.StatusCompleted},
+	},
+	"default": utils.StatusDeactivated,
+}}
+
+func backfillStatus(ctx context.Context, d *db) error {
+	_, err := d.downloadQueueRequestCollection.UpdateMany(ctx,
+		bson.M{"status": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"status": statusExpr}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to backfill status: %w", err)
+	}
+
+	_, err = d.downloadQueueRequestCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create status index: %w", err)
+	}
+
+	return nil
+}
+
+func createMatchKeys(ctx context.Context, d *db) error {
+	_, err := d.musicFilesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "match_key", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create match_key index: %w", err)
+	}
+
+	return d.backfillMatchKeys(ctx)
+}
+
+// backfillSource marks requests made before other sources existed as Spotify ones
+func backfillSource(ctx context.Context, d *db) error {
+	_, err := d.downloadQueueRequestCollection.UpdateMany(ctx,
+		bson.M{"source": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"source": utils.SourceSpotify}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to backfill source: %w", err)
+	}
+
+	return nil
+}
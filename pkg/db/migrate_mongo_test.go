@@ -0,0 +1,19 @@
+package db
+
+import "testing"
+
+func TestMongoMigrationsOrdered(t *testing.T) {
+	seen := make(map[string]bool)
+	for i, m := range mongoMigrations {
+		if m.version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", m.name, m.version, i+1)
+		}
+		if seen[m.name] {
+			t.Errorf("migration name %s is used twice", m.name)
+		}
+		seen[m.name] = true
+		if m.up == nil {
+			t.Errorf("migration %s has no up function", m.name)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+CREATE TABLE download_requests (
+    id                   TEXT PRIMARY KEY,
+    spotify_url          TEXT    NOT NULL,
+    name                 TEXT    NOT NULL DEFAULT '',
+    active               INTEGER NOT NULL DEFAULT 1,
+    errored              INTEGER NOT NULL DEFAULT 0,
+    retry_count          INTEGER NOT NULL DEFAULT 0,
+    created_at           INTEGER NOT NULL,
+    updated_at           INTEGER NOT NULL,
+    creator_id           INTEGER NOT NULL,
+    expected_track_count INTEGER NOT NULL DEFAULT 0,
+    found_track_count    INTEGER NOT NULL DEFAULT 0,
+    track_metadata       TEXT    NOT NULL DEFAULT 'null'
+);
+
+CREATE INDEX idx_download_requests_active ON download_requests (active);
+CREATE INDEX idx_download_requests_creator ON download_requests (creator_id, created_at);
+
+CREATE TABLE playlist_requests (
+    id          TEXT PRIMARY KEY,
+    spotify_url TEXT    NOT NULL,
+    active      INTEGER NOT NULL DEFAULT 1,
+    created_at  INTEGER NOT NULL,
+    creator_id  INTEGER NOT NULL,
+    no_pull     INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_playlist_requests_active ON playlist_requests (active);
+
+-- music_files is owned by the indexer, so the full document is kept as JSON
+-- and only the columns we query on are broken out
+CREATE TABLE music_files (
+    id       INTEGER PRIMARY KEY AUTOINCREMENT,
+    artist   TEXT NOT NULL,
+    title    TEXT NOT NULL,
+    document TEXT NOT NULL
+);
+
+CREATE INDEX idx_music_files_artist_title ON music_files (artist, title);
@@ -0,0 +1,5 @@
+-- match_key holds utils.MatchKey(artist, title); rows added before this
+-- migration are keyed in Go right after migrating
+ALTER TABLE music_files ADD COLUMN match_key TEXT;
+
+CREATE INDEX idx_music_files_match_key ON music_files (match_key);
@@ -0,0 +1,5 @@
+-- Per-user preferences, stored as the JSON encoding of UserPreferences
+CREATE TABLE users (
+	user_id  INTEGER PRIMARY KEY,
+	document TEXT NOT NULL
+);
@@ -0,0 +1,2 @@
+-- Requests made before other sources existed all came from Spotify
+ALTER TABLE download_requests ADD COLUMN source TEXT NOT NULL DEFAULT 'spotify';
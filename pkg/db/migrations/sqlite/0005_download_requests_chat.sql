@@ -0,0 +1,3 @@
+-- Requests made in a group remember it, 0 means a private chat with the creator
+ALTER TABLE download_requests ADD COLUMN chat_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE download_requests ADD COLUMN chat_message_id INTEGER NOT NULL DEFAULT 0;
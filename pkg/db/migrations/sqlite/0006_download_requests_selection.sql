@@ -0,0 +1,2 @@
+-- JSON array of the chosen track positions, NULL for requests of a whole release
+ALTER TABLE download_requests ADD COLUMN selection TEXT;
@@ -0,0 +1,3 @@
+-- Playlist requests made in a group remember it like download requests, 0 means a private chat
+ALTER TABLE playlist_requests ADD COLUMN chat_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE playlist_requests ADD COLUMN chat_message_id INTEGER NOT NULL DEFAULT 0;
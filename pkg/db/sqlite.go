@@ -0,0 +1,652 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	models "github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite"
+)
+
+const requestColumns = `id, spotify_url, name, active, errored, retry_count, created_at, updated_at,
+	creator_id, expected_track_count, found_track_count, track_metadata`
+
+// sqlitePragmas are applied to every connection unless the path sets the same pragma
+var sqlitePragmas = []string{"busy_timeout(5000)", "journal_mode(WAL)"}
+
+type sqliteDB struct {
+	conn *sql.DB
+	log  *zap.Logger
+}
+
+// NewSQLiteDatabase opens (creating if needed) the SQLite database at path and migrates it.
+// path may carry its own query, such as ?_pragma=foreign_keys(1).
+func NewSQLiteDatabase(ctx context.Context, log *zap.Logger, path string) (Database, error) {
+	dsn, err := sqliteDSN(path)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite: %w", err)
+	}
+	// A single connection serializes writers and keeps :memory: databases shared
+	conn.SetMaxOpenConns(1)
+
+	if err := conn.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ping SQLite: %w", err)
+	}
+
+	if err := migrateSQLite(ctx, log, conn); err != nil {
+		return nil, err
+	}
+
+	d := &sqliteDB{conn: conn, log: log}
+	if err := d.backfillMatchKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// sqliteDSN merges sqlitePragmas into the query of path
+func sqliteDSN(path string) (string, error) {
+	path, rawQuery, _ := strings.Cut(path, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", fmt.Errorf("invalid SQLite query %q: %w", rawQuery, err)
+	}
+
+	set := map[string]bool{}
+	for _, pragma := range query["_pragma"] {
+		name, _, _ := strings.Cut(pragma, "(")
+		set[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	for _, pragma := range sqlitePragmas {
+		if name, _, _ := strings.Cut(pragma, "("); !set[name] {
+			query.Add("_pragma", pragma)
+		}
+	}
+	return path + "?" + query.Encode(), nil
+}
+
+func (d *sqliteDB) Close(ctx context.Context) error {
+	return d.conn.Close()
+}
+
+func (d *sqliteDB) Ping(ctx context.Context) error {
+	return d.conn.PingContext(ctx)
+}
+
+func (d *sqliteDB) NewDownloadRequest(ctx context.Context, source, url, name string, creatorID int64, chat Chat, expectedTrackCount int, trackMetadata []spotify.TrackMetadata, selection []int) error {
+	tracks, err := json.Marshal(trackMetadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode track metadata: %w", err)
+	}
+
+	// Whole releases have no selection, stored as NULL
+	var chosen sql.NullString
+	if selection != nil {
+		encoded, err := json.Marshal(selection)
+		if err != nil {
+			return fmt.Errorf("failed to encode selection: %w", err)
+		}
+		chosen = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	now := time.Now().Unix()
+	_, err = d.conn.ExecContext(ctx, `INSERT INTO download_requests
+		(id, source, spotify_url, name, active, created_at, updated_at, creator_id, chat_id, chat_message_id,
+		 expected_track_count, found_track_count, track_metadata, selection)
+		VALUES (?, ?, ?, ?, 1, ?, ?, ?, ?, ?, ?, 0, ?, ?)`,
+		uuid.NewV4().String(), source, url, name, now, now, creatorID, chat.ID, chat.MessageID,
+		expectedTrackCount, string(tracks), chosen)
+	if err != nil {
+		return fmt.Errorf("failed to insert download request: %w", err)
+	}
+
+	return nil
+}
+
+func (d *sqliteDB) GetRequestChat(ctx context.Context, id string) (Chat, error) {
+	var chat Chat
+	err := d.conn.QueryRowContext(ctx, `SELECT chat_id, chat_message_id FROM download_requests WHERE id = ?`, id).
+		Scan(&chat.ID, &chat.MessageID)
+	if err == sql.ErrNoRows {
+		return Chat{}, fmt.Errorf("request with id %s %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return Chat{}, fmt.Errorf("failed to get request chat: %w", err)
+	}
+
+	return chat, nil
+}
+
+func (d *sqliteDB) NewPlaylistRequest(ctx context.Context, url string, creatorID int64, chat Chat, noPull bool) error {
+	_, err := d.conn.ExecContext(ctx, `INSERT INTO playlist_requests
+		(id, spotify_url, active, created_at, creator_id, chat_id, chat_message_id, no_pull) VALUES (?, ?, 1, ?, ?, ?, ?, ?)`,
+		uuid.NewV4().String(), url, time.Now().Unix(), creatorID, chat.ID, chat.MessageID, noPull)
+	if err != nil {
+		return fmt.Errorf("failed to insert playlist request: %w", err)
+	}
+
+	return nil
+}
+
+func (d *sqliteDB) GetActiveRequests(ctx context.Context) ([]models.DownloadQueueRequest, error) {
+	requests, err := d.queryRequests(ctx, `SELECT `+requestColumns+` FROM download_requests WHERE active = 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find active requests: %w", err)
+	}
+	return requests, nil
+}
+
+func (d *sqliteDB) GetDownloadRequest(ctx context.Context, id string) (*models.DownloadQueueRequest, error) {
+	requests, err := d.queryRequests(ctx, `SELECT `+requestColumns+` FROM download_requests WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get download request: %w", err)
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("request with id %s %w", id, ErrNotFound)
+	}
+	return &requests[0], nil
+}
+
+func (d *sqliteDB) GetUserRequests(ctx context.Context, creatorID int64) ([]models.DownloadQueueRequest, error) {
+	requests, err := d.queryRequests(ctx, `SELECT `+requestColumns+` FROM download_requests
+		WHERE creator_id = ? ORDER BY created_at DESC`, creatorID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user requests: %w", err)
+	}
+	return requests, nil
+}
+
+func (d *sqliteDB) DeactivateRequest(ctx context.Context, id string) error {
+	result, err := d.conn.ExecContext(ctx, `UPDATE download_requests SET active = 0, updated_at = ? WHERE id = ?`,
+		time.Now().Unix(), id)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate request: %w", err)
+	}
+
+	return notFoundIfUnmatched(result, id)
+}
+
+func (d *sqliteDB) UpdateDownloadRequest(ctx context.Context, request models.DownloadQueueRequest) error {
+	tracks, err := json.Marshal(request.TrackMetadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode track metadata: %w", err)
+	}
+
+	result, err := d.conn.ExecContext(ctx, `UPDATE download_requests SET
+		expected_track_count = ?, found_track_count = ?, track_metadata = ?, name = ?, active = ?, updated_at = ?
+		WHERE id = ?`,
+		request.ExpectedTrackCount, request.FoundTrackCount, string(tracks), request.Name, request.Active,
+		request.UpdatedAt, request.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update download request: %w", err)
+	}
+
+	return notFoundIfUnmatched(result, request.ID)
+}
+
+func (d *sqliteDB) DumpDownloadRequests(ctx context.Context) ([]DownloadRequestRecord, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT `+requestColumns+`, source, chat_id, chat_message_id, selection
+		FROM download_requests ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find download requests: %w", err)
+	}
+	defer rows.Close()
+
+	records := make([]DownloadRequestRecord, 0)
+	for rows.Next() {
+		var record DownloadRequestRecord
+		var tracks string
+		var selection sql.NullString
+		r := &record.DownloadQueueRequest
+		if err := rows.Scan(&r.ID, &r.SpotifyURL, &r.Name, &r.Active, &r.Errored, &r.RetryCount, &r.CreatedAt,
+			&r.UpdatedAt, &r.CreatorID, &r.ExpectedTrackCount, &r.FoundTrackCount, &tracks,
+			&record.Source, &record.Chat.ID, &record.Chat.MessageID, &selection); err != nil {
+			return nil, fmt.Errorf("failed to scan download request: %w", err)
+		}
+		if err := json.Unmarshal([]byte(tracks), &r.TrackMetadata); err != nil {
+			return nil, fmt.Errorf("failed to decode track metadata: %w", err)
+		}
+		if selection.Valid {
+			if err := json.Unmarshal([]byte(selection.String), &record.Selection); err != nil {
+				return nil, fmt.Errorf("failed to decode selection: %w", err)
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+func (d *sqliteDB) DumpPlaylistRequests(ctx context.Context) ([]PlaylistRequestRecord, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT id, spotify_url, active, created_at, creator_id, chat_id, chat_message_id, no_pull
+		FROM playlist_requests ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find playlist requests: %w", err)
+	}
+	defer rows.Close()
+
+	records := make([]PlaylistRequestRecord, 0)
+	for rows.Next() {
+		var r PlaylistRequestRecord
+		if err := rows.Scan(&r.ID, &r.SpotifyURL, &r.Active, &r.CreatedAt, &r.CreatorID,
+			&r.Chat.ID, &r.Chat.MessageID, &r.NoPull); err != nil {
+			return nil, fmt.Errorf("failed to scan playlist request: %w", err)
+		}
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
+
+// RestoreDownloadRequests replaces the requests with the records' IDs, inserting those that are
+// missing, all in one transaction
+func (d *sqliteDB) RestoreDownloadRequests(ctx context.Context, records []DownloadRequestRecord) error {
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, record := range records {
+		r := record.DownloadQueueRequest
+		tracks, err := json.Marshal(r.TrackMetadata)
+		if err != nil {
+			return fmt.Errorf("failed to encode track metadata: %w", err)
+		}
+		var chosen sql.NullString
+		if record.Selection != nil {
+			encoded, err := json.Marshal(record.Selection)
+			if err != nil {
+				return fmt.Errorf("failed to encode selection: %w", err)
+			}
+			chosen = sql.NullString{String: string(encoded), Valid: true}
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO download_requests
+			(id, source, spotify_url, name, active, errored, retry_count, created_at, updated_at, creator_id,
+			 chat_id, chat_message_id, expected_track_count, found_track_count, track_metadata, selection)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.ID, record.Source, r.SpotifyURL, r.Name, r.Active, r.Errored, r.RetryCount, r.CreatedAt, r.UpdatedAt,
+			r.CreatorID, record.Chat.ID, record.Chat.MessageID, r.ExpectedTrackCount, r.FoundTrackCount,
+			string(tracks), chosen)
+		if err != nil {
+			return fmt.Errorf("failed to restore download request %s: %w", r.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit download requests: %w", err)
+	}
+	return nil
+}
+
+// RestorePlaylistRequests replaces the requests with the same IDs, inserting those that are
+// missing, all in one transaction
+func (d *sqliteDB) RestorePlaylistRequests(ctx context.Context, records []PlaylistRequestRecord) error {
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, r := range records {
+		_, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO playlist_requests
+			(id, spotify_url, active, created_at, creator_id, chat_id, chat_message_id, no_pull) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.ID, r.SpotifyURL, r.Active, r.CreatedAt, r.CreatorID, r.Chat.ID, r.Chat.MessageID, r.NoPull)
+		if err != nil {
+			return fmt.Errorf("failed to restore playlist request %s: %w", r.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit playlist requests: %w", err)
+	}
+	return nil
+}
+
+func (d *sqliteDB) FindMusicFiles(ctx context.Context, artists, titles []string) ([]models.MusicFile, error) {
+	keys, err := matchKeys(artists, titles)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]models.MusicFile, 0)
+	for start := 0; start < len(keys); start += lookupChunk {
+		chunk := keys[start:min(start+lookupChunk, len(keys))]
+
+		args := make([]any, 0, len(chunk))
+		for _, key := range chunk {
+			args = append(args, key)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", ")
+
+		rows, err := d.conn.QueryContext(ctx, `SELECT document FROM music_files
+			WHERE match_key IN (`+placeholders+`)`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find music files: %w", err)
+		}
+
+		for rows.Next() {
+			var doc string
+			var file models.MusicFile
+			if err := rows.Scan(&doc); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan music file: %w", err)
+			}
+			if err := json.Unmarshal([]byte(doc), &file); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to decode music file: %w", err)
+			}
+			files = append(files, file)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cursor error: %w", err)
+		}
+	}
+
+	return files, nil
+}
+
+// backfillMatchKeys keys rows that predate the match_key column
+func (d *sqliteDB) backfillMatchKeys(ctx context.Context) error {
+	rows, err := d.conn.QueryContext(ctx, `SELECT id, artist, title FROM music_files WHERE match_key IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to find music files without match_key: %w", err)
+	}
+
+	keys := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var artist, title string
+		if err := rows.Scan(&id, &artist, &title); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan music file: %w", err)
+		}
+		keys[id] = utils.MatchKey(artist, title)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("cursor error: %w", err)
+	}
+
+	for id, key := range keys {
+		if _, err := d.conn.ExecContext(ctx, `UPDATE music_files SET match_key = ? WHERE id = ?`, key, id); err != nil {
+			return fmt.Errorf("failed to backfill match_key: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// AddMusicFiles stores indexed files, standing in for the indexer that fills Mongo
+func (d *sqliteDB) AddMusicFiles(ctx context.Context, files ...models.MusicFile) error {
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, f := range files {
+		doc, err := json.Marshal(f)
+		if err != nil {
+			return fmt.Errorf("failed to encode music file: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO music_files (artist, title, match_key, document) VALUES (?, ?, ?, ?)`,
+			f.Artist, f.Title, utils.MatchKey(f.Artist, f.Title), string(doc)); err != nil {
+			return fmt.Errorf("failed to insert music file: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (d *sqliteDB) GetStats(ctx context.Context) (*Stats, error) {
+	stats := &Stats{}
+	err := d.conn.QueryRowContext(ctx, `SELECT
+		(SELECT COUNT(*) FROM music_files),
+		(SELECT COUNT(*) FROM download_requests WHERE active = 1),
+		(SELECT COUNT(*) FROM download_requests),
+		(SELECT COUNT(*) FROM playlist_requests WHERE active = 1)`).Scan(
+		&stats.TotalMusicFiles, &stats.ActiveDownloadQueue, &stats.TotalDownloadRequests, &stats.ActivePlaylists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// sqliteCompleted mirrors completedExpr
+const sqliteCompleted = `(active = 0 AND expected_track_count > 0 AND found_track_count >= expected_track_count)`
+
+func (d *sqliteDB) GetUserStats(ctx context.Context, creatorID int64) (*UserStats, error) {
+	stats := &UserStats{CreatorID: creatorID}
+
+	var avg sql.NullFloat64
+	err := d.conn.QueryRowContext(ctx, `SELECT
+		COUNT(*),
+		COALESCE(SUM(active), 0),
+		COALESCE(SUM(`+sqliteCompleted+`), 0),
+		COALESCE(SUM(found_track_count), 0),
+		AVG(CASE WHEN `+sqliteCompleted+` THEN updated_at - created_at END)
+		FROM download_requests WHERE creator_id = ?`, creatorID).Scan(
+		&stats.TotalRequests, &stats.ActiveRequests, &stats.CompletedRequests, &stats.TracksDelivered, &avg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate user stats: %w", err)
+	}
+	stats.AvgCompletionSeconds = avg.Float64
+
+	return stats, nil
+}
+
+func (d *sqliteDB) GetDetailedStats(ctx context.Context, opts StatsOptions) (*DetailedStats, error) {
+	if opts.Interval == "" {
+		opts.Interval = IntervalDay
+	}
+	if opts.TopN <= 0 {
+		opts.TopN = defaultTopN
+	}
+
+	// Weeks start on Sunday, like Mongo's $dateTrunc
+	var bucket string
+	switch opts.Interval {
+	case IntervalDay:
+		bucket = `date(created_at, 'unixepoch')`
+	case IntervalWeek:
+		bucket = `date(created_at, 'unixepoch', '-6 days', 'weekday 0')`
+	default:
+		return nil, fmt.Errorf("unsupported interval %q", opts.Interval)
+	}
+
+	base, err := d.GetStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &DetailedStats{
+		Stats:    *base,
+		Since:    opts.Since,
+		Interval: opts.Interval,
+	}
+	since := opts.Since.Unix()
+
+	err = d.conn.QueryRowContext(ctx, `SELECT
+		COUNT(*),
+		COALESCE(SUM(`+sqliteCompleted+`), 0),
+		COALESCE(SUM(errored), 0)
+		FROM download_requests WHERE created_at >= ?`, since).Scan(
+		&stats.WindowRequests, &stats.CompletedRequests, &stats.ErroredRequests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate request stats: %w", err)
+	}
+	if stats.WindowRequests > 0 {
+		stats.CompletionRate = float64(stats.CompletedRequests) / float64(stats.WindowRequests)
+	}
+
+	rows, err := d.conn.QueryContext(ctx, `SELECT `+bucket+` AS bucket, COUNT(*) FROM download_requests
+		WHERE created_at >= ? GROUP BY bucket ORDER BY bucket`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate request timeline: %w", err)
+	}
+	for rows.Next() {
+		var day string
+		var b TimeBucket
+		if err := rows.Scan(&day, &b.Requests); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan request timeline: %w", err)
+		}
+		if b.Start, err = time.Parse(time.DateOnly, day); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to parse timeline bucket: %w", err)
+		}
+		stats.RequestsOverTime = append(stats.RequestsOverTime, b)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	rows, err = d.conn.QueryContext(ctx, `SELECT creator_id, COUNT(*) AS requests FROM download_requests
+		WHERE created_at >= ? GROUP BY creator_id ORDER BY requests DESC, creator_id LIMIT ?`, since, opts.TopN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate top requesters: %w", err)
+	}
+	for rows.Next() {
+		var r Requester
+		if err := rows.Scan(&r.CreatorID, &r.Requests); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan top requesters: %w", err)
+		}
+		stats.TopRequesters = append(stats.TopRequesters, r)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	rows, err = d.conn.QueryContext(ctx, `SELECT updated_at - created_at FROM download_requests
+		WHERE created_at >= ? AND `+sqliteCompleted, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate completion times: %w", err)
+	}
+	var durations []int64
+	for rows.Next() {
+		var duration int64
+		if err := rows.Scan(&duration); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan completion times: %w", err)
+		}
+		durations = append(durations, duration)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+	stats.MedianCompletionSeconds = median(durations)
+
+	rows, err = d.conn.QueryContext(ctx, `SELECT artist, COUNT(*) AS tracks FROM music_files
+		WHERE artist != '' GROUP BY artist ORDER BY tracks DESC, artist LIMIT ?`, opts.TopN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate top artists: %w", err)
+	}
+	defer rows.Close()
+	stats.TopArtists = make([]Artist, 0, opts.TopN)
+	for rows.Next() {
+		var a Artist
+		if err := rows.Scan(&a.Artist, &a.Tracks); err != nil {
+			return nil, fmt.Errorf("failed to scan top artists: %w", err)
+		}
+		stats.TopArtists = append(stats.TopArtists, a)
+	}
+
+	return stats, rows.Err()
+}
+
+func (d *sqliteDB) queryRequests(ctx context.Context, query string, args ...any) ([]models.DownloadQueueRequest, error) {
+	rows, err := d.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []models.DownloadQueueRequest
+	for rows.Next() {
+		var r models.DownloadQueueRequest
+		var tracks string
+		if err := rows.Scan(&r.ID, &r.SpotifyURL, &r.Name, &r.Active, &r.Errored, &r.RetryCount, &r.CreatedAt,
+			&r.UpdatedAt, &r.CreatorID, &r.ExpectedTrackCount, &r.FoundTrackCount, &tracks); err != nil {
+			return nil, fmt.Errorf("failed to scan request: %w", err)
+		}
+		if err := json.Unmarshal([]byte(tracks), &r.TrackMetadata); err != nil {
+			return nil, fmt.Errorf("failed to decode track metadata: %w", err)
+		}
+		requests = append(requests, r)
+	}
+
+	return requests, rows.Err()
+}
+
+func notFoundIfUnmatched(result sql.Result, id string) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("request with id %s %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+func (d *sqliteDB) GetUserPreferences(ctx context.Context, userID int64) (*UserPreferences, error) {
+	var document string
+	err := d.conn.QueryRowContext(ctx, `SELECT document FROM users WHERE user_id = ?`, userID).Scan(&document)
+	if err == sql.ErrNoRows {
+		return &UserPreferences{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user preferences: %w", err)
+	}
+
+	prefs := &UserPreferences{}
+	if err := json.Unmarshal([]byte(document), prefs); err != nil {
+		return nil, fmt.Errorf("failed to decode user preferences: %w", err)
+	}
+	prefs.UserID = userID
+
+	return prefs, nil
+}
+
+func (d *sqliteDB) SaveUserPreferences(ctx context.Context, prefs UserPreferences) error {
+	prefs.UpdatedAt = time.Now()
+	document, err := json.Marshal(prefs)
+	if err != nil {
+		return fmt.Errorf("failed to encode user preferences: %w", err)
+	}
+
+	_, err = d.conn.ExecContext(ctx, `INSERT INTO users (user_id, document) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET document = excluded.document`, prefs.UserID, string(document))
+	if err != nil {
+		return fmt.Errorf("failed to save user preferences: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	models "github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+	"go.uber.org/zap"
+)
+
+func openSQLite(t *testing.T, path string) *sqliteDB {
+	t.Helper()
+
+	d, err := NewSQLiteDatabase(context.Background(), zap.NewNop(), path)
+	if err != nil {
+		t.Fatalf("NewSQLiteDatabase() unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = d.Close(context.Background()) })
+
+	return d.(*sqliteDB)
+}
+
+func TestSQLiteDatabase(t *testing.T) {
+	testConformance(t, func(t *testing.T) (Database, func(files ...models.MusicFile)) {
+		d := openSQLite(t, ":memory:")
+		return d, func(files ...models.MusicFile) {
+			if err := d.AddMusicFiles(context.Background(), files...); err != nil {
+				t.Fatalf("AddMusicFiles() unexpected error: %v", err)
+			}
+		}
+	})
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{
+			name: "plain path",
+			path: "/data/queue.db",
+			want: "/data/queue.db?_pragma=busy_timeout%285000%29&_pragma=journal_mode%28WAL%29",
+		},
+		{
+			name: "path with its own pragma",
+			path: "/q.db?_pragma=foreign_keys(1)",
+			want: "/q.db?_pragma=foreign_keys%281%29&_pragma=busy_timeout%285000%29&_pragma=journal_mode%28WAL%29",
+		},
+		{
+			name: "path overriding a default",
+			path: "/q.db?_pragma=journal_mode(DELETE)&_txlock=immediate",
+			want: "/q.db?_pragma=journal_mode%28DELETE%29&_pragma=busy_timeout%285000%29&_txlock=immediate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sqliteDSN(tt.path)
+			if err != nil {
+				t.Fatalf("sqliteDSN() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("sqliteDSN() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteDatabase_MigrationsAreIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+
+	first := openSQLite(t, path)
+	if err := first.NewPlaylistRequest(context.Background(), "https://open.spotify.com/playlist/1", 1, Chat{}, false); err != nil {
+		t.Fatalf("NewPlaylistRequest() unexpected error: %v", err)
+	}
+	_ = first.Close(context.Background())
+
+	second := openSQLite(t, path)
+	var versions int
+	if err := second.conn.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&versions); err != nil {
+		t.Fatalf("failed to read schema_migrations: %v", err)
+	}
+	migrations, err := loadSQLiteMigrations()
+	if err != nil {
+		t.Fatalf("loadSQLiteMigrations() unexpected error: %v", err)
+	}
+	if versions != len(migrations) {
+		t.Errorf("schema_migrations has %d rows, want %d", versions, len(migrations))
+	}
+
+	stats, err := second.GetStats(context.Background())
+	if err != nil {
+		t.Fatalf("GetStats() unexpected error: %v", err)
+	}
+	if stats.ActivePlaylists != 1 {
+		t.Errorf("ActivePlaylists = %d, want 1 after reopening", stats.ActivePlaylists)
+	}
+}
+
+func TestSQLiteDatabase_StoresSource(t *testing.T) {
+	d := openSQLite(t, ":memory:")
+	ctx := context.Background()
+
+	if err := d.NewDownloadRequest(ctx, utils.SourceYouTubeMusic, "https://music.youtube.com/playlist?list=PL1", "Mix", 1, Chat{}, 0, nil, nil); err != nil {
+		t.Fatalf("NewDownloadRequest() unexpected error: %v", err)
+	}
+
+	var got string
+	if err := d.conn.QueryRow(`SELECT source FROM download_requests`).Scan(&got); err != nil {
+		t.Fatalf("failed to read source: %v", err)
+	}
+	if got != utils.SourceYouTubeMusic {
+		t.Errorf("source = %q, want %q", got, utils.SourceYouTubeMusic)
+	}
+}
+
+func TestSQLiteDatabase_StoresSelection(t *testing.T) {
+	d := openSQLite(t, ":memory:")
+	ctx := context.Background()
+
+	tracks := []spotify.TrackMetadata{{Artist: "Radiohead", Title: "Lucky"}}
+	if err := d.NewDownloadRequest(ctx, utils.SourceSpotify, "https://open.spotify.com/album/1", "OK Computer", 1, Chat{}, 1, tracks, []int{10}); err != nil {
+		t.Fatalf("NewDownloadRequest() unexpected error: %v", err)
+	}
+	if err := d.NewDownloadRequest(ctx, utils.SourceSpotify, "https://open.spotify.com/album/2", "Kid A", 1, Chat{}, 0, nil, nil); err != nil {
+		t.Fatalf("NewDownloadRequest() unexpected error: %v", err)
+	}
+
+	rows, err := d.conn.Query(`SELECT selection FROM download_requests ORDER BY name`)
+	if err != nil {
+		t.Fatalf("failed to read selections: %v", err)
+	}
+	defer rows.Close()
+
+	var got []sql.NullString
+	for rows.Next() {
+		var selection sql.NullString
+		if err := rows.Scan(&selection); err != nil {
+			t.Fatalf("failed to scan selection: %v", err)
+		}
+		got = append(got, selection)
+	}
+	expected := []sql.NullString{{}, {String: "[10]", Valid: true}}
+	if !slices.Equal(got, expected) {
+		t.Errorf("selections = %+v, want %+v", got, expected)
+	}
+}
+
+func TestSQLiteDatabase_FindMusicFilesChunked(t *testing.T) {
+	d := openSQLite(t, ":memory:")
+
+	n := lookupChunk*2 + 7
+	artists := make([]string, n)
+	titles := make([]string, n)
+	files := make([]models.MusicFile, 0, n)
+	for i := range artists {
+		artists[i] = "Artist"
+		titles[i] = "Track " + string(rune('A'+i%26)) + string(rune('a'+i/26%26)) + string(rune('0'+i/676))
+		files = append(files, models.MusicFile{Artist: artists[i], Title: titles[i]})
+	}
+	if err := d.AddMusicFiles(context.Background(), files...); err != nil {
+		t.Fatalf("AddMusicFiles() unexpected error: %v", err)
+	}
+
+	found, err := d.FindMusicFiles(context.Background(), artists, titles)
+	if err != nil {
+		t.Fatalf("FindMusicFiles() unexpected error: %v", err)
+	}
+	if len(found) != n {
+		t.Errorf("FindMusicFiles() returned %d files, want %d", len(found), n)
+	}
+}
@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Time series intervals supported by GetDetailedStats
+const (
+	IntervalDay  = "day"
+	IntervalWeek = "week"
+)
+
+const defaultTopN = 5
+
+type StatsOptions struct {
+	// Since limits request-based figures to requests created at or after it
+	Since time.Time
+	// Interval is the time series bucket size, IntervalDay or IntervalWeek
+	Interval string
+	// TopN caps the top requesters and top artists lists
+	TopN int
+}
+
+type DetailedStats struct {
+	Stats
+
+	Since    time.Time `json:"since"`
+	Interval string    `json:"interval"`
+
+	WindowRequests          int64        `json:"window_requests"`
+	CompletedRequests       int64        `json:"completed_requests"`
+	ErroredRequests         int64        `json:"errored_requests"`
+	CompletionRate          float64      `json:"completion_rate"`
+	MedianCompletionSeconds float64      `json:"median_completion_seconds"`
+	RequestsOverTime        []TimeBucket `json:"requests_over_time"`
+	TopRequesters           []Requester  `json:"top_requesters"`
+	TopArtists              []Artist     `json:"top_artists"`
+}
+
+type TimeBucket struct {
+	Start    time.Time `json:"start" bson:"_id"`
+	Requests int64     `json:"requests" bson:"requests"`
+}
+
+type Requester struct {
+	CreatorID int64 `json:"creator_id" bson:"_id"`
+	Requests  int64 `json:"requests" bson:"requests"`
+}
+
+type Artist struct {
+	Artist string `json:"artist" bson:"_id"`
+	Tracks int64  `json:"tracks" bson:"tracks"`
+}
+
+// completedExpr matches requests that were deactivated with every expected track found
+var completedExpr = bson.M{"$and": bson.A{
+	bson.M{"$eq": bson.A{"$active", false}},
+	bson.M{"$gt": bson.A{"$expected_track_count", 0}},
+	bson.M{"$gte": bson.A{"$found_track_count", "$expected_track_count"}},
+}}
+
+func (d *db) GetDetailedStats(ctx context.Context, opts StatsOptions) (*DetailedStats, error) {
+	if opts.Interval == "" {
+		opts.Interval = IntervalDay
+	}
+	if opts.Interval != IntervalDay && opts.Interval != IntervalWeek {
+		return nil, fmt.Errorf("unsupported interval %q", opts.Interval)
+	}
+	if opts.TopN <= 0 {
+		opts.TopN = defaultTopN
+	}
+
+	base, err := d.GetStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &DetailedStats{
+		Stats:    *base,
+		Since:    opts.Since,
+		Interval: opts.Interval,
+	}
+
+	if err := d.aggregateRequestStats(ctx, opts, stats); err != nil {
+		return nil, err
+	}
+
+	median, err := d.medianCompletion(ctx, opts.Since)
+	if err != nil {
+		return nil, err
+	}
+	stats.MedianCompletionSeconds = median
+
+	artists, err := d.topArtists(ctx, opts.TopN)
+	if err != nil {
+		return nil, err
+	}
+	stats.TopArtists = artists
+
+	return stats, nil
+}
+
+func (d *db) aggregateRequestStats(ctx context.Context, opts StatsOptions, stats *DetailedStats) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"created_at": bson.M{"$gte": opts.Since.Unix()}}}},
+		{{Key: "$facet", Value: bson.M{
+			"totals": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":       nil,
+					"total":     bson.M{"$sum": 1},
+					"completed": bson.M{"$sum": bson.M{"$cond": bson.A{completedExpr, 1, 0}}},
+					"errored":   bson.M{"$sum": bson.M{"$cond": bson.A{"$errored", 1, 0}}},
+				}},
+			},
+			"timeline": bson.A{
+				bson.M{"$group": bson.M{
+					"_id": bson.M{"$dateTrunc": bson.M{
+						"date": bson.M{"$toDate": bson.M{"$multiply": bson.A{"$created_at", 1000}}},
+						"unit": opts.Interval,
+					}},
+					"requests": bson.M{"$sum": 1},
+				}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+			"requesters": bson.A{
+				bson.M{"$group": bson.M{"_id": "$creator_id", "requests": bson.M{"$sum": 1}}},
+				bson.M{"$sort": bson.D{{Key: "requests", Value: -1}, {Key: "_id", Value: 1}}},
+				bson.M{"$limit": opts.TopN},
+			},
+		}}},
+	}
+
+	cursor, err := d.downloadQueueRequestCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return fmt.Errorf("failed to aggregate request stats: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Totals []struct {
+			Total     int64 `bson:"total"`
+			Completed int64 `bson:"completed"`
+			Errored   int64 `bson:"errored"`
+		} `bson:"totals"`
+		Timeline   []TimeBucket `bson:"timeline"`
+		Requesters []Requester  `bson:"requesters"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return fmt.Errorf("failed to decode request stats: %w", err)
+	}
+	if len(results) == 0 {
+		return nil
+	}
+
+	r := results[0]
+	stats.RequestsOverTime = r.Timeline
+	stats.TopRequesters = r.Requesters
+	if len(r.Totals) > 0 {
+		stats.WindowRequests = r.Totals[0].Total
+		stats.CompletedRequests = r.Totals[0].Completed
+		stats.ErroredRequests = r.Totals[0].Errored
+		if stats.WindowRequests > 0 {
+			stats.CompletionRate = float64(stats.CompletedRequests) / float64(stats.WindowRequests)
+		}
+	}
+
+	return nil
+}
+
+// medianCompletion computes the median time-to-complete in Go, since $median needs MongoDB 7.0
+func (d *db) medianCompletion(ctx context.Context, since time.Time) (float64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"created_at": bson.M{"$gte": since.Unix()}}}},
+		{{Key: "$match", Value: bson.M{"$expr": completedExpr}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":      0,
+			"duration": bson.M{"$subtract": bson.A{"$updated_at", "$created_at"}},
+		}}},
+	}
+
+	cursor, err := d.downloadQueueRequestCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, fmt.Errorf("failed to aggregate completion times: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Duration int64 `bson:"duration"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return 0, fmt.Errorf("failed to decode completion times: %w", err)
+	}
+
+	durations := make([]int64, 0, len(results))
+	for _, r := range results {
+		durations = append(durations, r.Duration)
+	}
+
+	return median(durations), nil
+}
+
+func (d *db) topArtists(ctx context.Context, limit int) ([]Artist, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"artist": bson.M{"$nin": bson.A{nil, ""}}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$artist", "tracks": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "tracks", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+
+	cursor, err := d.musicFilesCollection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate top artists: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	artists := make([]Artist, 0, limit)
+	if err := cursor.All(ctx, &artists); err != nil {
+		return nil, fmt.Errorf("failed to decode top artists: %w", err)
+	}
+
+	return artists, nil
+}
+
+func median(values []int64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := make([]int64, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return float64(sorted[mid-1]+sorted[mid]) / 2
+	}
+	return float64(sorted[mid])
+}
@@ -0,0 +1,41 @@
+package db
+
+import "testing"
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []int64
+		expected float64
+	}{
+		{
+			name:     "empty",
+			values:   nil,
+			expected: 0,
+		},
+		{
+			name:     "single value",
+			values:   []int64{42},
+			expected: 42,
+		},
+		{
+			name:     "odd count unsorted",
+			values:   []int64{300, 100, 200},
+			expected: 200,
+		},
+		{
+			name:     "even count averages middle values",
+			values:   []int64{10, 40, 20, 30},
+			expected: 25,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := median(tt.values)
+			if result != tt.expected {
+				t.Errorf("median(%v) = %v, want %v", tt.values, result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UserPreferences are the per-user settings the bot remembers.
+// Zero values mean the user hasn't chosen and defaults apply.
+type UserPreferences struct {
+	UserID   int64  `bson:"_id" json:"user_id"`
+	Language string `bson:"language,omitempty" json:"language,omitempty"`
+
+	// NotifyCompletion and NotifyProgress opt in to messages about the user's requests
+	NotifyCompletion bool `bson:"notify_completion" json:"notify_completion"`
+	NotifyProgress   bool `bson:"notify_progress" json:"notify_progress"`
+	// PlaylistNoPull makes /playlist behave like /pnp instead of /p
+	PlaylistNoPull bool `bson:"playlist_no_pull" json:"playlist_no_pull"`
+	// QuietFrom and QuietTo are the hours, in the server's time zone, between which
+	// notifications arrive silently. Equal values turn quiet hours off.
+	QuietFrom int `bson:"quiet_from" json:"quiet_from"`
+	QuietTo   int `bson:"quiet_to" json:"quiet_to"`
+
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// QuietHours reports whether quiet hours are set
+func (p UserPreferences) QuietHours() bool {
+	return p.QuietFrom != p.QuietTo
+}
+
+// InQuietHours reports whether t falls in the user's quiet hours, which may wrap past midnight
+func (p UserPreferences) InQuietHours(t time.Time) bool {
+	if !p.QuietHours() {
+		return false
+	}
+
+	hour := t.Hour()
+	if p.QuietFrom < p.QuietTo {
+		return hour >= p.QuietFrom && hour < p.QuietTo
+	}
+	return hour >= p.QuietFrom || hour < p.QuietTo
+}
+
+func (d *db) GetUserPreferences(ctx context.Context, userID int64) (*UserPreferences, error) {
+	prefs := &UserPreferences{UserID: userID}
+	err := d.usersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(prefs)
+	if err == mongo.ErrNoDocuments {
+		return &UserPreferences{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user preferences: %w", err)
+	}
+
+	return prefs, nil
+}
+
+func (d *db) SaveUserPreferences(ctx context.Context, prefs UserPreferences) error {
+	prefs.UpdatedAt = time.Now()
+	_, err := d.usersCollection.ReplaceOne(ctx, bson.M{"_id": prefs.UserID}, prefs, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save user preferences: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserPreferences_InQuietHours(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to int
+		hour     int
+		expected bool
+	}{
+		{name: "off", from: 0, to: 0, hour: 3, expected: false},
+		{name: "same day inside", from: 13, to: 15, hour: 14, expected: true},
+		{name: "same day end is exclusive", from: 13, to: 15, hour: 15, expected: false},
+		{name: "overnight before midnight", from: 22, to: 8, hour: 23, expected: true},
+		{name: "overnight after midnight", from: 22, to: 8, hour: 7, expected: true},
+		{name: "overnight daytime", from: 22, to: 8, hour: 12, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefs := UserPreferences{QuietFrom: tt.from, QuietTo: tt.to}
+			at := time.Date(2024, 1, 1, tt.hour, 30, 0, 0, time.Local)
+			if got := prefs.InQuietHours(at); got != tt.expected {
+				t.Errorf("InQuietHours(%02d:30) with %d-%d = %v, want %v", tt.hour, tt.from, tt.to, got, tt.expected)
+			}
+		})
+	}
+}
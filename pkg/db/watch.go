@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	models "github.com/supperdoggy/spot-models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// ErrWatchUnsupported is returned by backends that can't stream new music files
+var ErrWatchUnsupported = errors.New("watching music files is not supported")
+
+// ResumeToken marks a position in a change stream, so a stream reopened after a
+// failure picks up right after the last event it delivered
+type ResumeToken []byte
+
+// MusicFileWatcher is implemented by backends that can push newly indexed files.
+// WatchMusicFiles blocks, calling fn for each file, until ctx is done or the stream fails.
+// It starts after resume when that is set and returns the token to resume from.
+type MusicFileWatcher interface {
+	WatchMusicFiles(ctx context.Context, resume ResumeToken, fn func(models.MusicFile)) (ResumeToken, error)
+}
+
+// Server error codes for a change stream that can't be opened or resumed
+const (
+	codeChangeStreamUnsupported = 40573
+	codeChangeStreamHistoryLost = 286
+	codeChangeStreamFatal       = 280
+)
+
+// WatchMusicFiles follows inserts into music-files through a change stream. Replaced and
+// updated files are left to the periodic pass, counting them here would count a track twice.
+// Change streams need a replica set, on a standalone server this returns ErrWatchUnsupported.
+func (d *db) WatchMusicFiles(ctx context.Context, resume ResumeToken, fn func(models.MusicFile)) (ResumeToken, error) {
+	stream, err := d.openMusicFilesStream(ctx, resume)
+	var serverErr mongo.ServerError
+	if resume != nil && errors.As(err, &serverErr) &&
+		(serverErr.HasErrorCode(codeChangeStreamHistoryLost) || serverErr.HasErrorCode(codeChangeStreamFatal)) {
+		// The oplog moved past the token, start from now and leave the gap to the periodic pass
+		d.log.Warn("Music files change stream can't be resumed, starting from now", zap.Error(err))
+		resume = nil
+		stream, err = d.openMusicFilesStream(ctx, nil)
+	}
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(codeChangeStreamUnsupported) {
+		return nil, fmt.Errorf("%w: %v", ErrWatchUnsupported, err)
+	}
+	if err != nil {
+		return resume, fmt.Errorf("failed to watch music files: %w", err)
+	}
+	defer stream.Close(ctx)
+
+	for stream.Next(ctx) {
+		var event struct {
+			FullDocument models.MusicFile `bson:"fullDocument"`
+			DocumentKey  struct {
+				ID interface{} `bson:"_id"`
+			} `bson:"documentKey"`
+		}
+		if err := stream.Decode(&event); err != nil {
+			// One malformed file shouldn't end the stream, the token still moves past it
+			d.log.Warn("Skipping undecodable music files change event", zap.Error(err))
+			continue
+		}
+
+		// The indexer doesn't set match_key, key the file so lookups find it right away.
+		// If this fails the periodic pass keys it later.
+		file := event.FullDocument
+		if _, err := d.musicFilesCollection.UpdateOne(ctx, bson.M{"_id": event.DocumentKey.ID},
+			bson.M{"$set": bson.M{"match_key": utils.MatchKey(file.Artist, file.Title)}}); err != nil {
+			d.log.Warn("Failed to set match_key on new music file", zap.Error(err))
+		}
+		fn(file)
+	}
+
+	if token := stream.ResumeToken(); token != nil {
+		resume = ResumeToken(append([]byte(nil), token...))
+	}
+	if err := stream.Err(); err != nil {
+		return resume, fmt.Errorf("music files change stream failed: %w", err)
+	}
+	return resume, ctx.Err()
+}
+
+func (d *db) openMusicFilesStream(ctx context.Context, resume ResumeToken) (*mongo.ChangeStream, error) {
+	opts := options.ChangeStream()
+	if resume != nil {
+		opts.SetResumeAfter(bson.Raw(resume))
+	}
+
+	return d.musicFilesCollection.Watch(ctx,
+		mongo.Pipeline{{{Key: "$match", Value: bson.M{"operationType": "insert"}}}},
+		opts,
+	)
+}
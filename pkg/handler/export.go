@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/i18n"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/metrics"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/playlist"
+	"go.uber.org/zap"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// HandleExport builds an M3U8 playlist of a request's downloaded tracks. It is saved to the
+// playlist directory if one is configured, otherwise sent back as a document.
+func (h *handler) HandleExport(m *telebot.Message) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand("export", outcome) }()
+
+	if !h.allowedIn(m) {
+		h.log.Info("Unauthorized user", zap.Int64("user_id", m.Sender.ID))
+		outcome = metrics.OutcomeUnauthorized
+		return
+	}
+	t := h.translator(m.Sender)
+
+	args := strings.Fields(m.Text)
+	if len(args) != 2 {
+		h.reply(m, t(i18n.ExportUsage, nil))
+		outcome = metrics.OutcomeInvalid
+		return
+	}
+
+	ctx := context.Background()
+	request, err := h.db.GetDownloadRequest(ctx, args[1])
+	if errors.Is(err, db.ErrNotFound) {
+		h.reply(m, t(i18n.ExportNotFound, nil))
+		outcome = metrics.OutcomeInvalid
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to get download request", zap.Error(err), zap.String("id", args[1]))
+		h.reply(m, t(i18n.ExportFailed, nil))
+		outcome = metrics.OutcomeError
+		return
+	}
+
+	p, err := playlist.Build(ctx, h.db, *request)
+	if err != nil {
+		h.log.Error("Failed to build playlist", zap.Error(err), zap.String("id", request.ID))
+		h.reply(m, t(i18n.ExportFailed, nil))
+		outcome = metrics.OutcomeError
+		return
+	}
+	if len(p.Files) == 0 {
+		h.reply(m, t(i18n.ExportEmpty, i18n.Args{"Name": request.Name}))
+		return
+	}
+	summary := i18n.Args{"Name": request.Name, "Found": len(p.Files), "Tracks": p.Tracks}
+
+	if dir := h.current().PlaylistDir; dir != "" {
+		path, err := p.Save(dir)
+		if err != nil {
+			h.log.Error("Failed to save playlist", zap.Error(err), zap.String("dir", dir))
+			h.reply(m, t(i18n.ExportFailed, nil))
+			outcome = metrics.OutcomeError
+			return
+		}
+		summary["Path"] = path
+		h.reply(m, t(i18n.ExportSaved, summary))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteM3U8(&buf); err != nil {
+		h.log.Error("Failed to write playlist", zap.Error(err))
+		h.reply(m, t(i18n.ExportFailed, nil))
+		outcome = metrics.OutcomeError
+		return
+	}
+	document := &telebot.Document{
+		File:     telebot.FromReader(&buf),
+		FileName: p.FileName(),
+		MIME:     playlist.ContentType,
+		Caption:  t(i18n.ExportCaption, summary),
+	}
+	if _, err := h.bot.Reply(m, document); err != nil {
+		h.log.Error("Failed to send playlist", zap.Error(err))
+		outcome = metrics.OutcomeError
+	}
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/i18n"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/metrics"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/spotifysearch"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	"go.uber.org/zap"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// FindButton is the callback endpoint of /find results, its data is the result's spotify:<kind>:<id> URI.
+// A full link could exceed Telegram's 64 byte limit on callback data.
+var FindButton = telebot.InlineButton{Unique: "find"}
+
+// findLimit is how many results of each kind /find shows
+const findLimit = 3
+
+// captionLimit is the most UTF-16 code units Telegram accepts in a photo caption
+const captionLimit = 1024
+
+// findQueryLimit is how many characters of the query the results echo
+const findQueryLimit = 64
+
+// findKinds are searched in this order, albums first since they are queued most
+var findKinds = []string{spotifysearch.Album, spotifysearch.Track, spotifysearch.Playlist}
+
+var kindEmoji = map[string]string{
+	spotifysearch.Album:    "💿",
+	spotifysearch.Track:    "🎵",
+	spotifysearch.Playlist: "📜",
+}
+
+func (h *handler) HandleFind(m *telebot.Message) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand("find", outcome) }()
+
+	if !h.allowedIn(m) {
+		h.log.Info("Unauthorized user", zap.Int64("user_id", m.Sender.ID))
+		outcome = metrics.OutcomeUnauthorized
+		return
+	}
+	t := h.translator(m.Sender)
+
+	_, query, _ := strings.Cut(m.Text, " ")
+	query = strings.TrimSpace(query)
+	if query == "" {
+		h.reply(m, t(i18n.FindUsage, nil))
+		outcome = metrics.OutcomeInvalid
+		return
+	}
+
+	results, err := h.current().Search.Search(context.Background(), query, findKinds, findLimit)
+	if err != nil {
+		h.log.Error("Failed to search spotify", zap.Error(err), zap.String("query", query))
+		h.reply(m, t(i18n.FindFailed, nil))
+		outcome = metrics.OutcomeError
+		return
+	}
+
+	text := t(i18n.FindHeader, i18n.Args{"Query": truncate(query, findQueryLimit)}) + "\n\n"
+	markup := &telebot.ReplyMarkup{}
+	var cover string
+	for _, r := range results {
+		uri, ok := utils.SpotifyID(r.URL)
+		if !ok {
+			continue
+		}
+		if len(markup.InlineKeyboard) == 0 {
+			cover = r.ImageURL
+		}
+
+		n := len(markup.InlineKeyboard) + 1
+		text += t(i18n.FindResult, i18n.Args{
+			"Index": n, "Kind": kindEmoji[r.Kind], "Name": r.Name, "Artist": r.Artist,
+			"Year": releaseYear(r.ReleaseDate), "Tracks": r.TrackCount,
+		}) + "\n"
+
+		b := *FindButton.With(uri)
+		b.Text = fmt.Sprintf("%d. %s %s — %s", n, kindEmoji[r.Kind], r.Name, r.Artist)
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{b})
+	}
+
+	if len(markup.InlineKeyboard) == 0 {
+		h.reply(m, t(i18n.FindEmpty, i18n.Args{"Query": truncate(query, findQueryLimit)}))
+		return
+	}
+
+	// Show the top result's cover above the list, unless the list is too long for a caption
+	var what interface{} = text
+	if cover != "" && utf16Len(text) <= captionLimit {
+		what = &telebot.Photo{File: telebot.FromURL(cover), Caption: text}
+	}
+	if _, err := h.bot.Reply(m, what, markup); err != nil {
+		h.log.Error("Failed to send reply", zap.Error(err))
+	}
+}
+
+// HandleFindCallback queues the /find result that was tapped, as if its link had been sent,
+// so releases of several tracks are offered to choose from as well
+func (h *handler) HandleFindCallback(c *telebot.Callback) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand("find_callback", outcome) }()
+
+	if !h.allowed(c.Sender.ID) || !h.chatAllowed(c.Message.Chat) {
+		h.log.Info("Unauthorized user", zap.Int64("user_id", c.Sender.ID))
+		outcome = metrics.OutcomeUnauthorized
+		return
+	}
+	h.respond(c, "")
+
+	link, ok := spotifyLink(c.Data)
+	if !ok {
+		h.log.Warn("Unknown find button", zap.String("data", c.Data))
+		outcome = metrics.OutcomeInvalid
+		return
+	}
+
+	// Notifications reply to the /find results, which sit in the thread /find was sent in
+	outcome = h.offer(c.Message, c.Sender, requestChat(c.Message), link)
+}
+
+// spotifyLink turns a spotify:<kind>:<id> URI back into an open.spotify.com link
+func spotifyLink(uri string) (string, bool) {
+	parts := strings.Split(uri, ":")
+	if len(parts) != 3 || parts[0] != "spotify" || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+	return "https://open.spotify.com/" + parts[1] + "/" + parts[2], true
+}
+
+// truncate shortens s to at most n characters, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// utf16Len is the length of s the way Telegram counts it, in UTF-16 code units
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// releaseYear trims a Spotify release date, which may be just a year, to the year
+func releaseYear(date string) string {
+	year, _, _ := strings.Cut(date, "-")
+	return year
+}
@@ -2,13 +2,17 @@ package handler
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/i18n"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/metrics"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/reconcile"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/source"
 	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
-	models "github.com/supperdoggy/spot-models"
 	"github.com/supperdoggy/spot-models/spotify"
 	"go.uber.org/zap"
 	"gopkg.in/tucnak/telebot.v2"
@@ -21,25 +25,134 @@ type Handler interface {
 	HandleDeactivate(m *telebot.Message)
 	HandlePlaylist(m *telebot.Message)
 	HandlePlaylistNoPull(m *telebot.Message)
+	HandleMine(m *telebot.Message)
+	HandleStats(m *telebot.Message)
+	HandleLang(m *telebot.Message)
+	HandlePlaylistDefault(m *telebot.Message)
+	HandleSettings(m *telebot.Message)
+	HandleSettingsCallback(c *telebot.Callback)
+	HandleFind(m *telebot.Message)
+	HandleFindCallback(c *telebot.Callback)
+	HandleExport(m *telebot.Message)
+	HandlePickCallback(c *telebot.Callback)
+	HandleInlineQuery(q *telebot.Query)
+	HandleInlineChosen(r *telebot.ChosenInlineResult)
+	Reload(settings Settings)
+}
+
+// Settings are the handler options that can change while the bot is running
+type Settings struct {
+	WhiteList []int64
+	// GroupWhiteList limits the groups the bot works in, it works in any group when empty.
+	// Group members still have to be on WhiteList.
+	GroupWhiteList []int64
+	DoneWebhook    string
+	// PlaylistDir is where /export saves playlists, they are sent back as documents when it is empty
+	PlaylistDir string
+	// Sources resolve the links users send, they are rebuilt when a credential rotates
+	Sources source.Resolvers
+	// Search backs /find, it is rebuilt with Sources
+	Search source.SpotifySearcher
+	// Messages renders replies, it picks up operator overrides on reload
+	Messages *i18n.Catalog
+}
+
+// Sender is the part of *telebot.Bot the handler talks back through
+type Sender interface {
+	Reply(to *telebot.Message, what interface{}, options ...interface{}) (*telebot.Message, error)
+	Edit(msg telebot.Editable, what interface{}, options ...interface{}) (*telebot.Message, error)
+	Respond(c *telebot.Callback, resp ...*telebot.CallbackResponse) error
+	Answer(q *telebot.Query, resp *telebot.QueryResponse) error
 }
 
 type handler struct {
-	db             db.Database
-	spotifyService spotify.SpotifyService
-	whiteList      []int64
-	bot            *telebot.Bot
-	log            *zap.Logger
-	doneWebhook    string
+	db         db.Database
+	bot        Sender
+	log        *zap.Logger
+	reconciler *reconcile.Reconciler
+
+	mu       sync.RWMutex
+	settings Settings
+
+	// picks are offers to queue a release whole or track by track, waiting for an answer
+	picks pickStore
 }
 
-func NewHandler(db db.Database, spotifyService spotify.SpotifyService, log *zap.Logger, bot *telebot.Bot, doneWebhook string, whiteList []int64) Handler {
+func NewHandler(db db.Database, reconciler *reconcile.Reconciler, log *zap.Logger, bot Sender, settings Settings) Handler {
 	return &handler{
-		db:             db,
-		spotifyService: spotifyService,
-		log:            log,
-		bot:            bot,
-		whiteList:      whiteList,
-		doneWebhook:    doneWebhook,
+		db:         db,
+		log:        log,
+		bot:        bot,
+		reconciler: reconciler,
+		settings:   settings,
+	}
+}
+
+// Reload swaps in new settings, for example after the config file changed
+func (h *handler) Reload(settings Settings) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.settings = settings
+}
+
+func (h *handler) current() Settings {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.settings
+}
+
+func (h *handler) allowed(userID int64) bool {
+	return utils.InWhiteList(userID, h.current().WhiteList)
+}
+
+// allowedIn tells whether the sender of m may use the bot in the chat m was sent in
+func (h *handler) allowedIn(m *telebot.Message) bool {
+	return h.allowed(m.Sender.ID) && h.chatAllowed(m.Chat)
+}
+
+// chatAllowed tells whether the bot works in chat. Private chats always pass,
+// groups have to be on the group whitelist if there is one.
+func (h *handler) chatAllowed(chat *telebot.Chat) bool {
+	if !isGroup(chat) {
+		return true
+	}
+	groups := h.current().GroupWhiteList
+	return len(groups) == 0 || utils.InWhiteList(chat.ID, groups)
+}
+
+func isGroup(chat *telebot.Chat) bool {
+	return chat != nil && (chat.Type == telebot.ChatGroup || chat.Type == telebot.ChatSuperGroup)
+}
+
+// requestChat attributes a request made with m to its group, replies to m then
+// land in the same thread. Requests made in private chats get the zero Chat.
+func requestChat(m *telebot.Message) db.Chat {
+	if m == nil || !isGroup(m.Chat) {
+		return db.Chat{}
+	}
+	return db.Chat{ID: m.Chat.ID, MessageID: m.ID}
+}
+
+// locale is the user's /lang choice if they made one, otherwise the
+// language of their Telegram client
+func (h *handler) locale(user *telebot.User) string {
+	var preferred string
+	prefs, err := h.db.GetUserPreferences(context.Background(), user.ID)
+	if err != nil {
+		h.log.Error("Failed to get user preferences", zap.Error(err), zap.Int64("user_id", user.ID))
+	} else {
+		preferred = prefs.Language
+	}
+
+	return h.current().Messages.Locale(preferred, user.LanguageCode)
+}
+
+// translator renders messages in the user's locale
+func (h *handler) translator(user *telebot.User) func(key string, data any) string {
+	catalog := h.current().Messages
+	locale := h.locale(user)
+	return func(key string, data any) string {
+		return catalog.Text(locale, key, data)
 	}
 }
 
@@ -50,133 +163,187 @@ func (h *handler) reply(m *telebot.Message, text string) {
 }
 
 func (h *handler) sendWebhook() {
-	if err := utils.SendDoneWebhook(h.doneWebhook); err != nil {
+	metrics.WebhookDeliveries.Inc()
+	if err := utils.SendDoneWebhook(h.current().DoneWebhook); err != nil {
+		metrics.WebhookFailures.Inc()
 		h.log.Error("Failed to send webhook", zap.Error(err))
 	}
 }
 
 func (h *handler) Start(m *telebot.Message) {
-	if !utils.InWhiteList(m.Sender.ID, h.whiteList) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand("start", outcome) }()
+
+	if !h.allowedIn(m) {
 		h.log.Info("Unauthorized user", zap.Int64("user_id", m.Sender.ID))
+		outcome = metrics.OutcomeUnauthorized
 		return
 	}
+	t := h.translator(m.Sender)
 
-	h.reply(m, "Привіііііііііт, я бот який кочає музіку на сєрвер, скинь мені урлу на спотік і я додам в чергу на скачування ❤️")
+	h.reply(m, t(i18n.Welcome, nil))
 }
 
 func (h *handler) HandleText(m *telebot.Message) {
-	if !utils.InWhiteList(m.Sender.ID, h.whiteList) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand("text", outcome) }()
+
+	// In groups the bot only speaks up about links it can queue, not the rest of the conversation
+	if isGroup(m.Chat) {
+		if _, err := h.current().Sources.For(m.Text); err != nil {
+			outcome = metrics.OutcomeIgnored
+			return
+		}
+	}
+
+	if !h.allowedIn(m) {
 		h.log.Info("Unauthorized user", zap.Int64("user_id", m.Sender.ID))
+		outcome = metrics.OutcomeUnauthorized
 		return
 	}
 
 	h.log.Info("Received message", zap.Any("message", m.Text))
 
-	// Check if the message is a valid Spotify URL
-	if !utils.IsValidSpotifyURL(m.Text) {
-		h.reply(m, "о ніііііі, це не посилання на спотіфай.... 💔😭")
-		return
+	outcome = h.offer(m, m.Sender, requestChat(m), m.Text)
+}
+
+// release is a resolved link, ready to be queued
+type release struct {
+	// sourceName and link are what the request is stored with, translated links are
+	// stored as the link they were matched to
+	sourceName string
+	link       string
+	res        *source.Resolution
+}
+
+// enqueue resolves link and queues all of it for sender in chat, telling them how it went
+// through reply. It returns the command outcome.
+func (h *handler) enqueue(sender *telebot.User, chat db.Chat, link string, reply func(text string)) string {
+	r, outcome := h.resolve(sender, link, reply)
+	if r == nil {
+		return outcome
 	}
+	return h.queue(sender, chat, r, nil, reply)
+}
 
-	ctx := context.Background()
+// resolve looks link up for sender, telling them what went wrong through reply.
+// It returns nil and the command outcome if link can't be queued.
+func (h *handler) resolve(sender *telebot.User, link string, reply func(text string)) (*release, string) {
+	t := h.translator(sender)
 
-	// Get object name and track count from Spotify API
-	name, err := h.spotifyService.GetObjectName(ctx, m.Text)
+	resolver, err := h.current().Sources.For(link)
 	if err != nil {
-		h.log.Error("Failed to get object name from Spotify", zap.Error(err))
-		h.reply(m, "не получилось отримати інформацію зі спотіфай, спробуй ще раз...")
-		return
+		reply(t(i18n.UnsupportedLink, nil))
+		return nil, metrics.OutcomeInvalid
 	}
 
-	trackCount, trackMetadata, err := h.spotifyService.GetTrackCount(ctx, m.Text)
+	res, err := resolver.Resolve(context.Background(), link)
 	if err != nil {
-		h.log.Error("Failed to get track count from Spotify", zap.Error(err))
-		h.reply(m, "не получилось отримати кількість треків, але додав в чергу...")
+		h.log.Error("Failed to resolve link", zap.Error(err), zap.String("source", resolver.Name()))
+		switch {
+		case errors.Is(err, source.ErrNoMatch):
+			reply(t(i18n.NoSpotifyMatch, nil))
+		case resolver.Name() == source.Spotify:
+			reply(t(i18n.SpotifyLookupFailed, nil))
+		default:
+			reply(t(i18n.LookupFailed, nil))
+		}
+		return nil, metrics.OutcomeError
+	}
+
+	if res.TracksErr != nil {
+		h.log.Error("Failed to get tracks", zap.Error(res.TracksErr), zap.String("source", resolver.Name()))
+		reply(t(i18n.TrackCountFailed, nil))
 		// Continue with empty track data
-		trackCount = 0
-		trackMetadata = nil
+	}
+
+	r := &release{sourceName: resolver.Name(), link: link, res: res}
+	if res.Match != nil {
+		r.sourceName, r.link = res.Source, res.Link
+		reply(t(i18n.LinkTranslated, i18n.Args{"Artist": res.Match.Artist, "Name": res.Match.Name, "Link": res.Link}))
+	}
+	return r, metrics.OutcomeOK
+}
+
+// queue adds r to the download queue for sender in chat. A non-nil selection queues only the
+// tracks of r at those positions. It returns the command outcome.
+func (h *handler) queue(sender *telebot.User, chat db.Chat, r *release, selection []int, reply func(text string)) string {
+	t := h.translator(sender)
+
+	count, tracks := r.res.TrackCount, r.res.Tracks
+	if selection != nil {
+		tracks = make([]spotify.TrackMetadata, 0, len(selection))
+		for _, i := range selection {
+			tracks = append(tracks, r.res.Tracks[i])
+		}
+		count = len(tracks)
 	}
 
 	// Add the download request to the database
-	err = h.db.NewDownloadRequest(ctx, m.Text, name, m.Sender.ID, trackCount, trackMetadata)
+	err := h.db.NewDownloadRequest(context.Background(), r.sourceName, r.link, r.res.Name, sender.ID, chat, count, tracks, selection)
 	if err != nil {
 		h.log.Error("Failed to add download request to database", zap.Error(err))
-		h.reply(m, "не получилось додати в чергу, скажи максиму шо шось не так...")
-		return
+		reply(t(i18n.QueueAddFailed, nil))
+		return metrics.OutcomeError
 	}
 
 	h.sendWebhook()
 
-	h.reply(m, fmt.Sprintf("Ураураура успішно додали %s в чергу! (Треків: %d) ❤️", name, trackCount))
+	reply(t(i18n.Queued, i18n.Args{"Name": r.res.Name, "Tracks": count}))
+	return metrics.OutcomeOK
 }
 
 func (h *handler) HandleQueue(m *telebot.Message) {
-	if !utils.InWhiteList(m.Sender.ID, h.whiteList) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand("queue", outcome) }()
+
+	if !h.allowedIn(m) {
 		h.log.Info("Unauthorized user", zap.Int64("user_id", m.Sender.ID))
+		outcome = metrics.OutcomeUnauthorized
 		return
 	}
+	t := h.translator(m.Sender)
 
 	ctx := context.Background()
 	requests, err := h.db.GetActiveRequests(ctx)
 	if err != nil {
 		h.log.Error("Failed to get active download requests", zap.Error(err))
-		h.reply(m, "не получилося дістати чергу... 💔😭")
+		h.reply(m, t(i18n.QueueFailed, nil))
+		outcome = metrics.OutcomeError
 		return
 	}
 
 	if len(requests) == 0 {
-		h.reply(m, "немає активних запитів на скачування...")
+		h.reply(m, t(i18n.QueueEmpty, nil))
 		return
 	}
 
-	// Update found track count for each request and save to database
-	for i := range requests {
-		if requests[i].ExpectedTrackCount > 0 && len(requests[i].TrackMetadata) > 0 {
-			foundCount, err := h.compareTracks(ctx, requests[i])
-			if err != nil {
-				h.log.Error("Failed to compare tracks", zap.Error(err), zap.String("request_id", requests[i].ID))
-				continue
-			}
-			// Always update the count when /queue is called
-			requests[i].FoundTrackCount = foundCount
-			requests[i].UpdatedAt = time.Now().Unix()
-			
-			// Mark as completed if all tracks are found
-			if foundCount == requests[i].ExpectedTrackCount && requests[i].Active {
-				requests[i].Active = false
-				h.log.Info("Marking request as completed", 
-					zap.String("request_id", requests[i].ID),
-					zap.String("name", requests[i].Name),
-					zap.Int("found", foundCount),
-					zap.Int("expected", requests[i].ExpectedTrackCount))
-			}
-			
-			if err := h.db.UpdateDownloadRequest(ctx, requests[i]); err != nil {
-				h.log.Error("Failed to update found track count", zap.Error(err))
-			}
-		}
+	// Refresh found track counts and complete fully downloaded requests
+	requests, err = h.reconciler.Run(ctx, requests)
+	if err != nil {
+		h.log.Error("Failed to reconcile requests", zap.Error(err))
 	}
 
-	response := "Активні запити на скачування:\n\n"
+	response := t(i18n.QueueHeader, nil) + "\n\n"
 	for _, r := range requests {
-		response += fmt.Sprintf("📀 %s\n", r.Name)
+		response += t(i18n.QueueItem, i18n.Args{"Name": r.Name}) + "\n"
 		if r.ExpectedTrackCount > 0 {
 			downloaded := r.FoundTrackCount
 			remaining := r.ExpectedTrackCount - r.FoundTrackCount
 			percentage := float64(downloaded) / float64(r.ExpectedTrackCount) * 100
 
-			response += fmt.Sprintf("   ✅ Завантажено: %d/%d (%.0f%%)\n", downloaded, r.ExpectedTrackCount, percentage)
+			response += t(i18n.QueueProgress, i18n.Args{"Found": downloaded, "Expected": r.ExpectedTrackCount, "Percent": percentage}) + "\n"
 			if remaining > 0 {
-				response += fmt.Sprintf("   ⏳ Залишилось: %d треків\n", remaining)
+				response += t(i18n.QueueRemaining, i18n.Args{"Remaining": remaining}) + "\n"
 			} else {
-				response += "   🎉 Всі треки завантажені!\n"
+				response += t(i18n.QueueAllDownloaded, nil) + "\n"
 			}
 		} else {
-			response += "   ⏳ Очікування завантаження...\n"
+			response += t(i18n.QueueWaiting, nil) + "\n"
 		}
 
 		if r.Errored {
-			response += fmt.Sprintf("   ⚠️ Помилки: %d\n", r.RetryCount)
+			response += t(i18n.QueueErrors, i18n.Args{"Retries": r.RetryCount}) + "\n"
 		}
 		response += "\n"
 	}
@@ -184,54 +351,176 @@ func (h *handler) HandleQueue(m *telebot.Message) {
 	h.reply(m, response)
 }
 
-// compareTracks compares expected tracks with indexed files and returns the count of found tracks
-func (h *handler) compareTracks(ctx context.Context, request models.DownloadQueueRequest) (int, error) {
-	if len(request.TrackMetadata) == 0 {
-		return 0, nil
+// mineLimit caps how many past requests /mine lists
+const mineLimit = 20
+
+func (h *handler) HandleMine(m *telebot.Message) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand("mine", outcome) }()
+
+	if !h.allowedIn(m) {
+		h.log.Info("Unauthorized user", zap.Int64("user_id", m.Sender.ID))
+		outcome = metrics.OutcomeUnauthorized
+		return
 	}
+	t := h.translator(m.Sender)
 
-	// Extract artists and titles from track metadata
-	artists := make([]string, 0, len(request.TrackMetadata))
-	titles := make([]string, 0, len(request.TrackMetadata))
-	for _, track := range request.TrackMetadata {
-		artists = append(artists, track.Artist)
-		titles = append(titles, track.Title)
+	ctx := context.Background()
+	requests, err := h.db.GetUserRequests(ctx, m.Sender.ID)
+	if err != nil {
+		h.log.Error("Failed to get user requests", zap.Error(err), zap.Int64("user_id", m.Sender.ID))
+		h.reply(m, t(i18n.MineFailed, nil))
+		outcome = metrics.OutcomeError
+		return
+	}
+
+	if len(requests) == 0 {
+		h.reply(m, t(i18n.MineEmpty, nil))
+		return
 	}
 
-	// Find matching music files in the database
-	foundMusic, err := h.db.FindMusicFiles(ctx, artists, titles)
+	stats, err := h.db.GetUserStats(ctx, m.Sender.ID)
 	if err != nil {
-		return 0, err
+		h.log.Error("Failed to get user stats", zap.Error(err), zap.Int64("user_id", m.Sender.ID))
+		h.reply(m, t(i18n.MineStatsFailed, nil))
+		outcome = metrics.OutcomeError
+		return
 	}
 
-	// Create a map for quick lookup (case-insensitive)
-	foundMap := make(map[string]bool)
-	for _, music := range foundMusic {
-		key := strings.ToLower(music.Artist) + " " + strings.ToLower(music.Title)
-		foundMap[key] = true
+	response := t(i18n.MineHeader, nil) + "\n\n"
+	for i, r := range requests {
+		if i == mineLimit {
+			response += t(i18n.MineMore, i18n.Args{"Count": len(requests) - mineLimit}) + "\n\n"
+			break
+		}
+
+		response += t(i18n.MineItem, i18n.Args{"Status": statusEmoji(utils.RequestStatus(r)), "Name": r.Name}) + "\n"
+		if r.ExpectedTrackCount > 0 {
+			response += t(i18n.MineTracks, i18n.Args{"Found": r.FoundTrackCount, "Expected": r.ExpectedTrackCount}) + "\n"
+		}
+		response += t(i18n.MineID, i18n.Args{"ID": r.ID}) + "\n\n"
+	}
+
+	response += t(i18n.MineTotals, i18n.Args{
+		"Total": stats.TotalRequests, "Active": stats.ActiveRequests, "Completed": stats.CompletedRequests,
+	}) + "\n"
+	response += t(i18n.MineTracksDelivered, i18n.Args{"Tracks": stats.TracksDelivered}) + "\n"
+	if stats.CompletedRequests > 0 {
+		avg := time.Duration(stats.AvgCompletionSeconds * float64(time.Second))
+		response += t(i18n.MineAvgCompletion, i18n.Args{"Duration": avg.Round(time.Minute)}) + "\n"
+	}
+
+	h.reply(m, response)
+}
+
+func statusEmoji(status string) string {
+	switch status {
+	case utils.StatusCompleted:
+		return "✅"
+	case utils.StatusErrored:
+		return "⚠️"
+	case utils.StatusDeactivated:
+		return "⛔"
+	default:
+		return "⏳"
+	}
+}
+
+// defaultStatsWindow is used by /stats when no window is given
+const defaultStatsWindow = "30d"
+
+func (h *handler) HandleStats(m *telebot.Message) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand("stats", outcome) }()
+
+	if !h.allowedIn(m) {
+		h.log.Info("Unauthorized user", zap.Int64("user_id", m.Sender.ID))
+		outcome = metrics.OutcomeUnauthorized
+		return
+	}
+	t := h.translator(m.Sender)
+
+	window := defaultStatsWindow
+	args := strings.Fields(m.Text)
+	if len(args) > 2 {
+		h.reply(m, t(i18n.StatsUsage, nil))
+		outcome = metrics.OutcomeInvalid
+		return
+	}
+	if len(args) == 2 {
+		window = args[1]
+	}
+
+	since, err := utils.ParseSince(window, time.Now())
+	if err != nil {
+		h.reply(m, t(i18n.StatsInvalidPeriod, nil))
+		outcome = metrics.OutcomeInvalid
+		return
+	}
+
+	interval := db.IntervalDay
+	if time.Since(since) > 31*24*time.Hour {
+		interval = db.IntervalWeek
+	}
+
+	stats, err := h.db.GetDetailedStats(context.Background(), db.StatsOptions{Since: since, Interval: interval})
+	if err != nil {
+		h.log.Error("Failed to get detailed stats", zap.Error(err))
+		h.reply(m, t(i18n.StatsFailed, nil))
+		outcome = metrics.OutcomeError
+		return
+	}
+
+	response := t(i18n.StatsHeader, i18n.Args{"Since": since.Format(time.DateOnly)}) + "\n\n"
+	response += t(i18n.StatsLibrary, i18n.Args{"Count": stats.TotalMusicFiles}) + "\n"
+	response += t(i18n.StatsActive, i18n.Args{"Count": stats.ActiveDownloadQueue}) + "\n"
+	response += t(i18n.StatsNew, i18n.Args{"Count": stats.WindowRequests}) + "\n"
+	response += t(i18n.StatsCompleted, i18n.Args{"Count": stats.CompletedRequests, "Percent": stats.CompletionRate * 100}) + "\n"
+	response += t(i18n.StatsErrored, i18n.Args{"Count": stats.ErroredRequests}) + "\n"
+	if stats.MedianCompletionSeconds > 0 {
+		median := time.Duration(stats.MedianCompletionSeconds * float64(time.Second))
+		response += t(i18n.StatsMedian, i18n.Args{"Duration": median.Round(time.Minute)}) + "\n"
+	}
+
+	if len(stats.RequestsOverTime) > 0 {
+		response += "\n" + t(i18n.StatsOverTime, nil) + "\n"
+		for _, b := range stats.RequestsOverTime {
+			response += t(i18n.StatsRow, i18n.Args{"Label": b.Start.Format(time.DateOnly), "Count": b.Requests}) + "\n"
+		}
+	}
+
+	if len(stats.TopRequesters) > 0 {
+		response += "\n" + t(i18n.StatsTopRequesters, nil) + "\n"
+		for _, r := range stats.TopRequesters {
+			response += t(i18n.StatsRow, i18n.Args{"Label": r.CreatorID, "Count": r.Requests}) + "\n"
+		}
 	}
 
-	// Count how many expected tracks were found
-	foundCount := 0
-	for _, track := range request.TrackMetadata {
-		key := strings.ToLower(track.Artist) + " " + strings.ToLower(track.Title)
-		if foundMap[key] {
-			foundCount++
+	if len(stats.TopArtists) > 0 {
+		response += "\n" + t(i18n.StatsTopArtists, nil) + "\n"
+		for _, a := range stats.TopArtists {
+			response += t(i18n.StatsRow, i18n.Args{"Label": a.Artist, "Count": a.Tracks}) + "\n"
 		}
 	}
 
-	return foundCount, nil
+	h.reply(m, response)
 }
 
 func (h *handler) HandleDeactivate(m *telebot.Message) {
-	if !utils.InWhiteList(m.Sender.ID, h.whiteList) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand("deactivate", outcome) }()
+
+	if !h.allowedIn(m) {
 		h.log.Info("Unauthorized user", zap.Int64("user_id", m.Sender.ID))
+		outcome = metrics.OutcomeUnauthorized
 		return
 	}
+	t := h.translator(m.Sender)
 
 	s := strings.Split(m.Text, " ")
 	if len(s) != 2 {
-		h.reply(m, "не розумію цю команду. Пліз юзай /deactivate <request_id>.")
+		h.reply(m, t(i18n.DeactivateUsage, nil))
+		outcome = metrics.OutcomeInvalid
 		return
 	}
 
@@ -239,75 +528,122 @@ func (h *handler) HandleDeactivate(m *telebot.Message) {
 	h.log.Info("Deactivating request", zap.String("id", id))
 
 	err := h.db.DeactivateRequest(context.Background(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		h.reply(m, t(i18n.DeactivateNotFound, i18n.Args{"ID": id}))
+		outcome = metrics.OutcomeInvalid
+		return
+	}
 	if err != nil {
 		h.log.Error("Failed to deactivate request", zap.Error(err))
-		h.reply(m, "не получилося деактивувати запит. Пліз спробуй ще раз пізніше.")
+		h.reply(m, t(i18n.DeactivateFailed, nil))
+		outcome = metrics.OutcomeError
 		return
 	}
 
-	h.reply(m, "Запит деактивовано, всьо капец.")
+	h.reply(m, t(i18n.Deactivated, nil))
 }
 
 func (h *handler) HandlePlaylist(m *telebot.Message) {
-	if !utils.InWhiteList(m.Sender.ID, h.whiteList) {
+	h.queuePlaylist(m, "p", func(db.UserPreferences) bool { return false })
+}
+
+func (h *handler) HandlePlaylistNoPull(m *telebot.Message) {
+	h.queuePlaylist(m, "pnp", func(db.UserPreferences) bool { return true })
+}
+
+// HandlePlaylistDefault queues a playlist in the mode the user picked in /settings
+func (h *handler) HandlePlaylistDefault(m *telebot.Message) {
+	h.queuePlaylist(m, "playlist", func(prefs db.UserPreferences) bool { return prefs.PlaylistNoPull })
+}
+
+func (h *handler) queuePlaylist(m *telebot.Message, command string, noPull func(db.UserPreferences) bool) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand(command, outcome) }()
+
+	if !h.allowedIn(m) {
 		h.log.Info("Unauthorized user", zap.Int64("user_id", m.Sender.ID))
+		outcome = metrics.OutcomeUnauthorized
 		return
 	}
+	t := h.translator(m.Sender)
 
 	h.log.Info("Received playlist request", zap.Any("message", m.Text))
 
 	msg := strings.Split(m.Text, " ")
 	if len(msg) != 2 {
-		h.reply(m, "не розумію цю команду. Пліз юзай /playlist <playlist_id>.")
+		h.reply(m, t(i18n.PlaylistUsage, nil))
+		outcome = metrics.OutcomeInvalid
 		return
 	}
 
 	playlistURL := msg[1]
 
 	if !utils.IsValidSpotifyURL(playlistURL) {
-		h.reply(m, "о ніііііі, це не посилання на спотіфай.... 💔😭")
+		h.reply(m, t(i18n.InvalidSpotifyURL, nil))
+		outcome = metrics.OutcomeInvalid
 		return
 	}
 
-	if err := h.db.NewPlaylistRequest(context.Background(), playlistURL, m.Sender.ID, false); err != nil {
+	ctx := context.Background()
+	prefs, err := h.db.GetUserPreferences(ctx, m.Sender.ID)
+	if err == nil {
+		err = h.db.NewPlaylistRequest(ctx, playlistURL, m.Sender.ID, requestChat(m), noPull(*prefs))
+	}
+	if err != nil {
 		h.log.Error("Failed to add playlist request to database", zap.Error(err))
-		h.reply(m, "не получилось додати в чергу, скажи максиму шо шось не так...")
+		h.reply(m, t(i18n.QueueAddFailed, nil))
+		outcome = metrics.OutcomeError
 		return
 	}
 
 	h.sendWebhook()
 
-	h.reply(m, "Ураураура успішно додали плейлист в чергу!!!!")
+	h.reply(m, t(i18n.PlaylistQueued, nil))
 }
 
-func (h *handler) HandlePlaylistNoPull(m *telebot.Message) {
-	if !utils.InWhiteList(m.Sender.ID, h.whiteList) {
+func (h *handler) HandleLang(m *telebot.Message) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand("lang", outcome) }()
+
+	if !h.allowedIn(m) {
 		h.log.Info("Unauthorized user", zap.Int64("user_id", m.Sender.ID))
+		outcome = metrics.OutcomeUnauthorized
 		return
 	}
 
-	h.log.Info("Received playlist request", zap.Any("message", m.Text))
+	t := h.translator(m.Sender)
+	catalog := h.current().Messages
+	available := strings.Join(catalog.Locales(), ", ")
 
-	msg := strings.Split(m.Text, " ")
-	if len(msg) != 2 {
-		h.reply(m, "не розумію цю команду. Пліз юзай /playlist <playlist_id>.")
+	args := strings.Fields(m.Text)
+	if len(args) != 2 {
+		h.reply(m, t(i18n.LangCurrent, i18n.Args{"Language": h.locale(m.Sender), "Available": available}))
+		if len(args) > 2 {
+			outcome = metrics.OutcomeInvalid
+		}
 		return
 	}
 
-	playlistURL := msg[1]
-
-	if !utils.IsValidSpotifyURL(playlistURL) {
-		h.reply(m, "о ніііііі, це не посилання на спотіфай.... 💔😭")
+	locale := strings.ToLower(args[1])
+	if !catalog.Supports(locale) {
+		h.reply(m, t(i18n.LangUnknown, i18n.Args{"Available": available}))
+		outcome = metrics.OutcomeInvalid
 		return
 	}
 
-	if err := h.db.NewPlaylistRequest(context.Background(), playlistURL, m.Sender.ID, true); err != nil {
-		h.log.Error("Failed to add playlist request to database", zap.Error(err))
-		h.reply(m, "не получилось додати в чергу, скажи максиму шо шось не так...")
+	ctx := context.Background()
+	prefs, err := h.db.GetUserPreferences(ctx, m.Sender.ID)
+	if err == nil {
+		prefs.Language = locale
+		err = h.db.SaveUserPreferences(ctx, *prefs)
+	}
+	if err != nil {
+		h.log.Error("Failed to save language", zap.Error(err), zap.Int64("user_id", m.Sender.ID))
+		h.reply(m, t(i18n.LangFailed, nil))
+		outcome = metrics.OutcomeError
 		return
 	}
 
-	h.sendWebhook()
-
-	h.reply(m, "Ураураура успішно додали плейлист в чергу!!!!")
+	// Confirm in the new language
+	h.reply(m, catalog.Text(locale, i18n.LangSet, nil))
 }
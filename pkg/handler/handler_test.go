@@ -0,0 +1,1447 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/i18n"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/reconcile"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/source"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/spotifysearch"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/spotifytest"
+	models "github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+	"go.uber.org/zap"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	allowedUser = int64(1)
+	strangerID  = int64(666)
+
+	albumURL    = "https://open.spotify.com/album/ok-computer"
+	playlistURL = "https://open.spotify.com/playlist/mix"
+	deezerURL   = "https://www.deezer.com/album/6575789"
+)
+
+var errBoom = errors.New("boom")
+
+type fakeSender struct {
+	mu        sync.Mutex
+	replies   []string
+	markups   []*telebot.ReplyMarkup
+	edits     []string
+	responses []string
+	answers   []*telebot.QueryResponse
+}
+
+func (s *fakeSender) Reply(to *telebot.Message, what interface{}, options ...interface{}) (*telebot.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if photo, ok := what.(*telebot.Photo); ok {
+		what = "[photo " + photo.FileURL + "] " + photo.Caption
+	}
+	if doc, ok := what.(*telebot.Document); ok {
+		content, _ := io.ReadAll(doc.FileReader)
+		what = "[document " + doc.FileName + "] " + doc.Caption + "\n" + string(content)
+	}
+	s.replies = append(s.replies, fmt.Sprint(what))
+	for _, o := range options {
+		if markup, ok := o.(*telebot.ReplyMarkup); ok {
+			s.markups = append(s.markups, markup)
+		}
+	}
+	return &telebot.Message{}, nil
+}
+
+func (s *fakeSender) Edit(msg telebot.Editable, what interface{}, options ...interface{}) (*telebot.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.edits = append(s.edits, fmt.Sprint(what))
+	for _, o := range options {
+		if markup, ok := o.(*telebot.ReplyMarkup); ok {
+			s.markups = append(s.markups, markup)
+		}
+	}
+	return &telebot.Message{}, nil
+}
+
+func (s *fakeSender) Respond(c *telebot.Callback, resp ...*telebot.CallbackResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range resp {
+		s.responses = append(s.responses, r.Text)
+	}
+	return nil
+}
+
+func (s *fakeSender) Answer(q *telebot.Query, resp *telebot.QueryResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.answers = append(s.answers, resp)
+	return nil
+}
+
+func (s *fakeSender) all() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return strings.Join(s.replies, "\n---\n")
+}
+
+// failingDB fails every call the handlers make
+type failingDB struct {
+	db.Database
+}
+
+func (failingDB) NewDownloadRequest(context.Context, string, string, string, int64, db.Chat, int, []spotify.TrackMetadata, []int) error {
+	return errBoom
+}
+
+func (failingDB) GetActiveRequests(context.Context) ([]models.DownloadQueueRequest, error) {
+	return nil, errBoom
+}
+
+func (failingDB) DeactivateRequest(context.Context, string) error { return errBoom }
+
+func (failingDB) NewPlaylistRequest(context.Context, string, int64, db.Chat, bool) error {
+	return errBoom
+}
+
+func (failingDB) GetUserRequests(context.Context, int64) ([]models.DownloadQueueRequest, error) {
+	return nil, errBoom
+}
+
+func (failingDB) GetDownloadRequest(context.Context, string) (*models.DownloadQueueRequest, error) {
+	return nil, errBoom
+}
+
+func (failingDB) SaveUserPreferences(context.Context, db.UserPreferences) error { return errBoom }
+
+func (failingDB) GetDetailedStats(context.Context, db.StatsOptions) (*db.DetailedStats, error) {
+	return nil, errBoom
+}
+
+func newCatalog(t *testing.T, overrides map[string]map[string]string) *i18n.Catalog {
+	t.Helper()
+
+	catalog, err := i18n.New(i18n.Ukrainian, overrides)
+	if err != nil {
+		t.Fatalf("i18n.New() unexpected error: %v", err)
+	}
+	return catalog
+}
+
+// fakeYouTube knows single videos only
+type fakeYouTube map[string]source.YouTubeVideo
+
+func (f fakeYouTube) Playlist(context.Context, string) (string, []source.YouTubeVideo, error) {
+	return "", nil, errBoom
+}
+
+func (f fakeYouTube) Video(_ context.Context, id string) (*source.YouTubeVideo, error) {
+	video, ok := f[id]
+	if !ok {
+		return nil, errBoom
+	}
+	return &video, nil
+}
+
+func (f fakeYouTube) AlbumPlaylistID(context.Context, string) (string, error) { return "", errBoom }
+
+// fakeDeezer knows one album, OK Computer
+type fakeDeezer struct{}
+
+func (fakeDeezer) Name() string { return source.Deezer }
+
+func (fakeDeezer) Match(link string) bool { return strings.HasPrefix(link, deezerURL) }
+
+func (fakeDeezer) Lookup(context.Context, string) (*source.Release, error) {
+	return &source.Release{Kind: spotifysearch.Album, Artist: "Radiohead", Title: "OK Computer"}, nil
+}
+
+// fakeSearch finds OK Computer, except for the queries "nothing", "boom", "verbose" and "skipped"
+type fakeSearch struct{}
+
+func (fakeSearch) Search(_ context.Context, query string, _ []string, _ int) ([]spotifysearch.Result, error) {
+	switch query {
+	case "nothing":
+		return nil, nil
+	case "boom":
+		return nil, errBoom
+	case "verbose":
+		return []spotifysearch.Result{{
+			Kind: spotifysearch.Album, Name: strings.Repeat("Long ", 250), Artist: "Radiohead", URL: albumURL,
+			ImageURL: "https://i.scdn.co/image/cover",
+		}}, nil
+	}
+	results := []spotifysearch.Result{
+		{
+			Kind: spotifysearch.Album, Name: "OK Computer", Artist: "Radiohead", URL: albumURL,
+			ImageURL: "https://i.scdn.co/image/cover", ReleaseDate: "1997-05-21", TrackCount: 12,
+		},
+		{Kind: spotifysearch.Playlist, Name: "Mix", Artist: "Spotify", URL: playlistURL},
+	}
+	// Results that aren't open.spotify.com links can't be queued and are skipped
+	broken := spotifysearch.Result{
+		Kind: spotifysearch.Track, Name: "Broken", URL: "https://example.com/track/1",
+		ImageURL: "https://i.scdn.co/image/broken",
+	}
+	if query == "skipped" {
+		return append([]spotifysearch.Result{broken}, results...), nil
+	}
+	return append(results, broken), nil
+}
+
+var okComputer = []spotify.TrackMetadata{
+	{Artist: "Radiohead", Title: "Airbag"},
+	{Artist: "Radiohead", Title: "Paranoid Android"},
+}
+
+type testEnv struct {
+	mem      *db.MemoryDatabase
+	spotify  *spotifytest.Fake
+	youtube  fakeYouTube
+	sender   *fakeSender
+	webhooks *atomic.Int32
+}
+
+func (e *testEnv) requests(t *testing.T) []models.DownloadQueueRequest {
+	t.Helper()
+
+	requests, err := e.mem.GetUserRequests(context.Background(), allowedUser)
+	if err != nil {
+		t.Fatalf("GetUserRequests() unexpected error: %v", err)
+	}
+	return requests
+}
+
+func (e *testEnv) seedAlbum(t *testing.T) models.DownloadQueueRequest {
+	t.Helper()
+
+	if err := e.mem.NewDownloadRequest(context.Background(), source.Spotify, albumURL, "OK Computer", allowedUser, db.Chat{}, len(okComputer), okComputer, nil); err != nil {
+		t.Fatalf("NewDownloadRequest() unexpected error: %v", err)
+	}
+	return e.requests(t)[0]
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		command func(h Handler) func(*telebot.Message)
+		text    string
+		sender  int64
+		// languageCode is the sender's Telegram client language
+		languageCode string
+		failDB       bool
+		setup        func(t *testing.T, e *testEnv) string
+		// reply must appear in the replies, empty means no reply at all
+		reply       string
+		wantWebhook bool
+		check       func(t *testing.T, e *testEnv)
+	}{
+		{
+			name:    "start greets whitelisted user",
+			command: func(h Handler) func(*telebot.Message) { return h.Start },
+			text:    "/start",
+			reply:   "кочає музіку",
+		},
+		{
+			name:         "start greets in the client language",
+			command:      func(h Handler) func(*telebot.Message) { return h.Start },
+			text:         "/start",
+			languageCode: "en-US",
+			reply:        "Send me a Spotify link",
+		},
+		{
+			name:         "start falls back to the default language",
+			command:      func(h Handler) func(*telebot.Message) { return h.Start },
+			text:         "/start",
+			languageCode: "de",
+			reply:        "кочає музіку",
+		},
+		{
+			name:         "stored language wins over the client language",
+			command:      func(h Handler) func(*telebot.Message) { return h.Start },
+			text:         "/start",
+			languageCode: "uk",
+			setup: func(t *testing.T, e *testEnv) string {
+				_ = e.mem.SaveUserPreferences(context.Background(), db.UserPreferences{UserID: allowedUser, Language: i18n.English})
+				return ""
+			},
+			reply: "Send me a Spotify link",
+		},
+		{
+			name:    "start ignores stranger",
+			command: func(h Handler) func(*telebot.Message) { return h.Start },
+			text:    "/start",
+			sender:  strangerID,
+		},
+		{
+			name:    "text ignores stranger",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:    albumURL,
+			sender:  strangerID,
+		},
+		{
+			name:    "text rejects unsupported link",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:    "https://example.com/album/1",
+			reply:   "з цього посилання я качати не вмію",
+		},
+		{
+			name:    "text enqueues youtube music track with its source",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:    "https://music.youtube.com/watch?v=airbag",
+			setup: func(t *testing.T, e *testEnv) string {
+				e.youtube["airbag"] = source.YouTubeVideo{Title: "Airbag", Channel: "Radiohead - Topic"}
+				return ""
+			},
+			reply:       "успішно додали Radiohead - Airbag в чергу! (Треків: 1)",
+			wantWebhook: true,
+			check: func(t *testing.T, e *testEnv) {
+				requests := e.requests(t)
+				if len(requests) != 1 || e.mem.Source(requests[0].ID) != source.YouTubeMusic {
+					t.Errorf("stored requests = %+v", requests)
+				}
+			},
+		},
+		{
+			name:    "text translates deezer link to spotify",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:    deezerURL,
+			setup: func(t *testing.T, e *testEnv) string {
+				e.spotify.AddObject(albumURL, "OK Computer", okComputer[0])
+				return ""
+			},
+			reply:       "знайшов на спотіфай: Radiohead - OK Computer\n" + albumURL,
+			wantWebhook: true,
+			check: func(t *testing.T, e *testEnv) {
+				requests := e.requests(t)
+				if len(requests) != 1 || requests[0].SpotifyURL != albumURL || e.mem.Source(requests[0].ID) != source.Spotify {
+					t.Errorf("stored requests = %+v", requests)
+				}
+				if !strings.Contains(e.sender.all(), "успішно додали OK Computer") {
+					t.Errorf("missing success reply, got %q", e.sender.all())
+				}
+			},
+		},
+		{
+			name:    "text reports youtube lookup failure",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:    "https://music.youtube.com/watch?v=missing",
+			reply:   "не получилось отримати інформацію по посиланню",
+		},
+		{
+			name:    "text enqueues single track with its metadata",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:    albumURL,
+			setup: func(t *testing.T, e *testEnv) string {
+				e.spotify.AddObject(albumURL, "Airbag", okComputer[0])
+				return ""
+			},
+			reply:       "успішно додали Airbag в чергу! (Треків: 1)",
+			wantWebhook: true,
+			check: func(t *testing.T, e *testEnv) {
+				requests := e.requests(t)
+				if len(requests) != 1 || requests[0].ExpectedTrackCount != 1 || len(requests[0].TrackMetadata) != 1 {
+					t.Errorf("stored requests = %+v", requests)
+				}
+			},
+		},
+		{
+			name:    "text offers to choose the tracks of an album",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:    albumURL,
+			setup: func(t *testing.T, e *testEnv) string {
+				e.spotify.AddObject(albumURL, "OK Computer", okComputer...)
+				return ""
+			},
+			reply: "💿 в OK Computer треків: 2. додати всі чи вибрати які?",
+			check: func(t *testing.T, e *testEnv) {
+				if requests := e.requests(t); len(requests) != 0 {
+					t.Errorf("queued before choosing: %+v", requests)
+				}
+				if len(e.sender.markups) != 1 || len(e.sender.markups[0].InlineKeyboard[0]) != 2 {
+					t.Errorf("offer keyboard = %+v", e.sender.markups)
+				}
+			},
+		},
+		{
+			name:    "text fails when spotify name lookup fails",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:    albumURL,
+			setup: func(t *testing.T, e *testEnv) string {
+				e.spotify.FailName(albumURL, errBoom)
+				return ""
+			},
+			reply: "не получилось отримати інформацію зі спотіфай",
+			check: func(t *testing.T, e *testEnv) {
+				if len(e.requests(t)) != 0 {
+					t.Error("request stored despite name lookup failure")
+				}
+			},
+		},
+		{
+			name:    "partial metadata failure still enqueues",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:    albumURL,
+			setup: func(t *testing.T, e *testEnv) string {
+				e.spotify.AddObject(albumURL, "OK Computer", okComputer...)
+				e.spotify.FailTracks(albumURL, errBoom)
+				return ""
+			},
+			reply:       "не получилось отримати кількість треків, але додав в чергу",
+			wantWebhook: true,
+			check: func(t *testing.T, e *testEnv) {
+				requests := e.requests(t)
+				if len(requests) != 1 || requests[0].ExpectedTrackCount != 0 || requests[0].TrackMetadata != nil {
+					t.Errorf("stored requests = %+v", requests)
+				}
+				if !strings.Contains(e.sender.all(), "(Треків: 0)") {
+					t.Errorf("missing success reply, got %q", e.sender.all())
+				}
+			},
+		},
+		{
+			name:    "text reports database failure",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:    albumURL,
+			failDB:  true,
+			setup: func(t *testing.T, e *testEnv) string {
+				e.spotify.AddObject(albumURL, "OK Computer", okComputer[0])
+				return ""
+			},
+			reply: "не получилось додати в чергу",
+		},
+		{
+			name:    "queue ignores stranger",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleQueue },
+			text:    "/queue",
+			sender:  strangerID,
+		},
+		{
+			name:    "queue is empty",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleQueue },
+			text:    "/queue",
+			reply:   "немає активних запитів",
+		},
+		{
+			name:    "queue reports database failure",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleQueue },
+			text:    "/queue",
+			failDB:  true,
+			reply:   "не получилося дістати чергу",
+		},
+		{
+			name:    "queue shows progress",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleQueue },
+			text:    "/queue",
+			setup: func(t *testing.T, e *testEnv) string {
+				e.seedAlbum(t)
+				e.mem.AddMusicFiles(models.MusicFile{Artist: "Radiohead", Title: "Airbag"})
+				return ""
+			},
+			reply: "Завантажено: 1/2 (50%)",
+			check: func(t *testing.T, e *testEnv) {
+				r := e.requests(t)[0]
+				if !r.Active || r.FoundTrackCount != 1 {
+					t.Errorf("request = %+v, want active with 1 found track", r)
+				}
+			},
+		},
+		{
+			name:    "queue completes fully downloaded request",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleQueue },
+			text:    "/queue",
+			setup: func(t *testing.T, e *testEnv) string {
+				e.seedAlbum(t)
+				e.mem.AddMusicFiles(
+					models.MusicFile{Artist: "Radiohead", Title: "Airbag"},
+					models.MusicFile{Artist: "Radiohead", Title: "Paranoid Android"},
+				)
+				return ""
+			},
+			reply: "Всі треки завантажені",
+			check: func(t *testing.T, e *testEnv) {
+				r := e.requests(t)[0]
+				if r.Active || r.FoundTrackCount != 2 {
+					t.Errorf("request = %+v, want completed", r)
+				}
+			},
+		},
+		{
+			name:    "mine with no requests",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleMine },
+			text:    "/mine",
+			reply:   "ти ще нічого не додавав",
+		},
+		{
+			name:    "mine lists requests and totals",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleMine },
+			text:    "/mine",
+			setup: func(t *testing.T, e *testEnv) string {
+				e.seedAlbum(t)
+				return ""
+			},
+			reply: "Всього запитів: 1",
+		},
+		{
+			name:    "mine reports database failure",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleMine },
+			text:    "/mine",
+			failDB:  true,
+			reply:   "не получилося дістати твої запити",
+		},
+		{
+			name:    "stats with default window",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleStats },
+			text:    "/stats",
+			setup: func(t *testing.T, e *testEnv) string {
+				e.seedAlbum(t)
+				return ""
+			},
+			reply: "Нових запитів: 1",
+		},
+		{
+			name:    "stats rejects bad window",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleStats },
+			text:    "/stats yesterday",
+			reply:   "не розумію цей період",
+		},
+		{
+			name:    "stats rejects extra arguments",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleStats },
+			text:    "/stats 7d 8d",
+			reply:   "не розумію цю команду",
+		},
+		{
+			name:    "stats reports database failure",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleStats },
+			text:    "/stats 7d",
+			failDB:  true,
+			reply:   "не получилося порахувати статистику",
+		},
+		{
+			name:    "deactivate requires an id",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleDeactivate },
+			text:    "/deactivate",
+			reply:   "Пліз юзай /deactivate <request_id>",
+		},
+		{
+			name:    "deactivate unknown request",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleDeactivate },
+			text:    "/deactivate missing",
+			reply:   "нема запиту з id missing",
+		},
+		{
+			name:    "deactivate reports database failure",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleDeactivate },
+			text:    "/deactivate missing",
+			failDB:  true,
+			reply:   "не получилося деактивувати запит",
+		},
+		{
+			name:    "deactivate request",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleDeactivate },
+			setup: func(t *testing.T, e *testEnv) string {
+				return "/deactivate " + e.seedAlbum(t).ID
+			},
+			reply: "Запит деактивовано",
+			check: func(t *testing.T, e *testEnv) {
+				if e.requests(t)[0].Active {
+					t.Error("request still active")
+				}
+			},
+		},
+		{
+			name:    "playlist requires a url",
+			command: func(h Handler) func(*telebot.Message) { return h.HandlePlaylist },
+			text:    "/p",
+			reply:   "не розумію цю команду",
+		},
+		{
+			name:    "playlist rejects non spotify link",
+			command: func(h Handler) func(*telebot.Message) { return h.HandlePlaylist },
+			text:    "/p https://example.com/playlist/1",
+			reply:   "це не посилання на спотіфай",
+		},
+		{
+			name:    "playlist reports database failure",
+			command: func(h Handler) func(*telebot.Message) { return h.HandlePlaylist },
+			text:    "/p " + playlistURL,
+			failDB:  true,
+			reply:   "не получилось додати в чергу",
+		},
+		{
+			name:        "playlist enqueued with pull",
+			command:     func(h Handler) func(*telebot.Message) { return h.HandlePlaylist },
+			text:        "/p " + playlistURL,
+			reply:       "успішно додали плейлист",
+			wantWebhook: true,
+			check: func(t *testing.T, e *testEnv) {
+				playlists := e.mem.PlaylistRequests()
+				if len(playlists) != 1 || playlists[0].NoPull || playlists[0].SpotifyURL != playlistURL {
+					t.Errorf("stored playlists = %+v", playlists)
+				}
+			},
+		},
+		{
+			name:        "playlist enqueued without pull",
+			command:     func(h Handler) func(*telebot.Message) { return h.HandlePlaylistNoPull },
+			text:        "/pnp " + playlistURL,
+			reply:       "успішно додали плейлист",
+			wantWebhook: true,
+			check: func(t *testing.T, e *testEnv) {
+				playlists := e.mem.PlaylistRequests()
+				if len(playlists) != 1 || !playlists[0].NoPull {
+					t.Errorf("stored playlists = %+v", playlists)
+				}
+			},
+		},
+		{
+			name:    "playlist without pull requires a url",
+			command: func(h Handler) func(*telebot.Message) { return h.HandlePlaylistNoPull },
+			text:    "/pnp",
+			reply:   "не розумію цю команду",
+		},
+		{
+			name:        "playlist pulls by default",
+			command:     func(h Handler) func(*telebot.Message) { return h.HandlePlaylistDefault },
+			text:        "/playlist " + playlistURL,
+			reply:       "успішно додали плейлист",
+			wantWebhook: true,
+			check: func(t *testing.T, e *testEnv) {
+				playlists := e.mem.PlaylistRequests()
+				if len(playlists) != 1 || playlists[0].NoPull {
+					t.Errorf("stored playlists = %+v", playlists)
+				}
+			},
+		},
+		{
+			name:    "playlist follows the stored mode",
+			command: func(h Handler) func(*telebot.Message) { return h.HandlePlaylistDefault },
+			text:    "/playlist " + playlistURL,
+			setup: func(t *testing.T, e *testEnv) string {
+				_ = e.mem.SaveUserPreferences(context.Background(), db.UserPreferences{UserID: allowedUser, PlaylistNoPull: true})
+				return ""
+			},
+			reply:       "успішно додали плейлист",
+			wantWebhook: true,
+			check: func(t *testing.T, e *testEnv) {
+				playlists := e.mem.PlaylistRequests()
+				if len(playlists) != 1 || !playlists[0].NoPull {
+					t.Errorf("stored playlists = %+v", playlists)
+				}
+			},
+		},
+		{
+			name:    "settings shows the menu",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleSettings },
+			text:    "/settings",
+			reply:   "Налаштування",
+			check: func(t *testing.T, e *testEnv) {
+				if len(e.sender.markups) != 1 || len(e.sender.markups[0].InlineKeyboard) != 5 {
+					t.Errorf("settings markup = %+v, want 5 button rows", e.sender.markups)
+				}
+			},
+		},
+		{
+			name:    "settings ignores stranger",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleSettings },
+			text:    "/settings",
+			sender:  strangerID,
+		},
+		{
+			name:    "lang shows current and available languages",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleLang },
+			text:    "/lang",
+			reply:   "Мова: uk. Доступні: en, uk.",
+		},
+		{
+			name:    "lang stores the choice",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleLang },
+			text:    "/lang EN",
+			reply:   "I'll speak English",
+			check: func(t *testing.T, e *testEnv) {
+				prefs, _ := e.mem.GetUserPreferences(context.Background(), allowedUser)
+				if prefs.Language != i18n.English {
+					t.Errorf("stored language = %q, want %q", prefs.Language, i18n.English)
+				}
+			},
+		},
+		{
+			name:    "lang rejects unknown language",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleLang },
+			text:    "/lang de",
+			reply:   "не знаю такої мови. Доступні: en, uk.",
+		},
+		{
+			name:    "lang reports save failure",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleLang },
+			text:    "/lang en",
+			failDB:  true,
+			reply:   "не получилося зберегти мову",
+		},
+		{
+			name:    "find needs a query",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleFind },
+			text:    "/find  ",
+			reply:   "а шо шукати?",
+		},
+		{
+			name:    "find lists results under the top cover",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleFind },
+			text:    "/find radiohead ok computer",
+			reply: "[photo https://i.scdn.co/image/cover] 🔎 ось шо знайшов в спотіфай по \"radiohead ok computer\", тицяй щоб додати в чергу:\n\n" +
+				"1. 💿 OK Computer — Radiohead (1997), треків: 12\n" +
+				"2. 📜 Mix — Spotify\n",
+			check: func(t *testing.T, e *testEnv) {
+				if len(e.sender.markups) != 1 || len(e.sender.markups[0].InlineKeyboard) != 2 {
+					t.Fatalf("markups = %+v", e.sender.markups)
+				}
+				button := e.sender.markups[0].InlineKeyboard[0][0]
+				if button.Data != "spotify:album:ok-computer" || button.Text != "1. 💿 OK Computer — Radiohead" {
+					t.Errorf("first button = %+v", button)
+				}
+			},
+		},
+		{
+			name:    "find truncates a long query",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleFind },
+			text:    "/find " + strings.Repeat("a", 100),
+			reply:   "по \"" + strings.Repeat("a", 63) + "…\"",
+		},
+		{
+			name:    "find sends a list too long for a caption as text",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleFind },
+			text:    "/find verbose",
+			reply:   "1. 💿 Long",
+			check: func(t *testing.T, e *testEnv) {
+				if strings.Contains(e.sender.all(), "[photo") {
+					t.Errorf("replies = %q, want the list without a cover", e.sender.all())
+				}
+			},
+		},
+		{
+			name:    "find takes the cover from the first listed result",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleFind },
+			text:    "/find skipped",
+			reply:   "[photo https://i.scdn.co/image/cover]",
+		},
+		{
+			name:    "find without results",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleFind },
+			text:    "/find nothing",
+			reply:   "нічого не знайшов в спотіфай",
+		},
+		{
+			name:    "find reports search failure",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleFind },
+			text:    "/find boom",
+			reply:   "не получилось пошукати в спотіфай",
+		},
+		{
+			name:    "find ignores stranger",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleFind },
+			text:    "/find radiohead",
+			sender:  strangerID,
+		},
+		{
+			name:    "export requires a request id",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleExport },
+			text:    "/export",
+			reply:   "Пліз юзай /export <request_id>",
+		},
+		{
+			name:    "export unknown request",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleExport },
+			text:    "/export missing",
+			reply:   "нема запиту з такою айдішкою",
+		},
+		{
+			name:    "export reports database failure",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleExport },
+			text:    "/export missing",
+			failDB:  true,
+			reply:   "не получилось зробити плейлист",
+		},
+		{
+			name:    "export request with nothing downloaded",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleExport },
+			setup: func(t *testing.T, e *testEnv) string {
+				return "/export " + e.seedAlbum(t).ID
+			},
+			reply: "з OK Computer ще нічого не скачалось",
+		},
+		{
+			name:    "export sends downloaded tracks as a playlist",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleExport },
+			setup: func(t *testing.T, e *testEnv) string {
+				e.mem.AddMusicFiles(models.MusicFile{Artist: "Radiohead", Title: "Airbag", Path: "/music/01 Airbag.flac", Duration: 284})
+				return "/export " + e.seedAlbum(t).ID
+			},
+			reply: "[document OK Computer.m3u8] 🎧 OK Computer: треків 1 з 2\n" +
+				"#EXTM3U\n#PLAYLIST:OK Computer\n#EXTINF:284,Radiohead - Airbag\n/music/01 Airbag.flac\n",
+		},
+		{
+			name:    "export ignores stranger",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleExport },
+			text:    "/export missing",
+			sender:  strangerID,
+		},
+		{
+			name:    "lang ignores stranger",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleLang },
+			text:    "/lang en",
+			sender:  strangerID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &testEnv{
+				mem:      db.NewMemoryDatabase(),
+				spotify:  spotifytest.NewFake(),
+				youtube:  fakeYouTube{},
+				sender:   &fakeSender{},
+				webhooks: &atomic.Int32{},
+			}
+
+			webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				env.webhooks.Add(1)
+			}))
+			defer webhook.Close()
+
+			text := tt.text
+			if tt.setup != nil {
+				if cmd := tt.setup(t, env); cmd != "" {
+					text = cmd
+				}
+			}
+
+			var database db.Database = env.mem
+			if tt.failDB {
+				database = failingDB{Database: env.mem}
+			}
+
+			h := NewHandler(database, reconcile.New(database, zap.NewNop()), zap.NewNop(), env.sender, Settings{
+				WhiteList:   []int64{allowedUser},
+				DoneWebhook: webhook.URL,
+				Sources: source.Resolvers{
+					source.NewSpotify(env.spotify),
+					source.NewYouTubeMusic(env.youtube),
+					source.NewTranslator(fakeDeezer{}, fakeSearch{}, source.NewSpotify(env.spotify)),
+				},
+				Search:   fakeSearch{},
+				Messages: newCatalog(t, nil),
+			})
+
+			sender := tt.sender
+			if sender == 0 {
+				sender = allowedUser
+			}
+			tt.command(h)(&telebot.Message{Text: text, Sender: &telebot.User{ID: sender, LanguageCode: tt.languageCode}})
+
+			replies := env.sender.all()
+			if tt.reply == "" && replies != "" {
+				t.Errorf("expected no reply, got %q", replies)
+			}
+			if !strings.Contains(replies, tt.reply) {
+				t.Errorf("replies %q do not contain %q", replies, tt.reply)
+			}
+			if got := env.webhooks.Load() > 0; got != tt.wantWebhook {
+				t.Errorf("webhook called = %v, want %v", got, tt.wantWebhook)
+			}
+			if tt.check != nil {
+				tt.check(t, env)
+			}
+		})
+	}
+}
+
+func TestHandler_ExportToDir(t *testing.T) {
+	sender := &fakeSender{}
+	mem := db.NewMemoryDatabase()
+	dir := t.TempDir()
+	h := NewHandler(mem, reconcile.New(mem, zap.NewNop()), zap.NewNop(), sender, Settings{
+		WhiteList:   []int64{allowedUser},
+		PlaylistDir: dir,
+		Messages:    newCatalog(t, nil),
+	})
+
+	env := &testEnv{mem: mem}
+	request := env.seedAlbum(t)
+	mem.AddMusicFiles(models.MusicFile{Artist: "Radiohead", Title: "Paranoid Android", Path: "/music/02 Paranoid Android.flac"})
+
+	h.HandleExport(&telebot.Message{Text: "/export " + request.ID, Sender: &telebot.User{ID: allowedUser}})
+
+	path := filepath.Join(dir, "OK Computer.m3u8")
+	if expected := "💾 зберіг " + path + ": треків 1 з 2"; sender.all() != expected {
+		t.Errorf("reply = %q, want %q", sender.all(), expected)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() unexpected error: %v", err)
+	}
+	if !strings.Contains(string(content), "/music/02 Paranoid Android.flac") {
+		t.Errorf("saved playlist = %q", content)
+	}
+}
+
+func TestHandler_Reload(t *testing.T) {
+	sender := &fakeSender{}
+	mem := db.NewMemoryDatabase()
+	h := NewHandler(mem, reconcile.New(mem, zap.NewNop()), zap.NewNop(), sender, Settings{WhiteList: []int64{allowedUser}, Messages: newCatalog(t, nil)})
+	start := func(id int64) { h.Start(&telebot.Message{Sender: &telebot.User{ID: id}}) }
+
+	start(strangerID)
+	if replies := sender.all(); replies != "" {
+		t.Fatalf("stranger got a reply before reload: %q", replies)
+	}
+
+	overrides := map[string]map[string]string{i18n.Ukrainian: {i18n.Welcome: "Вітаю на сервері"}}
+	h.Reload(Settings{WhiteList: []int64{strangerID}, Messages: newCatalog(t, overrides)})
+
+	start(strangerID)
+	if replies := sender.all(); replies != "Вітаю на сервері" {
+		t.Errorf("reply after reload = %q, want the overridden welcome", replies)
+	}
+
+	sender.replies = nil
+	start(allowedUser)
+	if replies := sender.all(); replies != "" {
+		t.Errorf("removed user still got a reply: %q", replies)
+	}
+}
+
+func TestHandler_SettingsCallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		presses  []string
+		sender   int64
+		expected db.UserPreferences
+		menu     string
+	}{
+		{
+			name:     "completion notifications",
+			presses:  []string{settingNotifyCompletion},
+			expected: db.UserPreferences{NotifyCompletion: true},
+			menu:     "Коли запит завершено: так",
+		},
+		{
+			name:     "progress notifications toggle back off",
+			presses:  []string{settingNotifyProgress, settingNotifyProgress},
+			expected: db.UserPreferences{},
+			menu:     "Прогрес завантаження: ні",
+		},
+		{
+			name:     "playlist mode",
+			presses:  []string{settingPlaylistMode},
+			expected: db.UserPreferences{PlaylistNoPull: true},
+			menu:     "без докачування",
+		},
+		{
+			name:     "quiet hours cycle",
+			presses:  []string{settingQuietHours, settingQuietHours},
+			expected: db.UserPreferences{QuietFrom: 23, QuietTo: 7},
+			menu:     "Тихі години: 23:00–07:00 за часом сервера",
+		},
+		{
+			name:     "language switches the menu",
+			presses:  []string{settingLanguage},
+			expected: db.UserPreferences{Language: i18n.English},
+			menu:     "Quiet hours: off",
+		},
+		{
+			name:     "stranger",
+			presses:  []string{settingNotifyCompletion},
+			sender:   strangerID,
+			expected: db.UserPreferences{},
+		},
+		{
+			name:     "unknown setting",
+			presses:  []string{"volume"},
+			expected: db.UserPreferences{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := db.NewMemoryDatabase()
+			sender := &fakeSender{}
+			h := NewHandler(mem, reconcile.New(mem, zap.NewNop()), zap.NewNop(), sender, Settings{
+				WhiteList: []int64{allowedUser},
+				Messages:  newCatalog(t, nil),
+			})
+
+			user := tt.sender
+			if user == 0 {
+				user = allowedUser
+			}
+			for _, setting := range tt.presses {
+				h.HandleSettingsCallback(&telebot.Callback{Sender: &telebot.User{ID: user}, Data: setting, Message: &telebot.Message{}})
+			}
+
+			prefs, _ := mem.GetUserPreferences(context.Background(), user)
+			tt.expected.UserID = user
+			tt.expected.UpdatedAt = prefs.UpdatedAt
+			if *prefs != tt.expected {
+				t.Errorf("stored preferences = %+v, want %+v", *prefs, tt.expected)
+			}
+
+			if tt.menu == "" {
+				if len(sender.edits) != 0 {
+					t.Errorf("menu edited %d times, want 0", len(sender.edits))
+				}
+				for _, r := range sender.responses {
+					if r != "" {
+						t.Errorf("responses = %q, want no confirmation", sender.responses)
+					}
+				}
+				return
+			}
+			if len(sender.edits) != len(tt.presses) || len(sender.responses) != len(tt.presses) {
+				t.Fatalf("got %d edits and %d responses, want %d each", len(sender.edits), len(sender.responses), len(tt.presses))
+			}
+			var labels []string
+			for _, row := range sender.markups[len(sender.markups)-1].InlineKeyboard {
+				labels = append(labels, row[0].Text)
+			}
+			if menu := strings.Join(labels, "\n"); !strings.Contains(menu, tt.menu) {
+				t.Errorf("menu %q does not contain %q", menu, tt.menu)
+			}
+		})
+	}
+}
+
+func TestHandler_Group(t *testing.T) {
+	const (
+		groupID   = int64(-1001234567890)
+		messageID = 42
+	)
+	group := &telebot.Chat{ID: groupID, Type: telebot.ChatSuperGroup}
+
+	tests := []struct {
+		name    string
+		command func(h Handler) func(*telebot.Message)
+		text    string
+		sender  int64
+		chat    *telebot.Chat
+		groups  []int64
+		// reply must appear in the replies, empty means no reply at all
+		reply    string
+		expected *db.Chat
+	}{
+		{
+			name:    "chatter is ignored",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:    "anyone up for a gig tonight?",
+			chat:    group,
+		},
+		{
+			name:    "unsupported link is ignored",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:    "https://example.com/album/1",
+			chat:    group,
+		},
+		{
+			name:     "link is queued for the group",
+			command:  func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:     albumURL,
+			chat:     group,
+			reply:    "успішно додали OK Computer в чергу!",
+			expected: &db.Chat{ID: groupID, MessageID: messageID},
+		},
+		{
+			name:    "stranger's link is ignored",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:    albumURL,
+			sender:  strangerID,
+			chat:    group,
+		},
+		{
+			name:     "whitelisted group",
+			command:  func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:     albumURL,
+			chat:     group,
+			groups:   []int64{groupID},
+			reply:    "успішно додали OK Computer в чергу!",
+			expected: &db.Chat{ID: groupID, MessageID: messageID},
+		},
+		{
+			name:    "group off the whitelist is ignored",
+			command: func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:    albumURL,
+			chat:    group,
+			groups:  []int64{-100},
+		},
+		{
+			name:    "commands follow the group whitelist",
+			command: func(h Handler) func(*telebot.Message) { return h.Start },
+			text:    "/start@albumqueuebot",
+			chat:    group,
+			groups:  []int64{-100},
+		},
+		{
+			name:     "private chats ignore the group whitelist",
+			command:  func(h Handler) func(*telebot.Message) { return h.HandleText },
+			text:     albumURL,
+			chat:     &telebot.Chat{ID: allowedUser, Type: telebot.ChatPrivate},
+			groups:   []int64{-100},
+			reply:    "успішно додали OK Computer в чергу!",
+			expected: &db.Chat{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := db.NewMemoryDatabase()
+			sender := &fakeSender{}
+			spotifyService := spotifytest.NewFake().AddObject(albumURL, "OK Computer", okComputer[0])
+			webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer webhook.Close()
+
+			h := NewHandler(mem, reconcile.New(mem, zap.NewNop()), zap.NewNop(), sender, Settings{
+				WhiteList:      []int64{allowedUser},
+				GroupWhiteList: tt.groups,
+				DoneWebhook:    webhook.URL,
+				Sources:        source.Resolvers{source.NewSpotify(spotifyService)},
+				Messages:       newCatalog(t, nil),
+			})
+
+			user := tt.sender
+			if user == 0 {
+				user = allowedUser
+			}
+			tt.command(h)(&telebot.Message{ID: messageID, Text: tt.text, Sender: &telebot.User{ID: user}, Chat: tt.chat})
+
+			replies := sender.all()
+			if !strings.Contains(replies, tt.reply) || (tt.reply == "" && replies != "") {
+				t.Errorf("replies = %q, want %q", replies, tt.reply)
+			}
+
+			requests, err := mem.GetUserRequests(context.Background(), user)
+			if err != nil {
+				t.Fatalf("GetUserRequests() unexpected error: %v", err)
+			}
+			if tt.expected == nil {
+				if len(requests) != 0 {
+					t.Errorf("stored requests = %+v, want none", requests)
+				}
+				return
+			}
+			if len(requests) != 1 {
+				t.Fatalf("stored requests = %+v, want one", requests)
+			}
+			chat, err := mem.GetRequestChat(context.Background(), requests[0].ID)
+			if err != nil {
+				t.Fatalf("GetRequestChat() unexpected error: %v", err)
+			}
+			if chat != *tt.expected {
+				t.Errorf("GetRequestChat() = %+v, want %+v", chat, *tt.expected)
+			}
+		})
+	}
+}
+
+func TestHandler_GroupPlaylist(t *testing.T) {
+	const (
+		groupID   = int64(-1001234)
+		messageID = 42
+	)
+
+	for _, command := range []func(h Handler) func(*telebot.Message){
+		func(h Handler) func(*telebot.Message) { return h.HandlePlaylist },
+		func(h Handler) func(*telebot.Message) { return h.HandlePlaylistNoPull },
+		func(h Handler) func(*telebot.Message) { return h.HandlePlaylistDefault },
+	} {
+		mem := db.NewMemoryDatabase()
+		webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		h := NewHandler(mem, reconcile.New(mem, zap.NewNop()), zap.NewNop(), &fakeSender{}, Settings{
+			WhiteList:   []int64{allowedUser},
+			DoneWebhook: webhook.URL,
+			Messages:    newCatalog(t, nil),
+		})
+
+		command(h)(&telebot.Message{
+			ID:     messageID,
+			Text:   "/p " + playlistURL,
+			Sender: &telebot.User{ID: allowedUser},
+			Chat:   &telebot.Chat{ID: groupID, Type: telebot.ChatSuperGroup},
+		})
+		webhook.Close()
+
+		playlists := mem.PlaylistRequests()
+		if len(playlists) != 1 || playlists[0].CreatorID != allowedUser {
+			t.Fatalf("stored playlists = %+v, want one by the sender", playlists)
+		}
+		if chat := mem.PlaylistChat(playlists[0].ID); chat != (db.Chat{ID: groupID, MessageID: messageID}) {
+			t.Errorf("PlaylistChat() = %+v, want the group", chat)
+		}
+	}
+}
+
+func TestHandler_FindCallback(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		sender int64
+		reply  string
+		stored string
+	}{
+		{
+			name:   "tap queues the result",
+			data:   "spotify:album:ok-computer",
+			reply:  "успішно додали OK Computer в чергу! (Треків: 1)",
+			stored: albumURL,
+		},
+		{
+			name: "malformed data",
+			data: "album:ok-computer",
+		},
+		{
+			name:   "stranger",
+			data:   "spotify:album:ok-computer",
+			sender: strangerID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := db.NewMemoryDatabase()
+			sender := &fakeSender{}
+			spotifyService := spotifytest.NewFake().AddObject(albumURL, "OK Computer", okComputer[0])
+			webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer webhook.Close()
+
+			h := NewHandler(mem, reconcile.New(mem, zap.NewNop()), zap.NewNop(), sender, Settings{
+				WhiteList:   []int64{allowedUser},
+				DoneWebhook: webhook.URL,
+				Sources:     source.Resolvers{source.NewSpotify(spotifyService)},
+				Messages:    newCatalog(t, nil),
+			})
+
+			user := tt.sender
+			if user == 0 {
+				user = allowedUser
+			}
+			h.HandleFindCallback(&telebot.Callback{Sender: &telebot.User{ID: user}, Data: tt.data, Message: &telebot.Message{}})
+
+			if !strings.Contains(sender.all(), tt.reply) || (tt.reply == "" && sender.all() != "") {
+				t.Errorf("replies = %q, want %q", sender.all(), tt.reply)
+			}
+			requests, err := mem.GetUserRequests(context.Background(), user)
+			if err != nil {
+				t.Fatalf("GetUserRequests() unexpected error: %v", err)
+			}
+			if tt.stored == "" && len(requests) != 0 || tt.stored != "" && (len(requests) != 1 || requests[0].SpotifyURL != tt.stored) {
+				t.Errorf("stored requests = %+v, want %q", requests, tt.stored)
+			}
+		})
+	}
+}
+
+func TestHandler_Pick(t *testing.T) {
+	const otherUser = int64(2)
+	compilation := make([]spotify.TrackMetadata, 10)
+	for i := range compilation {
+		compilation[i] = spotify.TrackMetadata{Artist: fmt.Sprintf("Artist %d", i+1), Title: fmt.Sprintf("Song %d", i+1)}
+	}
+
+	mem := db.NewMemoryDatabase()
+	sender := &fakeSender{}
+	spotifyService := spotifytest.NewFake().AddObject(albumURL, "Compilation", compilation...)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer webhook.Close()
+
+	h := NewHandler(mem, reconcile.New(mem, zap.NewNop()), zap.NewNop(), sender, Settings{
+		WhiteList:   []int64{allowedUser, otherUser},
+		DoneWebhook: webhook.URL,
+		Sources:     source.Resolvers{source.NewSpotify(spotifyService)},
+		Messages:    newCatalog(t, nil),
+	})
+
+	// press taps the button of the last keyboard whose text contains label
+	press := func(t *testing.T, user int64, label string) string {
+		t.Helper()
+
+		markup := sender.markups[len(sender.markups)-1]
+		for _, row := range markup.InlineKeyboard {
+			for _, b := range row {
+				if strings.Contains(b.Text, label) {
+					before := len(sender.responses)
+					h.HandlePickCallback(&telebot.Callback{Sender: &telebot.User{ID: user}, Data: b.Data, Message: &telebot.Message{}})
+					return strings.Join(sender.responses[before:], "")
+				}
+			}
+		}
+		t.Fatalf("no %q button in %+v", label, markup.InlineKeyboard)
+		return ""
+	}
+	offer := func(t *testing.T) {
+		t.Helper()
+		h.HandleText(&telebot.Message{Text: albumURL, Sender: &telebot.User{ID: allowedUser}})
+		if reply := sender.replies[len(sender.replies)-1]; reply != "💿 в Compilation треків: 10. додати всі чи вибрати які?" {
+			t.Fatalf("offer = %q", reply)
+		}
+	}
+	requests := func() []models.DownloadQueueRequest {
+		requests, _ := mem.GetUserRequests(context.Background(), allowedUser)
+		return requests
+	}
+
+	t.Run("chosen tracks across pages are queued", func(t *testing.T) {
+		offer(t)
+		press(t, allowedUser, "вибрати треки")
+
+		keyboard := sender.markups[len(sender.markups)-1].InlineKeyboard
+		if len(keyboard) != pickPageSize+2 || keyboard[pickPageSize][0].Text != "1/2" {
+			t.Fatalf("first page = %+v", keyboard)
+		}
+		if toast := press(t, otherUser, "Song 2 "); toast != "вибирати може тільки той, хто скинув посилання" {
+			t.Errorf("someone else's tap answered %q", toast)
+		}
+		press(t, allowedUser, "Song 2 ")
+		press(t, allowedUser, "▶️")
+		press(t, allowedUser, "Song 10 ")
+		if header := sender.edits[len(sender.edits)-1]; header != "☑️ вибери треки з Compilation, вибрано 2 з 10:" {
+			t.Errorf("menu header = %q", header)
+		}
+		press(t, allowedUser, "додати 2")
+
+		if len(requests()) != 1 {
+			t.Fatalf("stored requests = %+v", requests())
+		}
+		r := requests()[0]
+		expected := []spotify.TrackMetadata{compilation[1], compilation[9]}
+		if r.ExpectedTrackCount != 2 || len(r.TrackMetadata) != 2 || r.TrackMetadata[0] != expected[0] || r.TrackMetadata[1] != expected[1] {
+			t.Errorf("stored request = %+v", r)
+		}
+		if selection := mem.Selection(r.ID); len(selection) != 2 || selection[0] != 1 || selection[1] != 9 {
+			t.Errorf("selection = %v, want [1 9]", selection)
+		}
+		if edit := sender.edits[len(sender.edits)-1]; !strings.Contains(edit, "успішно додали Compilation в чергу! (Треків: 2)") {
+			t.Errorf("offer edited to %q", edit)
+		}
+		if toast := press(t, allowedUser, "додати 2"); toast != "цей вибір вже застарів, скинь посилання ще раз" {
+			t.Errorf("tap on an answered offer answered %q", toast)
+		}
+	})
+
+	t.Run("nothing chosen", func(t *testing.T) {
+		offer(t)
+		press(t, allowedUser, "вибрати треки")
+		if toast := press(t, allowedUser, "додати 0"); toast != "вибери хоча б один трек" {
+			t.Errorf("empty choice answered %q", toast)
+		}
+		press(t, allowedUser, "відміна")
+
+		if edit := sender.edits[len(sender.edits)-1]; edit != "ок, з Compilation нічого не додаю" {
+			t.Errorf("offer edited to %q", edit)
+		}
+		if len(requests()) != 1 {
+			t.Errorf("cancelled offer stored a request: %+v", requests())
+		}
+	})
+
+	t.Run("queue all", func(t *testing.T) {
+		offer(t)
+		press(t, allowedUser, "додати всі")
+
+		stored := requests()
+		whole := slices.IndexFunc(stored, func(r models.DownloadQueueRequest) bool {
+			return r.ExpectedTrackCount == 10 && len(r.TrackMetadata) == 10 && mem.Selection(r.ID) == nil
+		})
+		if len(stored) != 2 || whole < 0 {
+			t.Errorf("stored requests = %+v", stored)
+		}
+	})
+}
+
+func TestHandler_Inline(t *testing.T) {
+	mem := db.NewMemoryDatabase()
+	sender := &fakeSender{}
+	spotifyService := spotifytest.NewFake().AddObject(albumURL, "OK Computer", okComputer...).FailTracks(playlistURL, errBoom)
+	spotifyService.AddObject(playlistURL, "Mix")
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer webhook.Close()
+
+	h := NewHandler(mem, reconcile.New(mem, zap.NewNop()), zap.NewNop(), sender, Settings{
+		WhiteList:   []int64{allowedUser},
+		DoneWebhook: webhook.URL,
+		Sources:     source.Resolvers{source.NewSpotify(spotifyService)},
+		Search:      fakeSearch{},
+		Messages:    newCatalog(t, nil),
+	})
+
+	t.Run("query returns articles", func(t *testing.T) {
+		h.HandleInlineQuery(&telebot.Query{Text: "radiohead", From: telebot.User{ID: allowedUser, LanguageCode: i18n.English}})
+
+		resp := sender.answers[len(sender.answers)-1]
+		if len(resp.Results) != 2 || !resp.IsPersonal {
+			t.Fatalf("answer = %+v", resp)
+		}
+		article := resp.Results[0].(*telebot.ArticleResult)
+		if article.ResultID() != "spotify:album:ok-computer" || article.Title != "💿 OK Computer" ||
+			article.Description != "Radiohead · 1997 · 12 tracks" || article.ThumbURL != "https://i.scdn.co/image/cover" {
+			t.Errorf("article = %+v", article)
+		}
+		if article.ReplyMarkup == nil || article.ReplyMarkup.InlineKeyboard[0][0].URL != albumURL {
+			t.Errorf("article has no keyboard, its message couldn't be edited: %+v", article.ReplyMarkup)
+		}
+	})
+
+	t.Run("stranger gets no results", func(t *testing.T) {
+		h.HandleInlineQuery(&telebot.Query{Text: "radiohead", From: telebot.User{ID: strangerID}})
+
+		if resp := sender.answers[len(sender.answers)-1]; len(resp.Results) != 0 {
+			t.Errorf("answer = %+v", resp)
+		}
+	})
+
+	t.Run("chosen result is queued and confirmed", func(t *testing.T) {
+		h.HandleInlineChosen(&telebot.ChosenInlineResult{ResultID: "spotify:album:ok-computer", From: telebot.User{ID: allowedUser}, MessageID: "inline-1"})
+
+		requests, _ := mem.GetUserRequests(context.Background(), allowedUser)
+		if len(requests) != 1 || requests[0].SpotifyURL != albumURL {
+			t.Errorf("stored requests = %+v", requests)
+		}
+		if edit := sender.edits[len(sender.edits)-1]; edit != "Ураураура успішно додали OK Computer в чергу! (Треків: 2) ❤️" {
+			t.Errorf("posted message edited to %q", edit)
+		}
+	})
+
+	t.Run("warnings stay on the posted message", func(t *testing.T) {
+		h.HandleInlineChosen(&telebot.ChosenInlineResult{ResultID: "spotify:playlist:mix", From: telebot.User{ID: allowedUser}, MessageID: "inline-2"})
+
+		edit := sender.edits[len(sender.edits)-1]
+		if !strings.Contains(edit, "не получилось отримати кількість треків") || !strings.Contains(edit, "успішно додали Mix") {
+			t.Errorf("posted message edited to %q", edit)
+		}
+	})
+
+	t.Run("stranger can't queue", func(t *testing.T) {
+		h.HandleInlineChosen(&telebot.ChosenInlineResult{ResultID: "spotify:album:ok-computer", From: telebot.User{ID: strangerID}})
+
+		if requests, _ := mem.GetUserRequests(context.Background(), strangerID); len(requests) != 0 {
+			t.Errorf("stranger queued %+v", requests)
+		}
+	})
+}
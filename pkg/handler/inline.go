@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/i18n"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/metrics"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	"go.uber.org/zap"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// inlineLimit is how many results of each kind an inline query returns
+const inlineLimit = 5
+
+// HandleInlineQuery answers "@bot <query>" with Spotify search results. Each result's ID is its
+// spotify:<kind>:<id> URI, so HandleInlineChosen knows what to queue.
+func (h *handler) HandleInlineQuery(q *telebot.Query) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand("inline_query", outcome) }()
+
+	// Strangers get no results, so they have nothing to choose
+	resp := &telebot.QueryResponse{IsPersonal: true, CacheTime: 60}
+	defer func() {
+		if err := h.bot.Answer(q, resp); err != nil {
+			h.log.Error("Failed to answer inline query", zap.Error(err))
+		}
+	}()
+
+	if !h.allowed(q.From.ID) {
+		h.log.Info("Unauthorized user", zap.Int64("user_id", q.From.ID))
+		outcome = metrics.OutcomeUnauthorized
+		return
+	}
+
+	query := strings.TrimSpace(q.Text)
+	if query == "" {
+		outcome = metrics.OutcomeInvalid
+		return
+	}
+	t := h.translator(&q.From)
+
+	results, err := h.current().Search.Search(context.Background(), query, findKinds, inlineLimit)
+	if err != nil {
+		h.log.Error("Failed to search spotify", zap.Error(err), zap.String("query", query))
+		outcome = metrics.OutcomeError
+		return
+	}
+
+	for _, r := range results {
+		uri, ok := utils.SpotifyID(r.URL)
+		if !ok {
+			continue
+		}
+
+		article := &telebot.ArticleResult{
+			Title: kindEmoji[r.Kind] + " " + r.Name,
+			Description: t(i18n.InlineDescription, i18n.Args{
+				"Artist": r.Artist, "Year": releaseYear(r.ReleaseDate), "Tracks": r.TrackCount,
+			}),
+			Text:     t(i18n.InlineQueuing, i18n.Args{"Name": r.Name, "Artist": r.Artist, "Link": r.URL}),
+			ThumbURL: r.ImageURL,
+		}
+		article.SetResultID(uri)
+		// Telegram only reports the posted message's ID, needed to edit it, for results with a keyboard
+		article.SetReplyMarkup([][]telebot.InlineButton{{{Text: t(i18n.InlineOpen, nil), URL: r.URL}}})
+		resp.Results = append(resp.Results, article)
+	}
+}
+
+// HandleInlineChosen queues the inline result the user posted, then edits the posted
+// message into the outcome. Inline feedback must be enabled with @BotFather.
+func (h *handler) HandleInlineChosen(r *telebot.ChosenInlineResult) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand("inline_chosen", outcome) }()
+
+	if !h.allowed(r.From.ID) {
+		h.log.Info("Unauthorized user", zap.Int64("user_id", r.From.ID))
+		outcome = metrics.OutcomeUnauthorized
+		return
+	}
+
+	link, ok := spotifyLink(r.ResultID)
+	if !ok {
+		h.log.Warn("Unknown inline result", zap.String("result_id", r.ResultID))
+		outcome = metrics.OutcomeInvalid
+		return
+	}
+
+	// Every reply is added to the posted message, so a warning isn't overwritten by the confirmation
+	posted := telebot.StoredMessage{MessageID: r.MessageID}
+	var lines []string
+	// Telegram doesn't say which chat the result was posted in, so notifications go to the user
+	outcome = h.enqueue(&r.From, db.Chat{}, link, func(text string) {
+		lines = append(lines, text)
+		if r.MessageID == "" {
+			return
+		}
+		if _, err := h.bot.Edit(posted, strings.Join(lines, "\n")); err != nil {
+			h.log.Error("Failed to edit inline message", zap.Error(err))
+		}
+	})
+}
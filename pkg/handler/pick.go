@@ -0,0 +1,307 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/i18n"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/metrics"
+	"go.uber.org/zap"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// PickButton is the callback endpoint of the queue all or choose tracks keyboard. Its data is
+// <pick id>:<action>[:<number>], the release itself waits in memory since callback data is
+// limited to 64 bytes.
+var PickButton = telebot.InlineButton{Unique: "pick"}
+
+// Pick keyboard actions
+const (
+	pickAll    = "all"
+	pickChoose = "choose"
+	pickToggle = "toggle"
+	pickPage   = "page"
+	pickDone   = "done"
+	pickCancel = "cancel"
+)
+
+const (
+	// pickPageSize is how many tracks one page of the keyboard lists
+	pickPageSize = 8
+	// pickTTL is how long an offer can be answered, unanswered offers are forgotten after it
+	pickTTL = time.Hour
+)
+
+// pick is a release of several tracks waiting for its sender to queue all or some of it
+type pick struct {
+	senderID int64
+	chat     db.Chat
+	release  *release
+	chosen   []bool
+	page     int
+	created  time.Time
+}
+
+// selection is the positions of the chosen tracks, in release order
+func (p *pick) selection() []int {
+	selection := []int{}
+	for i, chosen := range p.chosen {
+		if chosen {
+			selection = append(selection, i)
+		}
+	}
+	return selection
+}
+
+func (p *pick) pages() int {
+	return (len(p.chosen) + pickPageSize - 1) / pickPageSize
+}
+
+// pickStore holds open offers by ID
+type pickStore struct {
+	mu    sync.Mutex
+	picks map[string]*pick
+}
+
+// add stores p under a new ID, forgetting expired offers
+func (s *pickStore) add(p *pick) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate pick id: %w", err)
+	}
+	id := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.picks == nil {
+		s.picks = make(map[string]*pick)
+	}
+	for key, old := range s.picks {
+		if time.Since(old.created) > pickTTL {
+			delete(s.picks, key)
+		}
+	}
+	s.picks[id] = p
+	return id, nil
+}
+
+// update runs fn on the offer with id under the store's lock, fn may remove it by returning true.
+// It returns false if there is no such offer.
+func (s *pickStore) update(id string, fn func(p *pick) (remove bool)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.picks[id]
+	if !ok || time.Since(p.created) > pickTTL {
+		delete(s.picks, id)
+		return false
+	}
+	if fn(p) {
+		delete(s.picks, id)
+	}
+	return true
+}
+
+// offer resolves link and queues it for sender in chat, replying to m. Releases of several
+// tracks are offered to queue whole or track by track first. It returns the command outcome.
+func (h *handler) offer(m *telebot.Message, sender *telebot.User, chat db.Chat, link string) string {
+	reply := func(text string) { h.reply(m, text) }
+
+	r, outcome := h.resolve(sender, link, reply)
+	if r == nil {
+		return outcome
+	}
+	if len(r.res.Tracks) < 2 {
+		return h.queue(sender, chat, r, nil, reply)
+	}
+
+	id, err := h.picks.add(&pick{
+		senderID: sender.ID,
+		chat:     chat,
+		release:  r,
+		chosen:   make([]bool, len(r.res.Tracks)),
+		created:  time.Now(),
+	})
+	if err != nil {
+		// Not being able to offer a choice shouldn't stop the release from being queued
+		h.log.Error("Failed to offer track choice", zap.Error(err))
+		return h.queue(sender, chat, r, nil, reply)
+	}
+
+	t := h.translator(sender)
+	markup := &telebot.ReplyMarkup{InlineKeyboard: [][]telebot.InlineButton{{
+		pickButton(id, pickAll, t(i18n.PickAll, nil)),
+		pickButton(id, pickChoose, t(i18n.PickChoose, nil)),
+	}}}
+	text := t(i18n.PickOffer, i18n.Args{"Name": r.res.Name, "Tracks": len(r.res.Tracks)})
+	if _, err := h.bot.Reply(m, text, markup); err != nil {
+		h.log.Error("Failed to send reply", zap.Error(err))
+	}
+	return metrics.OutcomeOK
+}
+
+// HandlePickCallback answers the buttons of an offer: queueing all of it, choosing tracks
+// page by page, queueing the chosen ones or cancelling
+func (h *handler) HandlePickCallback(c *telebot.Callback) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand("pick_callback", outcome) }()
+
+	if !h.allowed(c.Sender.ID) || !h.chatAllowed(c.Message.Chat) {
+		h.log.Info("Unauthorized user", zap.Int64("user_id", c.Sender.ID))
+		outcome = metrics.OutcomeUnauthorized
+		return
+	}
+	t := h.translator(c.Sender)
+
+	id, action, n, ok := parsePickData(c.Data)
+	if !ok {
+		h.log.Warn("Unknown pick button", zap.String("data", c.Data))
+		h.respond(c, "")
+		outcome = metrics.OutcomeInvalid
+		return
+	}
+
+	// The offer's message shows every reply from here on, replacing the keyboard
+	var lines []string
+	edit := func(text string) {
+		lines = append(lines, text)
+		if _, err := h.bot.Edit(c.Message, strings.Join(lines, "\n")); err != nil {
+			h.log.Error("Failed to edit pick message", zap.Error(err))
+		}
+	}
+
+	var (
+		toast     string
+		menu      *pick
+		queued    *pick
+		selection []int
+		cancelled string
+	)
+	found := h.picks.update(id, func(p *pick) bool {
+		if p.senderID != c.Sender.ID {
+			toast = t(i18n.PickNotYours, nil)
+			return false
+		}
+
+		switch action {
+		case pickAll:
+			queued = p
+			return true
+		case pickToggle:
+			if n >= 0 && n < len(p.chosen) {
+				p.chosen[n] = !p.chosen[n]
+			}
+		case pickPage:
+			if n >= 0 && n < p.pages() {
+				p.page = n
+			}
+		case pickDone:
+			if selection = p.selection(); len(selection) == 0 {
+				toast = t(i18n.PickNothing, nil)
+				return false
+			}
+			queued = p
+			return true
+		case pickCancel:
+			cancelled = p.release.res.Name
+			return true
+		}
+
+		// Choosing, toggling and paging all redraw the keyboard, copied to render it unlocked
+		snapshot := *p
+		snapshot.chosen = append([]bool(nil), p.chosen...)
+		menu = &snapshot
+		return false
+	})
+	if !found {
+		toast = t(i18n.PickExpired, nil)
+		outcome = metrics.OutcomeInvalid
+	}
+	h.respond(c, toast)
+
+	switch {
+	case cancelled != "":
+		edit(t(i18n.PickCancelled, i18n.Args{"Name": cancelled}))
+	case queued != nil:
+		outcome = h.queue(c.Sender, queued.chat, queued.release, selection, edit)
+	case menu != nil:
+		text, markup := pickMenu(id, menu, t)
+		if _, err := h.bot.Edit(c.Message, text, markup); err != nil {
+			h.log.Error("Failed to update pick menu", zap.Error(err))
+		}
+	}
+}
+
+// pickMenu renders a page of p's tracks as checkboxes, with paging and queue or cancel buttons under them
+func pickMenu(id string, p *pick, t func(string, any) string) (string, *telebot.ReplyMarkup) {
+	tracks := p.release.res.Tracks
+	selected := len(p.selection())
+
+	markup := &telebot.ReplyMarkup{}
+	first := p.page * pickPageSize
+	for i := first; i < len(tracks) && i < first+pickPageSize; i++ {
+		box := "⬜"
+		if p.chosen[i] {
+			box = "✅"
+		}
+		label := fmt.Sprintf("%s %d. %s — %s", box, i+1, tracks[i].Title, tracks[i].Artist)
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{pickButton(id, pickToggle+":"+strconv.Itoa(i), label)})
+	}
+
+	if pages := p.pages(); pages > 1 {
+		var nav []telebot.InlineButton
+		if p.page > 0 {
+			nav = append(nav, pickButton(id, pickPage+":"+strconv.Itoa(p.page-1), "◀️"))
+		}
+		nav = append(nav, pickButton(id, pickPage+":"+strconv.Itoa(p.page), fmt.Sprintf("%d/%d", p.page+1, pages)))
+		if p.page < pages-1 {
+			nav = append(nav, pickButton(id, pickPage+":"+strconv.Itoa(p.page+1), "▶️"))
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, nav)
+	}
+
+	markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+		pickButton(id, pickDone, t(i18n.PickDone, i18n.Args{"Selected": selected})),
+		pickButton(id, pickCancel, t(i18n.PickCancel, nil)),
+	})
+
+	text := t(i18n.PickHeader, i18n.Args{"Name": p.release.res.Name, "Selected": selected, "Tracks": len(tracks)})
+	return text, markup
+}
+
+func pickButton(id, action, text string) telebot.InlineButton {
+	b := *PickButton.With(id + ":" + action)
+	b.Text = text
+	return b
+}
+
+// parsePickData splits <id>:<action>[:<number>] callback data, the number is -1 when absent
+func parsePickData(data string) (string, string, int, bool) {
+	parts := strings.Split(data, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return "", "", 0, false
+	}
+
+	n := -1
+	if len(parts) == 3 {
+		var err error
+		if n, err = strconv.Atoi(parts[2]); err != nil {
+			return "", "", 0, false
+		}
+	}
+
+	switch parts[1] {
+	case pickAll, pickChoose, pickDone, pickCancel:
+		return parts[0], parts[1], n, true
+	case pickToggle, pickPage:
+		return parts[0], parts[1], n, n >= 0
+	}
+	return "", "", 0, false
+}
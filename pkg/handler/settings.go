@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/i18n"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/metrics"
+	"go.uber.org/zap"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// SettingsButton is the callback endpoint of every /settings button, its data names the setting
+var SettingsButton = telebot.InlineButton{Unique: "settings"}
+
+// Settings menu buttons, each press cycles its setting to the next value
+const (
+	settingLanguage         = "language"
+	settingNotifyCompletion = "completion"
+	settingNotifyProgress   = "progress"
+	settingPlaylistMode     = "playlist"
+	settingQuietHours       = "quiet"
+)
+
+// quietPresets are the quiet hours the menu cycles through, the first turns them off
+var quietPresets = [][2]int{{0, 0}, {22, 8}, {23, 7}, {0, 9}}
+
+func (h *handler) HandleSettings(m *telebot.Message) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand("settings", outcome) }()
+
+	if !h.allowedIn(m) {
+		h.log.Info("Unauthorized user", zap.Int64("user_id", m.Sender.ID))
+		outcome = metrics.OutcomeUnauthorized
+		return
+	}
+	t := h.translator(m.Sender)
+
+	prefs, err := h.db.GetUserPreferences(context.Background(), m.Sender.ID)
+	if err != nil {
+		h.log.Error("Failed to get user preferences", zap.Error(err), zap.Int64("user_id", m.Sender.ID))
+		h.reply(m, t(i18n.SettingsFailed, nil))
+		outcome = metrics.OutcomeError
+		return
+	}
+
+	text, markup := h.settingsMenu(*prefs, t, h.locale(m.Sender))
+	if _, err := h.bot.Reply(m, text, markup); err != nil {
+		h.log.Error("Failed to send reply", zap.Error(err))
+	}
+}
+
+func (h *handler) HandleSettingsCallback(c *telebot.Callback) {
+	outcome := metrics.OutcomeOK
+	defer func() { metrics.ObserveCommand("settings_callback", outcome) }()
+
+	if !h.allowed(c.Sender.ID) {
+		h.log.Info("Unauthorized user", zap.Int64("user_id", c.Sender.ID))
+		outcome = metrics.OutcomeUnauthorized
+		return
+	}
+
+	ctx := context.Background()
+	locale := h.locale(c.Sender)
+	prefs, err := h.db.GetUserPreferences(ctx, c.Sender.ID)
+	if err == nil {
+		if !h.toggle(prefs, c.Data, locale) {
+			// Still answer, or the button keeps spinning
+			h.respond(c, "")
+			outcome = metrics.OutcomeInvalid
+			return
+		}
+		err = h.db.SaveUserPreferences(ctx, *prefs)
+	}
+	// Translate after saving so a language change shows up right away
+	t := h.translator(c.Sender)
+	if err != nil {
+		h.log.Error("Failed to save user preferences", zap.Error(err), zap.Int64("user_id", c.Sender.ID))
+		h.respond(c, t(i18n.SettingsFailed, nil))
+		outcome = metrics.OutcomeError
+		return
+	}
+
+	text, markup := h.settingsMenu(*prefs, t, h.locale(c.Sender))
+	if _, err := h.bot.Edit(c.Message, text, markup); err != nil {
+		h.log.Error("Failed to update settings menu", zap.Error(err))
+	}
+	h.respond(c, t(i18n.SettingsSaved, nil))
+}
+
+// toggle moves the setting named by a button press to its next value, and reports false for
+// a setting it doesn't know. Languages cycle on from locale, the one the user currently sees.
+func (h *handler) toggle(prefs *db.UserPreferences, setting, locale string) bool {
+	switch setting {
+	case settingLanguage:
+		locales := h.current().Messages.Locales()
+		i := slices.Index(locales, locale)
+		prefs.Language = locales[(i+1)%len(locales)]
+	case settingNotifyCompletion:
+		prefs.NotifyCompletion = !prefs.NotifyCompletion
+	case settingNotifyProgress:
+		prefs.NotifyProgress = !prefs.NotifyProgress
+	case settingPlaylistMode:
+		prefs.PlaylistNoPull = !prefs.PlaylistNoPull
+	case settingQuietHours:
+		i := slices.Index(quietPresets, [2]int{prefs.QuietFrom, prefs.QuietTo})
+		next := quietPresets[(i+1)%len(quietPresets)]
+		prefs.QuietFrom, prefs.QuietTo = next[0], next[1]
+	default:
+		h.log.Warn("Unknown settings button", zap.String("data", setting))
+		return false
+	}
+	return true
+}
+
+func (h *handler) settingsMenu(prefs db.UserPreferences, t func(string, any) string, locale string) (string, *telebot.ReplyMarkup) {
+	button := func(setting, key string, data any) []telebot.InlineButton {
+		b := *SettingsButton.With(setting)
+		b.Text = t(key, data)
+		return []telebot.InlineButton{b}
+	}
+
+	// Quiet hours are checked against the server's clock, so the menu names its zone
+	zone, _ := time.Now().Zone()
+
+	return t(i18n.SettingsTitle, nil), &telebot.ReplyMarkup{InlineKeyboard: [][]telebot.InlineButton{
+		button(settingLanguage, i18n.SettingsLanguage, i18n.Args{"Language": locale}),
+		button(settingNotifyCompletion, i18n.SettingsNotifyCompletion, i18n.Args{"On": prefs.NotifyCompletion}),
+		button(settingNotifyProgress, i18n.SettingsNotifyProgress, i18n.Args{"On": prefs.NotifyProgress}),
+		button(settingPlaylistMode, i18n.SettingsPlaylistMode, i18n.Args{"NoPull": prefs.PlaylistNoPull}),
+		button(settingQuietHours, i18n.SettingsQuietHours, i18n.Args{
+			"On": prefs.QuietHours(), "From": prefs.QuietFrom, "To": prefs.QuietTo, "Zone": zone,
+		}),
+	}}
+}
+
+func (h *handler) respond(c *telebot.Callback, text string) {
+	if err := h.bot.Respond(c, &telebot.CallbackResponse{Text: text}); err != nil {
+		h.log.Error("Failed to answer callback", zap.Error(err))
+	}
+}
@@ -0,0 +1,132 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Component and overall statuses reported by the checker
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Probe checks a single dependency and returns nil when it is usable
+type Probe func(ctx context.Context) error
+
+type ComponentResult struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMS float64   `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type Report struct {
+	Status     string                     `json:"status"`
+	CheckedAt  time.Time                  `json:"checked_at"`
+	Components map[string]ComponentResult `json:"components"`
+}
+
+// Checker runs the registered probes concurrently and caches the report for ttl,
+// so frequent readiness polling does not hammer Mongo, Spotify or Telegram.
+type Checker struct {
+	ttl     time.Duration
+	timeout time.Duration
+
+	mu     sync.Mutex
+	names  []string
+	probes map[string]Probe
+	cached *Report
+}
+
+func NewChecker(ttl, timeout time.Duration) *Checker {
+	return &Checker{
+		ttl:     ttl,
+		timeout: timeout,
+		probes:  make(map[string]Probe),
+	}
+}
+
+func (c *Checker) Register(name string, probe Probe) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.probes[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.probes[name] = probe
+	c.cached = nil
+}
+
+// Check returns the cached report if it is fresh, otherwise runs every probe
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached != nil && time.Since(c.cached.CheckedAt) < c.ttl {
+		return *c.cached
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{
+		Status:     StatusOK,
+		CheckedAt:  time.Now(),
+		Components: make(map[string]ComponentResult, len(c.names)),
+	}
+
+	var (
+		wg      sync.WaitGroup
+		resultM sync.Mutex
+	)
+	for _, name := range c.names {
+		wg.Add(1)
+		go func(name string, probe Probe) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := probe(ctx)
+			result := ComponentResult{
+				Status:    StatusOK,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+				CheckedAt: start,
+			}
+			if err != nil {
+				result.Status = StatusFail
+				result.Error = err.Error()
+			}
+
+			resultM.Lock()
+			report.Components[name] = result
+			resultM.Unlock()
+		}(name, c.probes[name])
+	}
+	wg.Wait()
+
+	for _, result := range report.Components {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+			break
+		}
+	}
+
+	c.cached = &report
+	return report
+}
+
+// Handler serves the report as JSON, with 503 when any component fails
+func (c *Checker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Check(r.Context())
+
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,119 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		probes   map[string]Probe
+		expected string
+	}{
+		{
+			name: "all components ok",
+			probes: map[string]Probe{
+				"mongo":    func(ctx context.Context) error { return nil },
+				"telegram": func(ctx context.Context) error { return nil },
+			},
+			expected: StatusOK,
+		},
+		{
+			name: "one component failing",
+			probes: map[string]Probe{
+				"mongo":    func(ctx context.Context) error { return errors.New("connection refused") },
+				"telegram": func(ctx context.Context) error { return nil },
+			},
+			expected: StatusFail,
+		},
+		{
+			name:     "no components",
+			probes:   map[string]Probe{},
+			expected: StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker(time.Minute, time.Second)
+			for name, probe := range tt.probes {
+				c.Register(name, probe)
+			}
+
+			report := c.Check(context.Background())
+			if report.Status != tt.expected {
+				t.Errorf("Check() status = %q, want %q", report.Status, tt.expected)
+			}
+			if len(report.Components) != len(tt.probes) {
+				t.Errorf("Check() returned %d components, want %d", len(report.Components), len(tt.probes))
+			}
+		})
+	}
+}
+
+func TestCheck_Cached(t *testing.T) {
+	var calls atomic.Int32
+	c := NewChecker(time.Minute, time.Second)
+	c.Register("mongo", func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	})
+
+	c.Check(context.Background())
+	c.Check(context.Background())
+
+	if calls.Load() != 1 {
+		t.Errorf("probe called %d times, want 1", calls.Load())
+	}
+}
+
+func TestCheck_Timeout(t *testing.T) {
+	c := NewChecker(0, 10*time.Millisecond)
+	c.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := c.Check(context.Background())
+	if report.Components["slow"].Status != StatusFail {
+		t.Errorf("slow probe status = %q, want %q", report.Components["slow"].Status, StatusFail)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c := NewChecker(0, time.Second)
+	c.Register("mongo", func(ctx context.Context) error { return errors.New("down") })
+
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Handler() code = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestSpotifyTokenProbe_CachesToken(t *testing.T) {
+	var grants atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		grants.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer srv.Close()
+
+	probe := spotifyTokenProbe(srv.URL, "id", "secret")
+	for i := 0; i < 3; i++ {
+		if err := probe(context.Background()); err != nil {
+			t.Fatalf("probe() unexpected error: %v", err)
+		}
+	}
+	if got := grants.Load(); got != 1 {
+		t.Errorf("token grants = %d, want 1", got)
+	}
+}
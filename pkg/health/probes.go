@@ -0,0 +1,106 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	spotifyTokenURL = "https://accounts.spotify.com/api/token"
+	// spotifyTokenTimeout bounds a token grant, the probe itself gives up with its context
+	spotifyTokenTimeout = 10 * time.Second
+)
+
+// SpotifyTokenProbe checks that the client credentials can still obtain an access token.
+// The token is cached until it expires, so probes don't run a grant every time.
+func SpotifyTokenProbe(clientID, clientSecret string) Probe {
+	return spotifyTokenProbe(spotifyTokenURL, clientID, clientSecret)
+}
+
+func spotifyTokenProbe(tokenURL, clientID, clientSecret string) Probe {
+	cfg := &clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     tokenURL,
+	}
+	// The token source outlives each probe, so it gets its own context
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Timeout: spotifyTokenTimeout})
+	source := cfg.TokenSource(ctx)
+
+	return func(ctx context.Context) error {
+		errCh := make(chan error, 1)
+		go func() {
+			token, err := source.Token()
+			if err == nil && !token.Valid() {
+				err = fmt.Errorf("spotify returned an invalid token")
+			}
+			errCh <- err
+		}()
+
+		select {
+		case err := <-errCh:
+			if err != nil {
+				return fmt.Errorf("failed to get spotify token: %w", err)
+			}
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// TelegramProbe calls getMe to verify the bot token and Telegram API reachability
+func TelegramProbe(bot *telebot.Bot) Probe {
+	return func(ctx context.Context) error {
+		errCh := make(chan error, 1)
+		go func() {
+			_, err := bot.Raw("getMe", nil)
+			errCh <- err
+		}()
+
+		select {
+		case err := <-errCh:
+			if err != nil {
+				return fmt.Errorf("telegram getMe failed: %w", err)
+			}
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ReachabilityProbe dials the host of rawURL without sending a request,
+// so checking the downloader webhook never triggers a download.
+func ReachabilityProbe(rawURL string) Probe {
+	return func(ctx context.Context) error {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return fmt.Errorf("invalid url: %w", err)
+		}
+
+		host := u.Host
+		if u.Port() == "" {
+			port := "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+			host = net.JoinHostPort(u.Hostname(), port)
+		}
+
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", host)
+		if err != nil {
+			return fmt.Errorf("failed to reach %s: %w", host, err)
+		}
+		return conn.Close()
+	}
+}
@@ -0,0 +1,149 @@
+// Package i18n holds the bot's message catalog. Messages are text/template
+// strings looked up by key, shipped in Ukrainian and English and overridable
+// by operators through the config file.
+package i18n
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Shipped locales
+const (
+	Ukrainian = "uk"
+	English   = "en"
+)
+
+//go:embed locales/*.yaml
+var locales embed.FS
+
+// Catalog renders messages by locale and key. It is immutable once built, so a
+// reload builds a new one.
+type Catalog struct {
+	defaultLocale string
+	messages      map[string]map[string]*template.Template
+}
+
+// New builds a catalog from the shipped locales with overrides applied on top.
+// Overrides map locale to key to template, and may add locales; keys missing
+// from a locale fall back to defaultLocale. Unknown keys and templates that
+// don't parse are errors, so typos surface at startup.
+func New(defaultLocale string, overrides map[string]map[string]string) (*Catalog, error) {
+	sources, err := shipped()
+	if err != nil {
+		return nil, err
+	}
+
+	known := sources[Ukrainian]
+	for locale, messages := range overrides {
+		if sources[locale] == nil {
+			sources[locale] = make(map[string]string)
+		}
+		for key, text := range messages {
+			if _, ok := known[key]; !ok {
+				return nil, fmt.Errorf("unknown message key %q in locale %q", key, locale)
+			}
+			sources[locale][key] = text
+		}
+	}
+
+	if _, ok := sources[defaultLocale]; !ok {
+		return nil, fmt.Errorf("default language %q has no messages", defaultLocale)
+	}
+
+	c := &Catalog{defaultLocale: defaultLocale, messages: make(map[string]map[string]*template.Template)}
+	for locale, messages := range sources {
+		c.messages[locale] = make(map[string]*template.Template, len(messages))
+		for key, text := range messages {
+			tmpl, err := template.New(key).Option("missingkey=error").Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse message %s/%s: %w", locale, key, err)
+			}
+			c.messages[locale][key] = tmpl
+		}
+	}
+
+	return c, nil
+}
+
+func shipped() (map[string]map[string]string, error) {
+	files, err := locales.ReadDir("locales")
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]map[string]string, len(files))
+	for _, f := range files {
+		data, err := locales.ReadFile(path.Join("locales", f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		messages := make(map[string]string)
+		if err := yaml.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", f.Name(), err)
+		}
+		sources[strings.TrimSuffix(f.Name(), ".yaml")] = messages
+	}
+
+	return sources, nil
+}
+
+// Text renders key in locale, falling back to the default locale. If rendering
+// fails the key itself is returned so the reply is never empty.
+func (c *Catalog) Text(locale, key string, data any) string {
+	tmpl, ok := c.messages[locale][key]
+	if !ok {
+		tmpl, ok = c.messages[c.defaultLocale][key]
+	}
+	if !ok {
+		return key
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return key
+	}
+	return buf.String()
+}
+
+// Supports reports whether locale has a message catalog
+func (c *Catalog) Supports(locale string) bool {
+	_, ok := c.messages[locale]
+	return ok
+}
+
+// Locales lists the available locales, sorted
+func (c *Catalog) Locales() []string {
+	list := make([]string, 0, len(c.messages))
+	for locale := range c.messages {
+		list = append(list, locale)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Locale picks the locale to reply in: the user's stored preference if it is
+// supported, then their Telegram client language ("en-GB" counts as "en"),
+// then the default.
+func (c *Catalog) Locale(preferred, languageCode string) string {
+	if c.Supports(preferred) {
+		return preferred
+	}
+
+	base, _, _ := strings.Cut(strings.ToLower(languageCode), "-")
+	if c.Supports(base) {
+		return base
+	}
+
+	return c.defaultLocale
+}
+
+// Args are the template values of a message
+type Args map[string]any
@@ -0,0 +1,153 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShippedLocalesMatch(t *testing.T) {
+	sources, err := shipped()
+	if err != nil {
+		t.Fatalf("shipped() unexpected error: %v", err)
+	}
+
+	for locale, messages := range sources {
+		for key := range sources[Ukrainian] {
+			if _, ok := messages[key]; !ok {
+				t.Errorf("locale %q is missing %q", locale, key)
+			}
+		}
+		for key := range messages {
+			if _, ok := sources[Ukrainian][key]; !ok {
+				t.Errorf("locale %q has %q, which uk doesn't", locale, key)
+			}
+		}
+	}
+}
+
+func TestCatalog_Text(t *testing.T) {
+	c, err := New(Ukrainian, map[string]map[string]string{
+		English: {Queued: "Queued {{.Name}}!"},
+		"de":    {Welcome: "Hallo!"},
+	})
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		locale   string
+		key      string
+		data     any
+		expected string
+	}{
+		{
+			name:     "shipped message",
+			locale:   Ukrainian,
+			key:      StatsCompleted,
+			data:     Args{"Count": 3, "Percent": 42.4},
+			expected: "✅ Завершено: 3 (42%)",
+		},
+		{
+			name:     "override",
+			locale:   English,
+			key:      Queued,
+			data:     Args{"Name": "OK Computer", "Tracks": 12},
+			expected: "Queued OK Computer!",
+		},
+		{
+			name:     "added locale",
+			locale:   "de",
+			key:      Welcome,
+			expected: "Hallo!",
+		},
+		{
+			name:     "added locale falls back to default",
+			locale:   "de",
+			key:      QueueEmpty,
+			expected: "немає активних запитів на скачування...",
+		},
+		{
+			name:     "unknown locale falls back to default",
+			locale:   "fr",
+			key:      Deactivated,
+			expected: "Запит деактивовано, всьо капец.",
+		},
+		{
+			name:     "missing template value",
+			locale:   English,
+			key:      MineID,
+			data:     Args{},
+			expected: MineID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Text(tt.locale, tt.key, tt.data); got != tt.expected {
+				t.Errorf("Text(%q, %q) = %q, want %q", tt.locale, tt.key, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaultLocale string
+		overrides     map[string]map[string]string
+		wantErr       string
+	}{
+		{
+			name:          "unknown key",
+			defaultLocale: Ukrainian,
+			overrides:     map[string]map[string]string{English: {"welcom": "Hi"}},
+			wantErr:       `unknown message key "welcom"`,
+		},
+		{
+			name:          "broken template",
+			defaultLocale: Ukrainian,
+			overrides:     map[string]map[string]string{English: {Queued: "{{.Name"}},
+			wantErr:       "failed to parse message en/queued",
+		},
+		{
+			name:          "unknown default",
+			defaultLocale: "fr",
+			wantErr:       `default language "fr" has no messages`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.defaultLocale, tt.overrides)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("New() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCatalog_Locale(t *testing.T) {
+	c, err := New(Ukrainian, nil)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		preferred    string
+		languageCode string
+		expected     string
+	}{
+		{preferred: English, languageCode: "uk", expected: English},
+		{preferred: "", languageCode: "en", expected: English},
+		{preferred: "", languageCode: "en-GB", expected: English},
+		{preferred: "", languageCode: "de", expected: Ukrainian},
+		{preferred: "fr", languageCode: "", expected: Ukrainian},
+	}
+
+	for _, tt := range tests {
+		if got := c.Locale(tt.preferred, tt.languageCode); got != tt.expected {
+			t.Errorf("Locale(%q, %q) = %q, want %q", tt.preferred, tt.languageCode, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package i18n
+
+// Message keys, shared by every locale file
+const (
+	Welcome             = "welcome"
+	InvalidSpotifyURL   = "invalid_spotify_url"
+	UnsupportedLink     = "unsupported_link"
+	SpotifyLookupFailed = "spotify_lookup_failed"
+	LookupFailed        = "lookup_failed"
+	NoSpotifyMatch      = "no_spotify_match"
+	LinkTranslated      = "link_translated"
+	TrackCountFailed    = "track_count_failed"
+	QueueAddFailed      = "queue_add_failed"
+	Queued              = "queued"
+
+	QueueFailed        = "queue_failed"
+	QueueEmpty         = "queue_empty"
+	QueueHeader        = "queue_header"
+	QueueItem          = "queue_item"
+	QueueProgress      = "queue_progress"
+	QueueRemaining     = "queue_remaining"
+	QueueAllDownloaded = "queue_all_downloaded"
+	QueueWaiting       = "queue_waiting"
+	QueueErrors        = "queue_errors"
+
+	MineFailed          = "mine_failed"
+	MineEmpty           = "mine_empty"
+	MineStatsFailed     = "mine_stats_failed"
+	MineHeader          = "mine_header"
+	MineMore            = "mine_more"
+	MineItem            = "mine_item"
+	MineTracks          = "mine_tracks"
+	MineID              = "mine_id"
+	MineTotals          = "mine_totals"
+	MineTracksDelivered = "mine_tracks_delivered"
+	MineAvgCompletion   = "mine_avg_completion"
+
+	StatsUsage         = "stats_usage"
+	StatsInvalidPeriod = "stats_invalid_period"
+	StatsFailed        = "stats_failed"
+	StatsHeader        = "stats_header"
+	StatsLibrary       = "stats_library"
+	StatsActive        = "stats_active"
+	StatsNew           = "stats_new"
+	StatsCompleted     = "stats_completed"
+	StatsErrored       = "stats_errored"
+	StatsMedian        = "stats_median"
+	StatsOverTime      = "stats_over_time"
+	StatsTopRequesters = "stats_top_requesters"
+	StatsTopArtists    = "stats_top_artists"
+	StatsRow           = "stats_row"
+
+	DeactivateUsage    = "deactivate_usage"
+	DeactivateFailed   = "deactivate_failed"
+	DeactivateNotFound = "deactivate_not_found"
+	Deactivated        = "deactivated"
+
+	PlaylistUsage  = "playlist_usage"
+	PlaylistQueued = "playlist_queued"
+
+	LangCurrent = "lang_current"
+	LangUnknown = "lang_unknown"
+	LangFailed  = "lang_failed"
+	LangSet     = "lang_set"
+
+	SettingsTitle            = "settings_title"
+	SettingsLanguage         = "settings_language"
+	SettingsNotifyCompletion = "settings_notify_completion"
+	SettingsNotifyProgress   = "settings_notify_progress"
+	SettingsPlaylistMode     = "settings_playlist_mode"
+	SettingsQuietHours       = "settings_quiet_hours"
+	SettingsSaved            = "settings_saved"
+	SettingsFailed           = "settings_failed"
+
+	FindUsage  = "find_usage"
+	FindFailed = "find_failed"
+	FindEmpty  = "find_empty"
+	FindHeader = "find_header"
+	FindResult = "find_result"
+
+	InlineDescription = "inline_description"
+	InlineQueuing     = "inline_queuing"
+	InlineOpen        = "inline_open"
+
+	PickOffer     = "pick_offer"
+	PickAll       = "pick_all"
+	PickChoose    = "pick_choose"
+	PickHeader    = "pick_header"
+	PickDone      = "pick_done"
+	PickCancel    = "pick_cancel"
+	PickCancelled = "pick_cancelled"
+	PickExpired   = "pick_expired"
+	PickNothing   = "pick_nothing"
+	PickNotYours  = "pick_not_yours"
+
+	ExportUsage    = "export_usage"
+	ExportNotFound = "export_not_found"
+	ExportFailed   = "export_failed"
+	ExportEmpty    = "export_empty"
+	ExportCaption  = "export_caption"
+	ExportSaved    = "export_saved"
+
+	NotifyCompleted = "notify_completed"
+	NotifyProgress  = "notify_progress"
+)
@@ -0,0 +1,193 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	models "github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+// instrumentedDatabase records DBLatency around every db.Database call
+type instrumentedDatabase struct {
+	db db.Database
+}
+
+func InstrumentDatabase(d db.Database) db.Database {
+	return &instrumentedDatabase{db: d}
+}
+
+func observeQuery(method string, start time.Time, err error) {
+	DBLatency.WithLabelValues(method, outcomeOf(err)).Observe(time.Since(start).Seconds())
+}
+
+func (d *instrumentedDatabase) NewDownloadRequest(ctx context.Context, source, url, name string, creatorID int64, chat db.Chat, expectedTrackCount int, trackMetadata []spotify.TrackMetadata, selection []int) error {
+	start := time.Now()
+	err := d.db.NewDownloadRequest(ctx, source, url, name, creatorID, chat, expectedTrackCount, trackMetadata, selection)
+	observeQuery("NewDownloadRequest", start, err)
+	return err
+}
+
+func (d *instrumentedDatabase) GetActiveRequests(ctx context.Context) ([]models.DownloadQueueRequest, error) {
+	start := time.Now()
+	requests, err := d.db.GetActiveRequests(ctx)
+	observeQuery("GetActiveRequests", start, err)
+	return requests, err
+}
+
+func (d *instrumentedDatabase) GetDownloadRequest(ctx context.Context, id string) (*models.DownloadQueueRequest, error) {
+	start := time.Now()
+	request, err := d.db.GetDownloadRequest(ctx, id)
+	observeQuery("GetDownloadRequest", start, err)
+	return request, err
+}
+
+func (d *instrumentedDatabase) DeactivateRequest(ctx context.Context, id string) error {
+	start := time.Now()
+	err := d.db.DeactivateRequest(ctx, id)
+	observeQuery("DeactivateRequest", start, err)
+	return err
+}
+
+func (d *instrumentedDatabase) GetRequestChat(ctx context.Context, id string) (db.Chat, error) {
+	start := time.Now()
+	chat, err := d.db.GetRequestChat(ctx, id)
+	observeQuery("GetRequestChat", start, err)
+	return chat, err
+}
+
+func (d *instrumentedDatabase) NewPlaylistRequest(ctx context.Context, url string, creatorID int64, chat db.Chat, noPull bool) error {
+	start := time.Now()
+	err := d.db.NewPlaylistRequest(ctx, url, creatorID, chat, noPull)
+	observeQuery("NewPlaylistRequest", start, err)
+	return err
+}
+
+func (d *instrumentedDatabase) FindMusicFiles(ctx context.Context, artists, titles []string) ([]models.MusicFile, error) {
+	start := time.Now()
+	files, err := d.db.FindMusicFiles(ctx, artists, titles)
+	observeQuery("FindMusicFiles", start, err)
+	return files, err
+}
+
+func (d *instrumentedDatabase) UpdateDownloadRequest(ctx context.Context, request models.DownloadQueueRequest) error {
+	start := time.Now()
+	err := d.db.UpdateDownloadRequest(ctx, request)
+	observeQuery("UpdateDownloadRequest", start, err)
+	return err
+}
+
+func (d *instrumentedDatabase) Close(ctx context.Context) error {
+	return d.db.Close(ctx)
+}
+
+func (d *instrumentedDatabase) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := d.db.Ping(ctx)
+	observeQuery("Ping", start, err)
+	return err
+}
+
+func (d *instrumentedDatabase) GetStats(ctx context.Context) (*db.Stats, error) {
+	start := time.Now()
+	stats, err := d.db.GetStats(ctx)
+	observeQuery("GetStats", start, err)
+	return stats, err
+}
+
+func (d *instrumentedDatabase) GetDetailedStats(ctx context.Context, opts db.StatsOptions) (*db.DetailedStats, error) {
+	start := time.Now()
+	stats, err := d.db.GetDetailedStats(ctx, opts)
+	observeQuery("GetDetailedStats", start, err)
+	return stats, err
+}
+
+func (d *instrumentedDatabase) GetUserRequests(ctx context.Context, creatorID int64) ([]models.DownloadQueueRequest, error) {
+	start := time.Now()
+	requests, err := d.db.GetUserRequests(ctx, creatorID)
+	observeQuery("GetUserRequests", start, err)
+	return requests, err
+}
+
+func (d *instrumentedDatabase) GetUserStats(ctx context.Context, creatorID int64) (*db.UserStats, error) {
+	start := time.Now()
+	stats, err := d.db.GetUserStats(ctx, creatorID)
+	observeQuery("GetUserStats", start, err)
+	return stats, err
+}
+
+func (d *instrumentedDatabase) GetUserPreferences(ctx context.Context, userID int64) (*db.UserPreferences, error) {
+	start := time.Now()
+	prefs, err := d.db.GetUserPreferences(ctx, userID)
+	observeQuery("GetUserPreferences", start, err)
+	return prefs, err
+}
+
+func (d *instrumentedDatabase) SaveUserPreferences(ctx context.Context, prefs db.UserPreferences) error {
+	start := time.Now()
+	err := d.db.SaveUserPreferences(ctx, prefs)
+	observeQuery("SaveUserPreferences", start, err)
+	return err
+}
+
+func (d *instrumentedDatabase) DumpDownloadRequests(ctx context.Context) ([]db.DownloadRequestRecord, error) {
+	start := time.Now()
+	records, err := d.db.DumpDownloadRequests(ctx)
+	observeQuery("DumpDownloadRequests", start, err)
+	return records, err
+}
+
+func (d *instrumentedDatabase) DumpPlaylistRequests(ctx context.Context) ([]db.PlaylistRequestRecord, error) {
+	start := time.Now()
+	requests, err := d.db.DumpPlaylistRequests(ctx)
+	observeQuery("DumpPlaylistRequests", start, err)
+	return requests, err
+}
+
+func (d *instrumentedDatabase) RestoreDownloadRequests(ctx context.Context, records []db.DownloadRequestRecord) error {
+	start := time.Now()
+	err := d.db.RestoreDownloadRequests(ctx, records)
+	observeQuery("RestoreDownloadRequests", start, err)
+	return err
+}
+
+func (d *instrumentedDatabase) RestorePlaylistRequests(ctx context.Context, records []db.PlaylistRequestRecord) error {
+	start := time.Now()
+	err := d.db.RestorePlaylistRequests(ctx, records)
+	observeQuery("RestorePlaylistRequests", start, err)
+	return err
+}
+
+// WatchMusicFiles passes through to the wrapped backend when it supports change streams
+func (d *instrumentedDatabase) WatchMusicFiles(ctx context.Context, resume db.ResumeToken, fn func(models.MusicFile)) (db.ResumeToken, error) {
+	w, ok := d.db.(db.MusicFileWatcher)
+	if !ok {
+		return nil, db.ErrWatchUnsupported
+	}
+	return w.WatchMusicFiles(ctx, resume, fn)
+}
+
+// KeyNewMusicFiles passes through to the wrapped backend when it keeps match keys itself
+func (d *instrumentedDatabase) KeyNewMusicFiles(ctx context.Context) error {
+	r, ok := d.db.(db.MatchKeyRefresher)
+	if !ok {
+		return nil
+	}
+	start := time.Now()
+	err := r.KeyNewMusicFiles(ctx)
+	observeQuery("KeyNewMusicFiles", start, err)
+	return err
+}
+
+// RefreshMatchKeys passes through to the wrapped backend when it keeps match keys itself
+func (d *instrumentedDatabase) RefreshMatchKeys(ctx context.Context) error {
+	r, ok := d.db.(db.MatchKeyRefresher)
+	if !ok {
+		return nil
+	}
+	start := time.Now()
+	err := r.RefreshMatchKeys(ctx)
+	observeQuery("RefreshMatchKeys", start, err)
+	return err
+}
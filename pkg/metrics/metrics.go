@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "album_queue"
+
+// Bot command outcomes. Ignored is group chatter the bot stays out of.
+const (
+	OutcomeOK           = "ok"
+	OutcomeInvalid      = "invalid"
+	OutcomeError        = "error"
+	OutcomeUnauthorized = "unauthorized"
+	OutcomeIgnored      = "ignored"
+)
+
+// Registry holds every album-queue metric plus the Go runtime and process collectors
+var Registry = prometheus.NewRegistry()
+
+var (
+	BotCommands = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bot_commands_total",
+		Help:      "Bot commands handled, by command and outcome.",
+	}, []string{"command", "outcome"})
+
+	WebhookDeliveries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Downloader webhook deliveries attempted.",
+	})
+
+	WebhookFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_failures_total",
+		Help:      "Downloader webhook deliveries that failed.",
+	})
+
+	SpotifyLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "spotify_request_duration_seconds",
+		Help:      "Spotify API call latency, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "outcome"})
+
+	DBLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database query latency, by method.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"method", "outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		BotCommands,
+		WebhookDeliveries,
+		WebhookFailures,
+		SpotifyLatency,
+		DBLatency,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveCommand counts a handled bot command
+func ObserveCommand(command, outcome string) {
+	BotCommands.WithLabelValues(command, outcome).Inc()
+}
+
+func outcomeOf(err error) string {
+	if err != nil {
+		return OutcomeError
+	}
+	return OutcomeOK
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+)
+
+// queries is how many observations DBLatency holds for method and outcome
+func queries(t *testing.T, method, outcome string) uint64 {
+	t.Helper()
+
+	var m dto.Metric
+	if err := DBLatency.WithLabelValues(method, outcome).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("failed to read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestInstrumentDatabase(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		outcome string
+		call    func(db.Database) error
+	}{
+		{
+			name:    "successful query",
+			method:  "GetActiveRequests",
+			outcome: OutcomeOK,
+			call: func(d db.Database) error {
+				_, err := d.GetActiveRequests(context.Background())
+				return err
+			},
+		},
+		{
+			name:    "failed query",
+			method:  "DeactivateRequest",
+			outcome: OutcomeError,
+			call: func(d db.Database) error {
+				if err := d.DeactivateRequest(context.Background(), "missing"); err == nil {
+					t.Error("DeactivateRequest() expected an error")
+				}
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := queries(t, tt.method, tt.outcome)
+			if err := tt.call(InstrumentDatabase(db.NewMemoryDatabase())); err != nil {
+				t.Fatalf("%s() unexpected error: %v", tt.method, err)
+			}
+			if got := queries(t, tt.method, tt.outcome) - before; got != 1 {
+				t.Errorf("%s observations = %d, want 1", tt.method, got)
+			}
+		})
+	}
+}
+
+func TestObserveCommand(t *testing.T) {
+	counter := BotCommands.WithLabelValues("find", OutcomeOK)
+	before := testutil.ToFloat64(counter)
+
+	ObserveCommand("find", OutcomeOK)
+
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("bot_commands_total increased by %v, want 1", got)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	ObserveCommand("start", OutcomeOK)
+	if n, err := testutil.GatherAndCount(Registry, "album_queue_bot_commands_total"); err != nil || n == 0 {
+		t.Errorf("GatherAndCount() = %d, %v, want the registered counter", n, err)
+	}
+}
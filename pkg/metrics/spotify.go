@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/spotifysearch"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+// instrumentedSpotify records SpotifyLatency around the calls the bot makes.
+// Methods it does not override go straight to the embedded service.
+type instrumentedSpotify struct {
+	spotify.SpotifyService
+}
+
+func InstrumentSpotify(s spotify.SpotifyService) spotify.SpotifyService {
+	return &instrumentedSpotify{SpotifyService: s}
+}
+
+func (s *instrumentedSpotify) GetObjectName(ctx context.Context, url string) (string, error) {
+	start := time.Now()
+	name, err := s.SpotifyService.GetObjectName(ctx, url)
+	SpotifyLatency.WithLabelValues("GetObjectName", outcomeOf(err)).Observe(time.Since(start).Seconds())
+	return name, err
+}
+
+func (s *instrumentedSpotify) GetTrackCount(ctx context.Context, url string) (int, []spotify.TrackMetadata, error) {
+	start := time.Now()
+	count, tracks, err := s.SpotifyService.GetTrackCount(ctx, url)
+	SpotifyLatency.WithLabelValues("GetTrackCount", outcomeOf(err)).Observe(time.Since(start).Seconds())
+	return count, tracks, err
+}
+
+// SpotifySearcher is implemented by spotifysearch.Client
+type SpotifySearcher interface {
+	Search(ctx context.Context, query string, kinds []string, limit int) ([]spotifysearch.Result, error)
+}
+
+type instrumentedSearch struct {
+	SpotifySearcher
+}
+
+func InstrumentSpotifySearch(s SpotifySearcher) SpotifySearcher {
+	return &instrumentedSearch{SpotifySearcher: s}
+}
+
+func (s *instrumentedSearch) Search(ctx context.Context, query string, kinds []string, limit int) ([]spotifysearch.Result, error) {
+	start := time.Now()
+	results, err := s.SpotifySearcher.Search(ctx, query, kinds, limit)
+	SpotifyLatency.WithLabelValues("Search", outcomeOf(err)).Observe(time.Since(start).Seconds())
+	return results, err
+}
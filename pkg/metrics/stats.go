@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"go.uber.org/zap"
+)
+
+const statsTimeout = 5 * time.Second
+
+var (
+	totalMusicFilesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "music_files"),
+		"Music files indexed in the library.", nil, nil)
+	activeDownloadQueueDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "active_download_requests"),
+		"Download requests that are still active.", nil, nil)
+	totalDownloadRequestsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "download_requests"),
+		"Download requests ever made.", nil, nil)
+	activePlaylistsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "active_playlists"),
+		"Playlist requests that are still active.", nil, nil)
+)
+
+// statsCollector exposes db.Stats as gauges, read from the database on every scrape
+type statsCollector struct {
+	db  db.Database
+	log *zap.Logger
+}
+
+// RegisterStats exposes the database counters from db.Stats on the registry
+func RegisterStats(database db.Database, log *zap.Logger) error {
+	return Registry.Register(&statsCollector{db: database, log: log})
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- totalMusicFilesDesc
+	ch <- activeDownloadQueueDesc
+	ch <- totalDownloadRequestsDesc
+	ch <- activePlaylistsDesc
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+
+	stats, err := c.db.GetStats(ctx)
+	if err != nil {
+		c.log.Error("Failed to get stats for metrics", zap.Error(err))
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(totalMusicFilesDesc, prometheus.GaugeValue, float64(stats.TotalMusicFiles))
+	ch <- prometheus.MustNewConstMetric(activeDownloadQueueDesc, prometheus.GaugeValue, float64(stats.ActiveDownloadQueue))
+	ch <- prometheus.MustNewConstMetric(totalDownloadRequestsDesc, prometheus.GaugeValue, float64(stats.TotalDownloadRequests))
+	ch <- prometheus.MustNewConstMetric(activePlaylistsDesc, prometheus.GaugeValue, float64(stats.ActivePlaylists))
+}
@@ -0,0 +1,163 @@
+// Package notify messages users about their download requests, as their
+// preferences allow.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/i18n"
+	models "github.com/supperdoggy/spot-models"
+	"go.uber.org/zap"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// progressSteps splits a request into quarters, progress is reported once per quarter reached
+const progressSteps = 4
+
+// sentTTL is how long a notification is remembered. Reconciliations racing over the same
+// change finish well within it, and a later change only notifies for a step it newly reaches.
+const sentTTL = time.Hour
+
+// Sender is the part of *telebot.Bot notifications go out through
+type Sender interface {
+	Send(to telebot.Recipient, what interface{}, options ...interface{}) (*telebot.Message, error)
+}
+
+// Notifier tells request creators when their requests make progress or complete.
+// It is a reconcile.Observer. Users opt in through /settings, and notifications
+// during their quiet hours arrive silently. Requests made in a group are reported there.
+type Notifier struct {
+	db  db.Database
+	bot Sender
+	log *zap.Logger
+	now func() time.Time
+
+	mu       sync.Mutex
+	messages *i18n.Catalog
+	// sent remembers when each notification was reported, so reconciliations racing
+	// over the same request don't notify twice. Entries are dropped after sentTTL.
+	sent map[string]time.Time
+}
+
+func New(database db.Database, bot Sender, log *zap.Logger, messages *i18n.Catalog) *Notifier {
+	return &Notifier{
+		db:       database,
+		bot:      bot,
+		log:      log,
+		now:      time.Now,
+		messages: messages,
+		sent:     make(map[string]time.Time),
+	}
+}
+
+// Reload swaps in a new message catalog
+func (n *Notifier) Reload(messages *i18n.Catalog) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.messages = messages
+}
+
+func (n *Notifier) RequestUpdated(ctx context.Context, before, after models.DownloadQueueRequest) {
+	completed := before.Active && !after.Active
+	step := progressStep(after)
+	if !completed && step <= progressStep(before) {
+		return
+	}
+
+	prefs, err := n.db.GetUserPreferences(ctx, after.CreatorID)
+	if err != nil {
+		n.log.Error("Failed to get user preferences", zap.Error(err), zap.Int64("user_id", after.CreatorID))
+		return
+	}
+
+	var key string
+	switch {
+	case completed && prefs.NotifyCompletion:
+		key = i18n.NotifyCompleted
+	case !completed && prefs.NotifyProgress:
+		key = i18n.NotifyProgress
+	default:
+		return
+	}
+
+	if !n.markSent(fmt.Sprintf("%s/%s/%d", after.ID, key, step)) {
+		return
+	}
+
+	n.mu.Lock()
+	messages := n.messages
+	n.mu.Unlock()
+
+	text := messages.Text(messages.Locale(prefs.Language, ""), key, i18n.Args{
+		"Name":     after.Name,
+		"Tracks":   after.ExpectedTrackCount,
+		"Found":    after.FoundTrackCount,
+		"Expected": after.ExpectedTrackCount,
+	})
+
+	to, options := n.destination(ctx, after)
+	if prefs.InQuietHours(n.now()) {
+		options = append(options, telebot.Silent)
+	}
+
+	if _, err := n.bot.Send(to, text, options...); err != nil {
+		n.log.Error("Failed to send notification", zap.Error(err),
+			zap.Int64("user_id", after.CreatorID), zap.String("request_id", after.ID))
+	}
+}
+
+// destination is where notifications about r go: the group it was made in, replying to the
+// message that made it so they stay in its thread, or else a private chat with its creator.
+func (n *Notifier) destination(ctx context.Context, r models.DownloadQueueRequest) (telebot.Recipient, []interface{}) {
+	chat, err := n.db.GetRequestChat(ctx, r.ID)
+	if err != nil {
+		n.log.Error("Failed to get request chat", zap.Error(err), zap.String("request_id", r.ID))
+	}
+	if !chat.IsGroup() {
+		return recipient(r.CreatorID), nil
+	}
+
+	// Send options must come before flags like telebot.Silent, which would otherwise be overwritten
+	return recipient(chat.ID), []interface{}{&telebot.SendOptions{
+		ReplyTo:           &telebot.Message{ID: chat.MessageID},
+		AllowWithoutReply: true,
+	}}
+}
+
+func (n *Notifier) markSent(key string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := n.now()
+	for k, at := range n.sent {
+		if now.Sub(at) > sentTTL {
+			delete(n.sent, k)
+		}
+	}
+
+	if _, ok := n.sent[key]; ok {
+		return false
+	}
+	n.sent[key] = now
+	return true
+}
+
+// progressStep is the number of quarters of the request's tracks that are downloaded
+func progressStep(r models.DownloadQueueRequest) int {
+	if r.ExpectedTrackCount <= 0 {
+		return 0
+	}
+	return r.FoundTrackCount * progressSteps / r.ExpectedTrackCount
+}
+
+// recipient is a chat by ID, a private chat with a user shares the user's ID
+type recipient int64
+
+func (r recipient) Recipient() string {
+	return strconv.FormatInt(int64(r), 10)
+}
@@ -0,0 +1,204 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/i18n"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/source"
+	models "github.com/supperdoggy/spot-models"
+	"go.uber.org/zap"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+type sent struct {
+	to      string
+	text    string
+	silent  bool
+	replyTo int
+}
+
+type fakeSender struct {
+	sent []sent
+}
+
+func (s *fakeSender) Send(to telebot.Recipient, what interface{}, options ...interface{}) (*telebot.Message, error) {
+	msg := sent{to: to.Recipient(), text: fmt.Sprint(what)}
+	for _, o := range options {
+		if o == telebot.Silent {
+			msg.silent = true
+		}
+		if opts, ok := o.(*telebot.SendOptions); ok && opts.ReplyTo != nil {
+			msg.replyTo = opts.ReplyTo.ID
+		}
+	}
+	s.sent = append(s.sent, msg)
+	return &telebot.Message{}, nil
+}
+
+func TestNotifier(t *testing.T) {
+	const user = int64(7)
+	noon := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	request := models.DownloadQueueRequest{ID: "r1", Name: "OK Computer", CreatorID: user, Active: true, ExpectedTrackCount: 4}
+	with := func(found int, active bool) models.DownloadQueueRequest {
+		r := request
+		r.FoundTrackCount = found
+		r.Active = active
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		prefs    db.UserPreferences
+		before   models.DownloadQueueRequest
+		after    models.DownloadQueueRequest
+		expected []sent
+	}{
+		{
+			name:   "completion opted out",
+			before: with(3, true),
+			after:  with(4, false),
+		},
+		{
+			name:     "completion",
+			prefs:    db.UserPreferences{NotifyCompletion: true},
+			before:   with(3, true),
+			after:    with(4, false),
+			expected: []sent{{to: "7", text: "🎉 OK Computer завантажено повністю! (Треків: 4)"}},
+		},
+		{
+			name:     "completion in the user's language",
+			prefs:    db.UserPreferences{NotifyCompletion: true, Language: i18n.English},
+			before:   with(3, true),
+			after:    with(4, false),
+			expected: []sent{{to: "7", text: "🎉 OK Computer is fully downloaded! (Tracks: 4)"}},
+		},
+		{
+			name:     "completion during quiet hours is silent",
+			prefs:    db.UserPreferences{NotifyCompletion: true, QuietFrom: 11, QuietTo: 13},
+			before:   with(3, true),
+			after:    with(4, false),
+			expected: []sent{{to: "7", text: "🎉 OK Computer завантажено повністю! (Треків: 4)", silent: true}},
+		},
+		{
+			name:     "progress reaching a new quarter",
+			prefs:    db.UserPreferences{NotifyProgress: true},
+			before:   with(1, true),
+			after:    with(2, true),
+			expected: []sent{{to: "7", text: "📥 OK Computer: завантажено 2/4 треків"}},
+		},
+		{
+			name:   "progress opted out",
+			prefs:  db.UserPreferences{NotifyCompletion: true},
+			before: with(1, true),
+			after:  with(2, true),
+		},
+		{
+			name:   "progress within a quarter",
+			prefs:  db.UserPreferences{NotifyProgress: true},
+			before: models.DownloadQueueRequest{ID: "r2", CreatorID: user, Active: true, ExpectedTrackCount: 12, FoundTrackCount: 3},
+			after:  models.DownloadQueueRequest{ID: "r2", CreatorID: user, Active: true, ExpectedTrackCount: 12, FoundTrackCount: 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mem := db.NewMemoryDatabase()
+			tt.prefs.UserID = user
+			_ = mem.SaveUserPreferences(ctx, tt.prefs)
+
+			catalog, err := i18n.New(i18n.Ukrainian, nil)
+			if err != nil {
+				t.Fatalf("i18n.New() unexpected error: %v", err)
+			}
+			sender := &fakeSender{}
+			n := New(mem, sender, zap.NewNop(), catalog)
+			n.now = func() time.Time { return noon }
+
+			// A second reconciliation seeing the same change must not notify again
+			n.RequestUpdated(ctx, tt.before, tt.after)
+			n.RequestUpdated(ctx, tt.before, tt.after)
+
+			if len(sender.sent) != len(tt.expected) {
+				t.Fatalf("sent %+v, want %+v", sender.sent, tt.expected)
+			}
+			for i := range tt.expected {
+				if sender.sent[i] != tt.expected[i] {
+					t.Errorf("sent[%d] = %+v, want %+v", i, sender.sent[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNotifier_GroupRequest(t *testing.T) {
+	const user = int64(7)
+	ctx := context.Background()
+	mem := db.NewMemoryDatabase()
+	_ = mem.SaveUserPreferences(ctx, db.UserPreferences{UserID: user, NotifyCompletion: true})
+
+	group := db.Chat{ID: -1001234567890, MessageID: 42}
+	if err := mem.NewDownloadRequest(ctx, source.Spotify, "https://open.spotify.com/album/1", "OK Computer", user, group, 4, nil, nil); err != nil {
+		t.Fatalf("NewDownloadRequest() unexpected error: %v", err)
+	}
+	requests, err := mem.GetActiveRequests(ctx)
+	if err != nil || len(requests) != 1 {
+		t.Fatalf("GetActiveRequests() = %v, %v", requests, err)
+	}
+	before := requests[0]
+	before.FoundTrackCount = 3
+	after := before
+	after.FoundTrackCount = 4
+	after.Active = false
+
+	catalog, err := i18n.New(i18n.Ukrainian, nil)
+	if err != nil {
+		t.Fatalf("i18n.New() unexpected error: %v", err)
+	}
+	sender := &fakeSender{}
+	New(mem, sender, zap.NewNop(), catalog).RequestUpdated(ctx, before, after)
+
+	expected := sent{to: "-1001234567890", text: "🎉 OK Computer завантажено повністю! (Треків: 4)", replyTo: 42}
+	if len(sender.sent) != 1 || sender.sent[0] != expected {
+		t.Errorf("sent %+v, want %+v", sender.sent, expected)
+	}
+}
+
+func TestNotifier_ForgetsOldNotifications(t *testing.T) {
+	const user = int64(7)
+	ctx := context.Background()
+	mem := db.NewMemoryDatabase()
+	_ = mem.SaveUserPreferences(ctx, db.UserPreferences{UserID: user, NotifyCompletion: true})
+
+	catalog, err := i18n.New(i18n.Ukrainian, nil)
+	if err != nil {
+		t.Fatalf("i18n.New() unexpected error: %v", err)
+	}
+	sender := &fakeSender{}
+	n := New(mem, sender, zap.NewNop(), catalog)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return now }
+
+	complete := func(id string) {
+		before := models.DownloadQueueRequest{ID: id, CreatorID: user, Active: true, ExpectedTrackCount: 1}
+		after := before
+		after.Active, after.FoundTrackCount = false, 1
+		n.RequestUpdated(ctx, before, after)
+	}
+
+	complete("r1")
+	complete("r1")
+	now = now.Add(2 * sentTTL)
+	complete("r2")
+
+	if len(sender.sent) != 2 {
+		t.Errorf("sent %+v, want one notification per request", sender.sent)
+	}
+	if _, ok := n.sent["r1/"+i18n.NotifyCompleted+"/4"]; ok || len(n.sent) != 1 {
+		t.Errorf("remembered %v, want only r2", n.sent)
+	}
+}
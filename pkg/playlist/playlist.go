@@ -0,0 +1,126 @@
+// Package playlist exports download requests as M3U8 playlists of their files in the library,
+// for players and media servers such as Navidrome or Jellyfin.
+package playlist
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	models "github.com/supperdoggy/spot-models"
+)
+
+// ContentType is the MIME type of M3U8 playlists
+const ContentType = "audio/x-mpegurl"
+
+// Playlist is the library files of a request's tracks, in the request's order
+type Playlist struct {
+	Name  string
+	Files []models.MusicFile
+	// Tracks is how many tracks the request has, those not downloaded yet are left out of Files
+	Tracks int
+}
+
+// Build matches request's tracks against the library the same way reconciliation does
+func Build(ctx context.Context, database db.Database, request models.DownloadQueueRequest) (*Playlist, error) {
+	p := &Playlist{Name: request.Name, Tracks: len(request.TrackMetadata)}
+	if len(request.TrackMetadata) == 0 {
+		return p, nil
+	}
+
+	artists := make([]string, len(request.TrackMetadata))
+	titles := make([]string, len(request.TrackMetadata))
+	for i, track := range request.TrackMetadata {
+		artists[i], titles[i] = track.Artist, track.Title
+	}
+
+	files, err := database.FindMusicFiles(ctx, artists, titles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find music files: %w", err)
+	}
+
+	// A track may be in the library more than once, the first file found is used
+	byKey := make(map[string]models.MusicFile, len(files))
+	for _, f := range files {
+		key := utils.MatchKey(f.Artist, f.Title)
+		if _, ok := byKey[key]; !ok {
+			byKey[key] = f
+		}
+	}
+
+	for _, track := range request.TrackMetadata {
+		if f, ok := byKey[utils.MatchKey(track.Artist, track.Title)]; ok {
+			p.Files = append(p.Files, f)
+		}
+	}
+	return p, nil
+}
+
+// WriteM3U8 writes p as an extended M3U playlist, which is UTF-8 by definition of the .m3u8 extension
+func (p *Playlist) WriteM3U8(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#EXTM3U\n#PLAYLIST:%s\n", oneLine(p.Name))
+	for _, f := range p.Files {
+		duration := f.Duration
+		if duration <= 0 {
+			// -1 is M3U for an unknown duration
+			duration = -1
+		}
+		fmt.Fprintf(bw, "#EXTINF:%d,%s - %s\n%s\n", duration, oneLine(f.Artist), oneLine(f.Title), f.Path)
+	}
+	return bw.Flush()
+}
+
+// FileName is p's name made safe for file systems, with the .m3u8 extension
+func (p *Playlist) FileName() string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(p.Name))
+	if name == "" || strings.Trim(name, ".") == "" {
+		name = "playlist"
+	}
+	return name + ".m3u8"
+}
+
+// Save writes p into dir under FileName, replacing an earlier export of the same name.
+// The file is renamed into place, so a media server scanning dir never reads half of it.
+func (p *Playlist) Save(dir string) (string, error) {
+	tmp, err := os.CreateTemp(dir, ".playlist-*.m3u8")
+	if err != nil {
+		return "", fmt.Errorf("failed to create playlist file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := p.WriteM3U8(tmp); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write playlist: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write playlist: %w", err)
+	}
+	// CreateTemp makes the file private, media servers usually run as another user
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", fmt.Errorf("failed to set playlist permissions: %w", err)
+	}
+
+	path := filepath.Join(dir, p.FileName())
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to save playlist: %w", err)
+	}
+	return path, nil
+}
+
+// oneLine keeps tag values from breaking the line based format
+func oneLine(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == '\r' }), " ")
+}
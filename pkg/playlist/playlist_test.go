@@ -0,0 +1,111 @@
+package playlist
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	models "github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+func TestBuild(t *testing.T) {
+	mem := db.NewMemoryDatabase()
+	mem.AddMusicFiles(
+		models.MusicFile{Artist: "Portishead", Title: "Roads", Path: "/music/Portishead/Dummy/05 Roads.flac", Duration: 305},
+		models.MusicFile{Artist: "Radiohead", Title: "Airbag", Path: "/music/Radiohead/OK Computer/01 Airbag.flac", Duration: 284},
+		models.MusicFile{Artist: "Radiohead", Title: "Airbag", Path: "/music/Radiohead/Airbag EP/01 Airbag.mp3"},
+	)
+
+	request := models.DownloadQueueRequest{
+		Name: "Trip/Rock\nmix",
+		TrackMetadata: []spotify.TrackMetadata{
+			{Artist: "radiohead", Title: "AIRBAG"},
+			{Artist: "Massive Attack", Title: "Teardrop"},
+			{Artist: "Portishead", Title: "Roads"},
+		},
+	}
+
+	p, err := Build(context.Background(), mem, request)
+	if err != nil {
+		t.Fatalf("Build() unexpected error: %v", err)
+	}
+	if p.Tracks != 3 || len(p.Files) != 2 {
+		t.Fatalf("Build() = %+v, want 2 of 3 tracks", p)
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteM3U8(&buf); err != nil {
+		t.Fatalf("WriteM3U8() unexpected error: %v", err)
+	}
+	expected := "#EXTM3U\n" +
+		"#PLAYLIST:Trip/Rock mix\n" +
+		"#EXTINF:284,Radiohead - Airbag\n" +
+		"/music/Radiohead/OK Computer/01 Airbag.flac\n" +
+		"#EXTINF:305,Portishead - Roads\n" +
+		"/music/Portishead/Dummy/05 Roads.flac\n"
+	if buf.String() != expected {
+		t.Errorf("WriteM3U8() = %q, want %q", buf.String(), expected)
+	}
+
+	if name := p.FileName(); name != "Trip_Rock_mix.m3u8" {
+		t.Errorf("FileName() = %q", name)
+	}
+}
+
+func TestPlaylist_FileName(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		expected string
+	}{
+		{"plain", "OK Computer", "OK Computer.m3u8"},
+		{"separators", `AC/DC: Back in Black?`, "AC_DC_ Back in Black_.m3u8"},
+		{"unicode", "Океан Ельзи", "Океан Ельзи.m3u8"},
+		{"empty", "  ", "playlist.m3u8"},
+		{"dots", "..", "playlist.m3u8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (&Playlist{Name: tt.playlist}).FileName(); got != tt.expected {
+				t.Errorf("FileName() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPlaylist_Save(t *testing.T) {
+	dir := t.TempDir()
+	p := &Playlist{Name: "OK Computer", Files: []models.MusicFile{{Artist: "Radiohead", Title: "Airbag", Path: "/music/a.flac"}}}
+
+	// Saving again replaces the earlier export
+	for range 2 {
+		path, err := p.Save(dir)
+		if err != nil {
+			t.Fatalf("Save() unexpected error: %v", err)
+		}
+		if path != filepath.Join(dir, "OK Computer.m3u8") {
+			t.Errorf("Save() = %q", path)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("dir has %d files, want only the playlist", len(entries))
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "OK Computer.m3u8"))
+	if err != nil {
+		t.Fatalf("ReadFile() unexpected error: %v", err)
+	}
+	if expected := "#EXTM3U\n#PLAYLIST:OK Computer\n#EXTINF:-1,Radiohead - Airbag\n/music/a.flac\n"; string(content) != expected {
+		t.Errorf("saved %q, want %q", content, expected)
+	}
+}
@@ -0,0 +1,147 @@
+package reconcile
+
+import (
+	"context"
+	"time"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	models "github.com/supperdoggy/spot-models"
+	"go.uber.org/zap"
+)
+
+// Reconciler compares the tracks requests expect with the indexed library,
+// updating found counts and completing requests whose tracks have all landed.
+type Reconciler struct {
+	db        db.Database
+	log       *zap.Logger
+	observers []Observer
+}
+
+// Observer is told about every request a reconciliation changed and saved
+type Observer interface {
+	RequestUpdated(ctx context.Context, before, after models.DownloadQueueRequest)
+}
+
+func New(database db.Database, log *zap.Logger) *Reconciler {
+	return &Reconciler{db: database, log: log}
+}
+
+// Observe registers o for request updates. Call it before the reconciler is shared.
+func (r *Reconciler) Observe(o Observer) {
+	r.observers = append(r.observers, o)
+}
+
+// Pass caches library lookups for one reconciliation pass, so requests
+// sharing tracks, and repeated checks of the same request, hit the database once.
+type Pass struct {
+	db     db.Database
+	looked map[string]bool
+	found  map[string]bool
+}
+
+func (r *Reconciler) NewPass() *Pass {
+	return &Pass{
+		db:     r.db,
+		looked: make(map[string]bool),
+		found:  make(map[string]bool),
+	}
+}
+
+// Prefetch looks up every track of requests that this pass hasn't seen yet in one batch
+func (p *Pass) Prefetch(ctx context.Context, requests []models.DownloadQueueRequest) error {
+	var artists, titles []string
+	for _, r := range requests {
+		for _, track := range r.TrackMetadata {
+			key := utils.MatchKey(track.Artist, track.Title)
+			if p.looked[key] {
+				continue
+			}
+			p.looked[key] = true
+			artists = append(artists, track.Artist)
+			titles = append(titles, track.Title)
+		}
+	}
+
+	if len(artists) == 0 {
+		return nil
+	}
+
+	files, err := p.db.FindMusicFiles(ctx, artists, titles)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		p.found[utils.MatchKey(f.Artist, f.Title)] = true
+	}
+
+	return nil
+}
+
+// FoundCount returns how many of the request's expected tracks are in the library
+func (p *Pass) FoundCount(ctx context.Context, request models.DownloadQueueRequest) (int, error) {
+	if err := p.Prefetch(ctx, []models.DownloadQueueRequest{request}); err != nil {
+		return 0, err
+	}
+
+	found := 0
+	for _, track := range request.TrackMetadata {
+		if p.found[utils.MatchKey(track.Artist, track.Title)] {
+			found++
+		}
+	}
+
+	return found, nil
+}
+
+// Run refreshes the found track count of every request with track data, marks fully
+// downloaded requests as completed and saves them. It returns the updated requests.
+func (r *Reconciler) Run(ctx context.Context, requests []models.DownloadQueueRequest) ([]models.DownloadQueueRequest, error) {
+	pass := r.NewPass()
+	if err := pass.Prefetch(ctx, requests); err != nil {
+		return requests, err
+	}
+
+	for i := range requests {
+		if requests[i].ExpectedTrackCount == 0 || len(requests[i].TrackMetadata) == 0 {
+			continue
+		}
+
+		before := requests[i]
+		foundCount, err := pass.FoundCount(ctx, requests[i])
+		if err != nil {
+			r.log.Error("Failed to compare tracks", zap.Error(err), zap.String("request_id", requests[i].ID))
+			continue
+		}
+		requests[i].FoundTrackCount = foundCount
+		requests[i].UpdatedAt = time.Now().Unix()
+
+		// Mark as completed if all tracks are found
+		if foundCount == requests[i].ExpectedTrackCount && requests[i].Active {
+			requests[i].Active = false
+			r.log.Info("Marking request as completed",
+				zap.String("request_id", requests[i].ID),
+				zap.String("name", requests[i].Name),
+				zap.Int("found", foundCount),
+				zap.Int("expected", requests[i].ExpectedTrackCount))
+		}
+
+		if err := r.db.UpdateDownloadRequest(ctx, requests[i]); err != nil {
+			r.log.Error("Failed to update found track count", zap.Error(err), zap.String("request_id", requests[i].ID))
+			continue
+		}
+
+		if before.FoundTrackCount != foundCount || before.Active != requests[i].Active {
+			r.updated(ctx, before, requests[i])
+		}
+	}
+
+	return requests, nil
+}
+
+// updated tells the observers about a saved change to a request
+func (r *Reconciler) updated(ctx context.Context, before, after models.DownloadQueueRequest) {
+	for _, o := range r.observers {
+		o.RequestUpdated(ctx, before, after)
+	}
+}
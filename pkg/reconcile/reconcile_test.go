@@ -0,0 +1,133 @@
+package reconcile
+
+import (
+	"context"
+	"testing"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/source"
+	models "github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+	"go.uber.org/zap"
+)
+
+// countingDB counts library lookups
+type countingDB struct {
+	*db.MemoryDatabase
+	lookups int
+}
+
+func (c *countingDB) FindMusicFiles(ctx context.Context, artists, titles []string) ([]models.MusicFile, error) {
+	c.lookups++
+	return c.MemoryDatabase.FindMusicFiles(ctx, artists, titles)
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	mem := db.NewMemoryDatabase()
+	mem.AddMusicFiles(
+		models.MusicFile{Artist: "Radiohead", Title: "Airbag"},
+		models.MusicFile{Artist: "Radiohead", Title: "Paranoid Android"},
+	)
+
+	album := []spotify.TrackMetadata{
+		{Artist: "Radiohead", Title: "Airbag"},
+		{Artist: "Radiohead", Title: "Paranoid Android"},
+	}
+	mix := []spotify.TrackMetadata{
+		{Artist: "radiohead", Title: "airbag"},
+		{Artist: "Portishead", Title: "Roads"},
+	}
+	_ = mem.NewDownloadRequest(ctx, source.Spotify, "https://open.spotify.com/album/1", "OK Computer", 1, db.Chat{}, len(album), album, nil)
+	_ = mem.NewDownloadRequest(ctx, source.Spotify, "https://open.spotify.com/playlist/2", "Mix", 1, db.Chat{}, len(mix), mix, nil)
+	_ = mem.NewDownloadRequest(ctx, source.Spotify, "https://open.spotify.com/album/3", "No metadata", 1, db.Chat{}, 0, nil, nil)
+
+	database := &countingDB{MemoryDatabase: mem}
+	requests, err := database.GetActiveRequests(ctx)
+	if err != nil {
+		t.Fatalf("GetActiveRequests() unexpected error: %v", err)
+	}
+
+	requests, err = New(database, zap.NewNop()).Run(ctx, requests)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+
+	if database.lookups != 1 {
+		t.Errorf("FindMusicFiles called %d times, want 1 per pass", database.lookups)
+	}
+
+	byName := make(map[string]models.DownloadQueueRequest)
+	for _, r := range requests {
+		byName[r.Name] = r
+	}
+	if r := byName["OK Computer"]; r.FoundTrackCount != 2 || r.Active {
+		t.Errorf("OK Computer = found %d active %v, want 2 and completed", r.FoundTrackCount, r.Active)
+	}
+	if r := byName["Mix"]; r.FoundTrackCount != 1 || !r.Active {
+		t.Errorf("Mix = found %d active %v, want 1 and active", r.FoundTrackCount, r.Active)
+	}
+
+	active, _ := mem.GetActiveRequests(ctx)
+	if len(active) != 2 {
+		t.Errorf("%d requests active after Run, want 2", len(active))
+	}
+}
+
+func TestPass_CachesLookups(t *testing.T) {
+	ctx := context.Background()
+	database := &countingDB{MemoryDatabase: db.NewMemoryDatabase()}
+	database.AddMusicFiles(models.MusicFile{Artist: "Radiohead", Title: "Airbag"})
+
+	request := models.DownloadQueueRequest{TrackMetadata: []spotify.TrackMetadata{{Artist: "Radiohead", Title: "Airbag"}}}
+	pass := New(database, zap.NewNop()).NewPass()
+
+	for i := 0; i < 3; i++ {
+		found, err := pass.FoundCount(ctx, request)
+		if err != nil {
+			t.Fatalf("FoundCount() unexpected error: %v", err)
+		}
+		if found != 1 {
+			t.Errorf("FoundCount() = %d, want 1", found)
+		}
+	}
+
+	if database.lookups != 1 {
+		t.Errorf("FindMusicFiles called %d times, want 1", database.lookups)
+	}
+}
+
+type recordingObserver struct {
+	updates []models.DownloadQueueRequest
+}
+
+func (o *recordingObserver) RequestUpdated(ctx context.Context, before, after models.DownloadQueueRequest) {
+	o.updates = append(o.updates, after)
+}
+
+func TestRun_NotifiesObservers(t *testing.T) {
+	ctx := context.Background()
+	mem := db.NewMemoryDatabase()
+	tracks := []spotify.TrackMetadata{{Artist: "Radiohead", Title: "Airbag"}}
+	_ = mem.NewDownloadRequest(ctx, source.Spotify, "https://open.spotify.com/album/1", "OK Computer", 1, db.Chat{}, 1, tracks, nil)
+
+	observer := &recordingObserver{}
+	r := New(mem, zap.NewNop())
+	r.Observe(observer)
+
+	// Nothing changed yet, so nobody is told
+	if err := r.ReconcileActive(ctx); err != nil {
+		t.Fatalf("ReconcileActive() unexpected error: %v", err)
+	}
+	if len(observer.updates) != 0 {
+		t.Errorf("observer got %d updates for an unchanged request, want 0", len(observer.updates))
+	}
+
+	mem.AddMusicFiles(models.MusicFile{Artist: "Radiohead", Title: "Airbag"})
+	if err := r.ReconcileActive(ctx); err != nil {
+		t.Fatalf("ReconcileActive() unexpected error: %v", err)
+	}
+	if len(observer.updates) != 1 || observer.updates[0].Active || observer.updates[0].FoundTrackCount != 1 {
+		t.Errorf("observer updates = %+v, want one completed request", observer.updates)
+	}
+}
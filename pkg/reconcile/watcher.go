@@ -0,0 +1,201 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	models "github.com/supperdoggy/spot-models"
+	"go.uber.org/zap"
+)
+
+// WatcherSettings tune how the watcher keeps requests current
+type WatcherSettings struct {
+	// Stream follows the backend's change stream when it has one
+	Stream bool
+	// Interval is how often every active request is reconciled without a change stream
+	Interval time.Duration
+	// SafetyInterval is how often every active request is reconciled while the change stream
+	// is healthy, catching files the stream doesn't report, like ones that come in as updates
+	SafetyInterval time.Duration
+	// MinBackoff and MaxBackoff bound the wait before a failed change stream is reopened
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Watcher keeps found track counts current without anyone calling /queue. It follows
+// newly indexed files through the backend's change stream when it has one, and falls
+// back to reconciling every active request each interval when it doesn't.
+type Watcher struct {
+	r        *Reconciler
+	settings WatcherSettings
+}
+
+func (r *Reconciler) NewWatcher(settings WatcherSettings) *Watcher {
+	return &Watcher{r: r, settings: settings}
+}
+
+// Run blocks until ctx is done
+func (w *Watcher) Run(ctx context.Context) {
+	// Catch up on files indexed while the bot was down
+	w.reconcile(ctx)
+
+	watcher, ok := w.r.db.(db.MusicFileWatcher)
+	if !ok || !w.settings.Stream {
+		w.r.log.Info("Using periodic reconciliation", zap.Duration("interval", w.settings.Interval))
+		w.poll(ctx, w.settings.Interval)
+		return
+	}
+
+	safetyCtx, stopSafety := context.WithCancel(ctx)
+	go w.poll(safetyCtx, w.settings.SafetyInterval)
+
+	err := w.stream(ctx, watcher)
+	stopSafety()
+	if ctx.Err() != nil {
+		return
+	}
+
+	w.r.log.Info("Change streams not supported by database, using periodic reconciliation", zap.Error(err))
+	w.poll(ctx, w.settings.Interval)
+}
+
+// stream follows the change stream, reopening it with backoff after failures, until ctx is
+// done or the backend turns out not to support change streams
+func (w *Watcher) stream(ctx context.Context, watcher db.MusicFileWatcher) error {
+	var resume db.ResumeToken
+	backoff := w.settings.MinBackoff
+
+	w.r.log.Info("Watching music files for completed requests")
+	for {
+		started := time.Now()
+		token, err := watcher.WatchMusicFiles(ctx, resume, func(file models.MusicFile) {
+			if err := w.r.HandleNewFile(ctx, file); err != nil {
+				w.r.log.Error("Failed to reconcile new music file", zap.Error(err),
+					zap.String("artist", file.Artist), zap.String("title", file.Title))
+			}
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, db.ErrWatchUnsupported) {
+			return err
+		}
+		resume = token
+
+		// A stream that stayed up for a while was healthy, so start backing off afresh
+		if time.Since(started) > w.settings.MaxBackoff {
+			backoff = w.settings.MinBackoff
+		}
+		w.r.log.Warn("Music files change stream failed, reopening", zap.Error(err), zap.Duration("backoff", backoff))
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff = min(backoff*2, w.settings.MaxBackoff)
+	}
+}
+
+func (w *Watcher) poll(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.reconcile(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *Watcher) reconcile(ctx context.Context) {
+	if err := w.r.KeyNewMusicFiles(ctx); err != nil && ctx.Err() == nil {
+		w.r.log.Error("Failed to key new music files", zap.Error(err))
+	}
+	if err := w.r.ReconcileActive(ctx); err != nil && ctx.Err() == nil {
+		w.r.log.Error("Periodic reconciliation failed", zap.Error(err))
+	}
+}
+
+// KeyNewMusicFiles keys music files the indexer added, when the backend needs it. Until a file
+// is keyed lookups can't find it, so without a change stream that waits for the next pass.
+func (r *Reconciler) KeyNewMusicFiles(ctx context.Context) error {
+	refresher, ok := r.db.(db.MatchKeyRefresher)
+	if !ok {
+		return nil
+	}
+	return refresher.KeyNewMusicFiles(ctx)
+}
+
+// RefreshMatchKeys keys music files the indexer added or retagged, when the backend needs it.
+// It scans the whole collection, so only the reconcile subcommand runs it.
+func (r *Reconciler) RefreshMatchKeys(ctx context.Context) error {
+	refresher, ok := r.db.(db.MatchKeyRefresher)
+	if !ok {
+		return nil
+	}
+	return refresher.RefreshMatchKeys(ctx)
+}
+
+// ReconcileActive runs a reconciliation pass over every active request
+func (r *Reconciler) ReconcileActive(ctx context.Context) error {
+	requests, err := r.db.GetActiveRequests(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.Run(ctx, requests)
+	return err
+}
+
+// HandleNewFile counts file towards the active requests that expect it straight away, without
+// looking anything up. Only a request the file would complete is reconciled in full, so it
+// completes once every track really is in the library. A duplicate file can push a count too
+// high until then, the full reconciliation sets it straight.
+func (r *Reconciler) HandleNewFile(ctx context.Context, file models.MusicFile) error {
+	requests, err := r.db.GetActiveRequests(ctx)
+	if err != nil {
+		return err
+	}
+
+	key := utils.MatchKey(file.Artist, file.Title)
+	var completing []models.DownloadQueueRequest
+	for _, request := range requests {
+		matched := 0
+		for _, track := range request.TrackMetadata {
+			if utils.MatchKey(track.Artist, track.Title) == key {
+				matched++
+			}
+		}
+		if matched == 0 || request.ExpectedTrackCount == 0 {
+			continue
+		}
+
+		if request.FoundTrackCount+matched >= request.ExpectedTrackCount {
+			completing = append(completing, request)
+			continue
+		}
+
+		before := request
+		request.FoundTrackCount += matched
+		request.UpdatedAt = time.Now().Unix()
+		if err := r.db.UpdateDownloadRequest(ctx, request); err != nil {
+			r.log.Error("Failed to update found track count", zap.Error(err), zap.String("request_id", request.ID))
+			continue
+		}
+		r.updated(ctx, before, request)
+	}
+
+	if len(completing) == 0 {
+		return nil
+	}
+
+	_, err = r.Run(ctx, completing)
+	return err
+}
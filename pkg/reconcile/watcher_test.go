@@ -0,0 +1,274 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/db"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/source"
+	models "github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+	"go.uber.org/zap"
+)
+
+// streamingDB feeds files to the watcher the way a change stream would. The stream
+// fails after every failAfter files, to be resumed from the token it returns.
+type streamingDB struct {
+	*db.MemoryDatabase
+	files     chan models.MusicFile
+	failAfter int
+	resumed   []string
+}
+
+func (s *streamingDB) WatchMusicFiles(ctx context.Context, resume db.ResumeToken, fn func(models.MusicFile)) (db.ResumeToken, error) {
+	s.resumed = append(s.resumed, string(resume))
+	delivered := 0
+	for {
+		select {
+		case file := <-s.files:
+			s.AddMusicFiles(file)
+			fn(file)
+			delivered++
+			if delivered == s.failAfter {
+				return db.ResumeToken(file.Title), errors.New("connection reset")
+			}
+		case <-ctx.Done():
+			return resume, ctx.Err()
+		}
+	}
+}
+
+var testWatcherSettings = WatcherSettings{
+	Stream:         true,
+	Interval:       10 * time.Millisecond,
+	SafetyInterval: time.Hour,
+	MinBackoff:     time.Millisecond,
+	MaxBackoff:     10 * time.Millisecond,
+}
+
+func TestWatcher(t *testing.T) {
+	tracks := []spotify.TrackMetadata{
+		{Artist: "Radiohead", Title: "Airbag"},
+		{Artist: "Radiohead", Title: "Let Down"},
+	}
+
+	tests := []struct {
+		name  string
+		setup func(mem *db.MemoryDatabase) (db.Database, func(models.MusicFile))
+	}{
+		{
+			name: "change stream",
+			setup: func(mem *db.MemoryDatabase) (db.Database, func(models.MusicFile)) {
+				s := &streamingDB{MemoryDatabase: mem, files: make(chan models.MusicFile)}
+				return s, func(f models.MusicFile) { s.files <- f }
+			},
+		},
+		{
+			name: "change stream reopened after failures",
+			setup: func(mem *db.MemoryDatabase) (db.Database, func(models.MusicFile)) {
+				s := &streamingDB{MemoryDatabase: mem, files: make(chan models.MusicFile), failAfter: 1}
+				return s, func(f models.MusicFile) { s.files <- f }
+			},
+		},
+		{
+			name: "periodic fallback",
+			setup: func(mem *db.MemoryDatabase) (db.Database, func(models.MusicFile)) {
+				return mem, func(f models.MusicFile) { mem.AddMusicFiles(f) }
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			mem := db.NewMemoryDatabase()
+			_ = mem.NewDownloadRequest(ctx, source.Spotify, "https://open.spotify.com/album/1", "OK Computer", 1, db.Chat{}, len(tracks), tracks, nil)
+			database, insert := tt.setup(mem)
+
+			done := make(chan struct{})
+			go func() {
+				New(database, zap.NewNop()).NewWatcher(testWatcherSettings).Run(ctx)
+				close(done)
+			}()
+
+			insert(models.MusicFile{Artist: "Radiohead", Title: "Airbag"})
+			insert(models.MusicFile{Artist: "radiohead", Title: "Let Down"})
+
+			deadline := time.After(2 * time.Second)
+			for {
+				active, _ := mem.GetActiveRequests(ctx)
+				if len(active) == 0 {
+					break
+				}
+				select {
+				case <-deadline:
+					t.Fatalf("request still active with %d found tracks", active[0].FoundTrackCount)
+				case <-time.After(5 * time.Millisecond):
+				}
+			}
+
+			cancel()
+			<-done
+		})
+	}
+}
+
+func TestHandleNewFile_IgnoresUnrelatedFiles(t *testing.T) {
+	ctx := context.Background()
+	database := &countingDB{MemoryDatabase: db.NewMemoryDatabase()}
+	tracks := []spotify.TrackMetadata{{Artist: "Radiohead", Title: "Airbag"}}
+	_ = database.NewDownloadRequest(ctx, source.Spotify, "https://open.spotify.com/album/1", "OK Computer", 1, db.Chat{}, 1, tracks, nil)
+
+	r := New(database, zap.NewNop())
+	if err := r.HandleNewFile(ctx, models.MusicFile{Artist: "Portishead", Title: "Roads"}); err != nil {
+		t.Fatalf("HandleNewFile() unexpected error: %v", err)
+	}
+	if database.lookups != 0 {
+		t.Errorf("FindMusicFiles called %d times for an unrelated file, want 0", database.lookups)
+	}
+}
+
+func TestWatcher_ResumesStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := &streamingDB{MemoryDatabase: db.NewMemoryDatabase(), files: make(chan models.MusicFile), failAfter: 1}
+	done := make(chan struct{})
+	go func() {
+		New(s, zap.NewNop()).NewWatcher(testWatcherSettings).Run(ctx)
+		close(done)
+	}()
+
+	s.files <- models.MusicFile{Artist: "Radiohead", Title: "Airbag"}
+	s.files <- models.MusicFile{Artist: "Radiohead", Title: "Let Down"}
+	// Only a reopened stream can take the last file
+	s.files <- models.MusicFile{Artist: "Radiohead", Title: "Lucky"}
+	cancel()
+	<-done
+
+	if want := []string{"", "Airbag", "Let Down"}; len(s.resumed) < 3 || !slices.Equal(s.resumed[:3], want) {
+		t.Errorf("stream opened with resume tokens %q, want %q", s.resumed, want)
+	}
+}
+
+func TestWatcher_ReconcilesOnStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Indexed while the bot was down, the stream will never report it
+	s := &streamingDB{MemoryDatabase: db.NewMemoryDatabase(), files: make(chan models.MusicFile)}
+	s.AddMusicFiles(models.MusicFile{Artist: "Radiohead", Title: "Airbag"})
+	tracks := []spotify.TrackMetadata{{Artist: "Radiohead", Title: "Airbag"}}
+	_ = s.NewDownloadRequest(ctx, source.Spotify, "https://open.spotify.com/album/1", "OK Computer", 1, db.Chat{}, 1, tracks, nil)
+
+	done := make(chan struct{})
+	go func() {
+		New(s, zap.NewNop()).NewWatcher(testWatcherSettings).Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.After(2 * time.Second)
+	for {
+		active, _ := s.GetActiveRequests(ctx)
+		if len(active) == 0 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("request still active after startup reconciliation")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	cancel()
+	<-done
+}
+
+// keyingDB counts how match keys are maintained
+type keyingDB struct {
+	*db.MemoryDatabase
+	keyed, refreshed atomic.Int32
+}
+
+func (k *keyingDB) KeyNewMusicFiles(context.Context) error {
+	k.keyed.Add(1)
+	return nil
+}
+
+func (k *keyingDB) RefreshMatchKeys(context.Context) error {
+	k.refreshed.Add(1)
+	return nil
+}
+
+func TestWatcher_PeriodicPassOnlyKeysNewFiles(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	k := &keyingDB{MemoryDatabase: db.NewMemoryDatabase()}
+	settings := testWatcherSettings
+	settings.Stream = false
+	done := make(chan struct{})
+	go func() {
+		New(k, zap.NewNop()).NewWatcher(settings).Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.After(2 * time.Second)
+	for k.keyed.Load() < 3 {
+		select {
+		case <-deadline:
+			t.Fatal("periodic passes didn't key new files")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+
+	if got := k.refreshed.Load(); got != 0 {
+		t.Errorf("full rekeys = %d, want 0 outside the reconcile subcommand", got)
+	}
+}
+
+func TestHandleNewFile_CountsWithoutLookup(t *testing.T) {
+	ctx := context.Background()
+	database := &countingDB{MemoryDatabase: db.NewMemoryDatabase()}
+	tracks := []spotify.TrackMetadata{
+		{Artist: "Radiohead", Title: "Airbag"},
+		{Artist: "Radiohead", Title: "Let Down"},
+	}
+	_ = database.NewDownloadRequest(ctx, source.Spotify, "https://open.spotify.com/album/1", "OK Computer", 1, db.Chat{}, 2, tracks, nil)
+
+	observer := &recordingObserver{}
+	r := New(database, zap.NewNop())
+	r.Observe(observer)
+
+	file := models.MusicFile{Artist: "Radiohead", Title: "Airbag"}
+	database.AddMusicFiles(file)
+	if err := r.HandleNewFile(ctx, file); err != nil {
+		t.Fatalf("HandleNewFile() unexpected error: %v", err)
+	}
+	if database.lookups != 0 {
+		t.Errorf("FindMusicFiles called %d times for a file that doesn't complete the request, want 0", database.lookups)
+	}
+	if len(observer.updates) != 1 || observer.updates[0].FoundTrackCount != 1 || !observer.updates[0].Active {
+		t.Errorf("observer updates = %+v, want one active request with 1 found track", observer.updates)
+	}
+
+	file = models.MusicFile{Artist: "Radiohead", Title: "Let Down"}
+	database.AddMusicFiles(file)
+	if err := r.HandleNewFile(ctx, file); err != nil {
+		t.Fatalf("HandleNewFile() unexpected error: %v", err)
+	}
+	if database.lookups != 1 {
+		t.Errorf("FindMusicFiles called %d times for the completing file, want 1", database.lookups)
+	}
+	if active, _ := database.GetActiveRequests(ctx); len(active) != 0 {
+		t.Errorf("%d requests active after the last track landed, want 0", len(active))
+	}
+}
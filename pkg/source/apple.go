@@ -0,0 +1,112 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/spotifysearch"
+)
+
+const (
+	appleMusicHost = "music.apple.com"
+	// appleLookupURL is the public iTunes Search API lookup endpoint, it needs no key
+	appleLookupURL = "https://itunes.apple.com/lookup"
+)
+
+// appleSuffixes are appended to single and EP titles, but not on Spotify
+var appleSuffixes = []string{" - Single", " - EP"}
+
+type appleMusic struct {
+	client    *http.Client
+	lookupURL string
+}
+
+// NewAppleMusic looks up music.apple.com album and song links. A nil client
+// uses one with a timeout.
+func NewAppleMusic(client *http.Client) MetadataProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &appleMusic{client: client, lookupURL: appleLookupURL}
+}
+
+func (a *appleMusic) Name() string {
+	return AppleMusic
+}
+
+// appleLink is a parsed music.apple.com/<country>/album|song/<slug>/<id> link.
+// An album link with ?i=<id> points at one of its songs.
+type appleLink struct {
+	country string
+	kind    string
+	id      string
+}
+
+func parseAppleLink(link string) (appleLink, bool) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Scheme != "https" || u.Host != appleMusicHost {
+		return appleLink{}, false
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 3 {
+		return appleLink{}, false
+	}
+	parsed := appleLink{country: parts[0], id: parts[len(parts)-1]}
+
+	switch parts[1] {
+	case "album":
+		parsed.kind = spotifysearch.Album
+		if song := u.Query().Get("i"); song != "" {
+			parsed.kind, parsed.id = spotifysearch.Track, song
+		}
+	case "song":
+		parsed.kind = spotifysearch.Track
+	default:
+		return appleLink{}, false
+	}
+	return parsed, true
+}
+
+func (a *appleMusic) Match(link string) bool {
+	_, ok := parseAppleLink(link)
+	return ok
+}
+
+type appleLookup struct {
+	Results []struct {
+		ArtistName     string `json:"artistName"`
+		CollectionName string `json:"collectionName"`
+		TrackName      string `json:"trackName"`
+	} `json:"results"`
+}
+
+func (a *appleMusic) Lookup(ctx context.Context, link string) (*Release, error) {
+	parsed, ok := parseAppleLink(link)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	params := url.Values{"id": {parsed.id}, "country": {parsed.country}}
+	var lookup appleLookup
+	if err := getJSON(ctx, a.client, a.lookupURL+"?"+params.Encode(), &lookup); err != nil {
+		return nil, err
+	}
+	if len(lookup.Results) == 0 {
+		return nil, fmt.Errorf("apple music %s %s not found", parsed.kind, parsed.id)
+	}
+
+	result := lookup.Results[0]
+	release := &Release{Kind: parsed.kind, Artist: result.ArtistName, Title: result.TrackName}
+	if parsed.kind == spotifysearch.Album {
+		release.Title = result.CollectionName
+		for _, suffix := range appleSuffixes {
+			release.Title = strings.TrimSuffix(release.Title, suffix)
+		}
+	}
+	return release, nil
+}
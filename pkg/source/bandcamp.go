@@ -0,0 +1,110 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+const bandcampHostSuffix = ".bandcamp.com"
+
+// bandcampTralbum finds the release JSON Bandcamp embeds in a script tag attribute
+var bandcampTralbum = regexp.MustCompile(`data-tralbum="([^"]*)"`)
+
+type bandcampResolver struct {
+	client *http.Client
+}
+
+// NewBandcamp resolves <artist>.bandcamp.com album and track pages. A nil client
+// uses one with a timeout.
+func NewBandcamp(client *http.Client) Resolver {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &bandcampResolver{client: client}
+}
+
+func (b *bandcampResolver) Name() string {
+	return Bandcamp
+}
+
+func (b *bandcampResolver) Match(link string) bool {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || !strings.HasSuffix(u.Host, bandcampHostSuffix) {
+		return false
+	}
+	return strings.HasPrefix(u.Path, "/album/") || strings.HasPrefix(u.Path, "/track/")
+}
+
+func (b *bandcampResolver) Resolve(ctx context.Context, link string) (*Resolution, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSpace(link), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bandcamp page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get bandcamp page: status %d", resp.StatusCode)
+	}
+
+	page, err := readPage(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bandcamp page: %w", err)
+	}
+
+	return parseBandcampPage(page)
+}
+
+// bandcampRelease is the part of data-tralbum the resolver reads
+type bandcampRelease struct {
+	Artist  string `json:"artist"`
+	Current struct {
+		Title string `json:"title"`
+		Type  string `json:"type"`
+	} `json:"current"`
+	TrackInfo []struct {
+		Title string `json:"title"`
+		// Artist is only set on tracks by someone other than the release artist, as on compilations
+		Artist string `json:"artist"`
+	} `json:"trackinfo"`
+}
+
+func parseBandcampPage(page []byte) (*Resolution, error) {
+	match := bandcampTralbum.FindSubmatch(page)
+	if match == nil {
+		return nil, errors.New("no data-tralbum found on bandcamp page")
+	}
+
+	var release bandcampRelease
+	if err := json.Unmarshal([]byte(html.UnescapeString(string(match[1]))), &release); err != nil {
+		return nil, fmt.Errorf("failed to decode data-tralbum: %w", err)
+	}
+
+	res := &Resolution{Name: release.Current.Title, TrackCount: len(release.TrackInfo)}
+	if release.Current.Type == "track" {
+		res.Name = release.Artist + " - " + release.Current.Title
+	}
+	for _, track := range release.TrackInfo {
+		artist := track.Artist
+		if artist == "" {
+			artist = release.Artist
+		}
+		res.Tracks = append(res.Tracks, spotify.TrackMetadata{Artist: artist, Title: track.Title})
+	}
+
+	return res, nil
+}
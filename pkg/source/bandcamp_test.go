@@ -0,0 +1,137 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+func TestBandcamp_Match(t *testing.T) {
+	tests := []struct {
+		name     string
+		link     string
+		expected bool
+	}{
+		{"album", "https://suicide.bandcamp.com/album/suicide", true},
+		{"track", "https://suicide.bandcamp.com/track/dream-baby-dream", true},
+		{"artist page", "https://suicide.bandcamp.com/music", false},
+		{"bandcamp home", "https://bandcamp.com/album/x", false},
+		{"look-alike host", "https://bandcamp.com.example.com/album/x", false},
+		{"spotify", "https://open.spotify.com/album/123", false},
+	}
+
+	resolver := NewBandcamp(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolver.Match(tt.link); got != tt.expected {
+				t.Errorf("Match(%q) = %v, want %v", tt.link, got, tt.expected)
+			}
+		})
+	}
+}
+
+// fixtureTransport answers requests with a saved response from testdata, chosen by
+// the id query parameter if there is one and the last path element otherwise
+type fixtureTransport map[string]string
+
+func (f fixtureTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	key := r.URL.Query().Get("id")
+	if key == "" {
+		key = filepath.Base(r.URL.Path)
+	}
+	fixture, ok := f[key]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody, Request: r}, nil
+	}
+	file, err := os.Open(filepath.Join("testdata", fixture))
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: file, Request: r}, nil
+}
+
+func TestBandcamp_Resolve(t *testing.T) {
+	resolver := NewBandcamp(&http.Client{Transport: fixtureTransport{
+		"voices-from-the-lake": "bandcamp_album.html",
+		"dream-baby-dream":     "bandcamp_track.html",
+		"music":                "bandcamp_artist.html",
+	}})
+
+	tests := []struct {
+		name     string
+		link     string
+		expected *Resolution
+		wantErr  string
+	}{
+		{
+			name: "compilation keeps per-track artists",
+			link: "https://voicesfromthelake.bandcamp.com/album/voices-from-the-lake",
+			expected: &Resolution{
+				Name:       "Voices From the Lake",
+				TrackCount: 3,
+				Tracks: []spotify.TrackMetadata{
+					{Artist: "Donato Dozzy", Title: "Velo"},
+					{Artist: "Various Artists", Title: "Iyo"},
+					{Artist: "Neel", Title: "Rocks & Sand"},
+				},
+			},
+		},
+		{
+			name: "track",
+			link: "https://suicide.bandcamp.com/track/dream-baby-dream",
+			expected: &Resolution{
+				Name:       "Suicide - Dream Baby Dream",
+				TrackCount: 1,
+				Tracks:     []spotify.TrackMetadata{{Artist: "Suicide", Title: "Dream Baby Dream"}},
+			},
+		},
+		{
+			name:    "page without release data",
+			link:    "https://suicide.bandcamp.com/album/music",
+			wantErr: "no data-tralbum",
+		},
+		{
+			name:    "missing page",
+			link:    "https://suicide.bandcamp.com/album/gone",
+			wantErr: "status 404",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolver.Resolve(context.Background(), tt.link)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBandcamp_ResolveCapsPageSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat(" ", maxPageBytes+1)))
+	}))
+	defer srv.Close()
+
+	_, err := NewBandcamp(srv.Client()).Resolve(context.Background(), srv.URL+"/album/huge")
+	if !errors.Is(err, errPageTooLarge) {
+		t.Errorf("Resolve() error = %v, want %v", err, errPageTooLarge)
+	}
+}
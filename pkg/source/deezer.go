@@ -0,0 +1,88 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/spotifysearch"
+)
+
+// deezerAPIURL is Deezer's public API, album and track lookups need no key
+const deezerAPIURL = "https://api.deezer.com"
+
+type deezer struct {
+	client *http.Client
+	apiURL string
+}
+
+// NewDeezer looks up deezer.com album and track links. A nil client uses one with a timeout.
+func NewDeezer(client *http.Client) MetadataProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &deezer{client: client, apiURL: deezerAPIURL}
+}
+
+func (d *deezer) Name() string {
+	return Deezer
+}
+
+// parseDeezerLink returns the kind and ID of a deezer.com/[<lang>/]album|track/<id> link
+func parseDeezerLink(link string) (string, string, bool) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Scheme != "https" || (u.Host != "www.deezer.com" && u.Host != "deezer.com") {
+		return "", "", false
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) == 3 {
+		// Drop the language prefix
+		parts = parts[1:]
+	}
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", false
+	}
+
+	switch parts[0] {
+	case spotifysearch.Album, spotifysearch.Track:
+		return parts[0], parts[1], true
+	}
+	return "", "", false
+}
+
+func (d *deezer) Match(link string) bool {
+	_, _, ok := parseDeezerLink(link)
+	return ok
+}
+
+type deezerObject struct {
+	Title  string `json:"title"`
+	Artist struct {
+		Name string `json:"name"`
+	} `json:"artist"`
+	// Error is set instead of a 404 status for unknown IDs
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (d *deezer) Lookup(ctx context.Context, link string) (*Release, error) {
+	kind, id, ok := parseDeezerLink(link)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	var obj deezerObject
+	if err := getJSON(ctx, d.client, d.apiURL+"/"+kind+"/"+url.PathEscape(id), &obj); err != nil {
+		return nil, err
+	}
+	if obj.Error != nil {
+		return nil, fmt.Errorf("deezer %s %s: %s", kind, id, obj.Error.Message)
+	}
+
+	return &Release{Kind: kind, Artist: obj.Artist.Name, Title: obj.Title}, nil
+}
@@ -0,0 +1,81 @@
+// Package source resolves the links users send into something the downloader can fetch.
+package source
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/spotifysearch"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+// Names stored on each request, so the downloader knows how to fetch it
+const (
+	Spotify      = utils.SourceSpotify
+	YouTubeMusic = utils.SourceYouTubeMusic
+	Bandcamp     = utils.SourceBandcamp
+)
+
+// ErrUnsupported is returned for links no resolver recognises
+var ErrUnsupported = errors.New("unsupported link")
+
+// maxPageBytes caps the pages read for links users send, real album pages stay under 2 MiB
+const maxPageBytes = 8 << 20
+
+// errPageTooLarge is returned for pages over maxPageBytes
+var errPageTooLarge = errors.New("page is larger than 8 MiB")
+
+// readPage reads a page of at most maxPageBytes
+func readPage(r io.Reader) ([]byte, error) {
+	page, err := io.ReadAll(io.LimitReader(r, maxPageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(page) > maxPageBytes {
+		return nil, errPageTooLarge
+	}
+	return page, nil
+}
+
+// Resolver looks up the name and tracks behind a link from one music service
+type Resolver interface {
+	// Name is the source stored on requests created from its links
+	Name() string
+	// Match reports whether link belongs to this service
+	Match(link string) bool
+	Resolve(ctx context.Context, link string) (*Resolution, error)
+}
+
+// Resolution is what a resolver found for a link
+type Resolution struct {
+	Name string
+	// TrackCount is how many tracks the link has, which can exceed len(Tracks)
+	// when some had no usable metadata
+	TrackCount int
+	Tracks     []spotify.TrackMetadata
+	// TracksErr is set when the name was found but the track listing wasn't.
+	// The request is still queued, just without tracks to reconcile.
+	TracksErr error
+
+	// Source and Link are set when the link was translated to another service,
+	// they replace the resolver's name and the link the user sent on the request
+	Source string
+	Link   string
+	// Match is the search result the link was translated to, to confirm with the user
+	Match *spotifysearch.Result
+}
+
+// Resolvers are tried in order, the first match wins
+type Resolvers []Resolver
+
+// For returns the resolver for link, or ErrUnsupported
+func (r Resolvers) For(link string) (Resolver, error) {
+	for _, resolver := range r {
+		if resolver.Match(link) {
+			return resolver, nil
+		}
+	}
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,48 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/utils"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+// SpotifyService is the part of spotify.SpotifyService the resolver uses
+type SpotifyService interface {
+	GetObjectName(ctx context.Context, url string) (string, error)
+	GetTrackCount(ctx context.Context, url string) (int, []spotify.TrackMetadata, error)
+}
+
+type spotifyResolver struct {
+	service SpotifyService
+}
+
+// NewSpotify resolves open.spotify.com playlist, album and track links
+func NewSpotify(service SpotifyService) Resolver {
+	return &spotifyResolver{service: service}
+}
+
+func (s *spotifyResolver) Name() string {
+	return Spotify
+}
+
+func (s *spotifyResolver) Match(link string) bool {
+	return utils.IsValidSpotifyURL(link)
+}
+
+func (s *spotifyResolver) Resolve(ctx context.Context, link string) (*Resolution, error) {
+	name, err := s.service.GetObjectName(ctx, link)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object name from Spotify: %w", err)
+	}
+
+	res := &Resolution{Name: name}
+	if count, tracks, err := s.service.GetTrackCount(ctx, link); err != nil {
+		res.TracksErr = fmt.Errorf("failed to get track count from Spotify: %w", err)
+	} else {
+		res.TrackCount, res.Tracks = count, tracks
+	}
+
+	return res, nil
+}
@@ -0,0 +1,120 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/spotifysearch"
+)
+
+// Services whose links are translated to Spotify before queuing
+const (
+	AppleMusic = "apple_music"
+	Deezer     = "deezer"
+)
+
+// ErrNoMatch is returned when a release has no Spotify equivalent
+var ErrNoMatch = errors.New("no match on spotify")
+
+// Release is what a metadata provider knows about a link
+type Release struct {
+	// Kind is spotifysearch.Album or spotifysearch.Track
+	Kind   string
+	Artist string
+	Title  string
+}
+
+// MetadataProvider looks up a link on a service the downloader can't fetch from
+type MetadataProvider interface {
+	Name() string
+	Match(link string) bool
+	Lookup(ctx context.Context, link string) (*Release, error)
+}
+
+// SpotifySearcher is the part of spotifysearch.Client the translator uses
+type SpotifySearcher interface {
+	Search(ctx context.Context, query string, kinds []string, limit int) ([]spotifysearch.Result, error)
+}
+
+type translator struct {
+	provider MetadataProvider
+	search   SpotifySearcher
+	spotify  Resolver
+}
+
+// NewTranslator resolves links from provider by searching Spotify for the same
+// release and resolving that through spotify. Requests are stored as Spotify ones.
+func NewTranslator(provider MetadataProvider, search SpotifySearcher, spotify Resolver) Resolver {
+	return &translator{provider: provider, search: search, spotify: spotify}
+}
+
+func (t *translator) Name() string {
+	return t.provider.Name()
+}
+
+func (t *translator) Match(link string) bool {
+	return t.provider.Match(link)
+}
+
+func (t *translator) Resolve(ctx context.Context, link string) (*Resolution, error) {
+	release, err := t.provider.Lookup(ctx, link)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s link: %w", t.provider.Name(), err)
+	}
+
+	field := "album"
+	if release.Kind == spotifysearch.Track {
+		field = "track"
+	}
+	query := fmt.Sprintf("%s:%s artist:%s", field, quote(release.Title), quote(release.Artist))
+
+	results, err := t.search.Search(ctx, query, []string{release.Kind}, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search spotify: %w", err)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%w: %s - %s", ErrNoMatch, release.Artist, release.Title)
+	}
+	match := results[0]
+
+	res, err := t.spotify.Resolve(ctx, match.URL)
+	if err != nil {
+		return nil, err
+	}
+	res.Source = t.spotify.Name()
+	res.Link = match.URL
+	res.Match = &match
+	return res, nil
+}
+
+// quote wraps a search term so multi-word titles are matched as a phrase
+func quote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "") + `"`
+}
+
+// getJSON decodes the JSON body of a GET request to endpoint into v
+func getJSON(ctx context.Context, client *http.Client, endpoint string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get %s: status %d", endpoint, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", endpoint, err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/spotifysearch"
+	"github.com/supperdoggy/SmartHomeServer/music-services/album-queue/pkg/spotifytest"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+func TestMetadataProviders(t *testing.T) {
+	client := &http.Client{Transport: fixtureTransport{
+		"1097861387": "apple_album.json",
+		"1097861392": "apple_song.json",
+		"1641364548": "apple_single.json",
+		"404":        "apple_missing.json",
+		"6575789":    "deezer_album.json",
+		"65531706":   "deezer_track.json",
+		"1":          "deezer_missing.json",
+	}}
+	apple, deezer := NewAppleMusic(client), NewDeezer(client)
+
+	tests := []struct {
+		name     string
+		provider MetadataProvider
+		link     string
+		match    bool
+		expected *Release
+	}{
+		{
+			name:     "apple album",
+			provider: apple,
+			link:     "https://music.apple.com/us/album/ok-computer/1097861387",
+			match:    true,
+			expected: &Release{Kind: spotifysearch.Album, Artist: "Radiohead", Title: "OK Computer"},
+		},
+		{
+			name:     "apple song within album",
+			provider: apple,
+			link:     "https://music.apple.com/us/album/ok-computer/1097861387?i=1097861392",
+			match:    true,
+			expected: &Release{Kind: spotifysearch.Track, Artist: "Radiohead", Title: "Airbag"},
+		},
+		{
+			name:     "apple song",
+			provider: apple,
+			link:     "https://music.apple.com/gb/song/airbag/1097861392",
+			match:    true,
+			expected: &Release{Kind: spotifysearch.Track, Artist: "Radiohead", Title: "Airbag"},
+		},
+		{
+			name:     "apple EP suffix is dropped",
+			provider: apple,
+			link:     "https://music.apple.com/gb/album/streetlands-ep/1641364548",
+			match:    true,
+			expected: &Release{Kind: spotifysearch.Album, Artist: "Burial", Title: "Streetlands"},
+		},
+		{
+			name:     "apple not found",
+			provider: apple,
+			link:     "https://music.apple.com/us/album/gone/404",
+			match:    true,
+		},
+		{
+			name:     "apple playlist",
+			provider: apple,
+			link:     "https://music.apple.com/us/playlist/todays-hits/pl.f4d106fed2bd41149aaacabb233eb5eb",
+		},
+		{
+			name:     "deezer album with language",
+			provider: deezer,
+			link:     "https://www.deezer.com/en/album/6575789",
+			match:    true,
+			expected: &Release{Kind: spotifysearch.Album, Artist: "Radiohead", Title: "OK Computer"},
+		},
+		{
+			name:     "deezer track",
+			provider: deezer,
+			link:     "https://deezer.com/track/65531706",
+			match:    true,
+			expected: &Release{Kind: spotifysearch.Track, Artist: "Radiohead", Title: "Paranoid Android"},
+		},
+		{
+			name:     "deezer error body",
+			provider: deezer,
+			link:     "https://www.deezer.com/album/1",
+			match:    true,
+		},
+		{
+			name:     "deezer playlist",
+			provider: deezer,
+			link:     "https://www.deezer.com/en/playlist/908622995",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.provider.Match(tt.link); got != tt.match {
+				t.Fatalf("Match(%q) = %v, want %v", tt.link, got, tt.match)
+			}
+			if !tt.match {
+				return
+			}
+
+			got, err := tt.provider.Lookup(context.Background(), tt.link)
+			if tt.expected == nil {
+				if err == nil {
+					t.Errorf("Lookup() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Lookup() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Lookup() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// stubProvider returns release for every link
+type stubProvider struct {
+	release *Release
+	err     error
+}
+
+func (s stubProvider) Name() string      { return Deezer }
+func (s stubProvider) Match(string) bool { return true }
+func (s stubProvider) Lookup(context.Context, string) (*Release, error) {
+	return s.release, s.err
+}
+
+// stubSearch returns results and records the last query
+type stubSearch struct {
+	results []spotifysearch.Result
+	query   string
+}
+
+func (s *stubSearch) Search(_ context.Context, query string, _ []string, _ int) ([]spotifysearch.Result, error) {
+	s.query = query
+	return s.results, nil
+}
+
+func TestTranslator_Resolve(t *testing.T) {
+	const spotifyURL = "https://open.spotify.com/album/ok-computer"
+	okComputer := []spotify.TrackMetadata{{Artist: "Radiohead", Title: "Airbag"}}
+	match := spotifysearch.Result{Kind: spotifysearch.Album, Name: "OK Computer", Artist: "Radiohead", URL: spotifyURL}
+	errLookup := errors.New("lookup failed")
+
+	tests := []struct {
+		name      string
+		provider  stubProvider
+		results   []spotifysearch.Result
+		wantQuery string
+		expected  *Resolution
+		wantErr   error
+	}{
+		{
+			name:      "album is resolved through spotify",
+			provider:  stubProvider{release: &Release{Kind: spotifysearch.Album, Artist: "Radiohead", Title: "OK Computer"}},
+			results:   []spotifysearch.Result{match},
+			wantQuery: `album:"OK Computer" artist:"Radiohead"`,
+			expected: &Resolution{
+				Name: "OK Computer", TrackCount: 1, Tracks: okComputer,
+				Source: Spotify, Link: spotifyURL, Match: &match,
+			},
+		},
+		{
+			name:      "no spotify match",
+			provider:  stubProvider{release: &Release{Kind: spotifysearch.Track, Artist: "Nobody", Title: `Say "hi"`}},
+			wantQuery: `track:"Say hi" artist:"Nobody"`,
+			wantErr:   ErrNoMatch,
+		},
+		{
+			name:     "lookup failure",
+			provider: stubProvider{err: errLookup},
+			wantErr:  errLookup,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			search := &stubSearch{results: tt.results}
+			spotifyService := spotifytest.NewFake().AddObject(spotifyURL, "OK Computer", okComputer...)
+			resolver := NewTranslator(tt.provider, search, NewSpotify(spotifyService))
+
+			got, err := resolver.Resolve(context.Background(), "https://www.deezer.com/album/6575789")
+			if search.query != tt.wantQuery {
+				t.Errorf("search query = %q, want %q", search.query, tt.wantQuery)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Resolve() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+const (
+	youTubeMusicHost   = "music.youtube.com"
+	youTubeDataAPIURL  = "https://www.googleapis.com/youtube/v3"
+	youTubeMusicURL    = "https://" + youTubeMusicHost
+	youTubeTopicSuffix = " - Topic"
+	// youTubeAlbumPrefix starts the title of the playlists YouTube generates for albums
+	youTubeAlbumPrefix = "Album - "
+)
+
+// youTubeAlbumPlaylist finds the playlist behind a /browse/MPREb_ album page
+var youTubeAlbumPlaylist = regexp.MustCompile(`OLAK5uy_[A-Za-z0-9_-]+`)
+
+// YouTubeVideo is the part of a video the resolver turns into track metadata
+type YouTubeVideo struct {
+	Title   string
+	Channel string
+}
+
+// YouTubeAPI is the YouTube lookups the resolver needs, stubbed in tests
+type YouTubeAPI interface {
+	// Playlist returns the title of a playlist and its videos in order
+	Playlist(ctx context.Context, id string) (string, []YouTubeVideo, error)
+	Video(ctx context.Context, id string) (*YouTubeVideo, error)
+	// AlbumPlaylistID maps an album browse ID to the playlist holding its tracks
+	AlbumPlaylistID(ctx context.Context, browseID string) (string, error)
+}
+
+type youTubeResolver struct {
+	api YouTubeAPI
+}
+
+// NewYouTubeMusic resolves music.youtube.com playlist, album and watch links
+func NewYouTubeMusic(api YouTubeAPI) Resolver {
+	return &youTubeResolver{api: api}
+}
+
+func (y *youTubeResolver) Name() string {
+	return YouTubeMusic
+}
+
+// youTubeLink is a parsed music.youtube.com link, exactly one field is set
+type youTubeLink struct {
+	playlist string
+	album    string
+	video    string
+}
+
+func parseYouTubeLink(link string) (youTubeLink, bool) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host != youTubeMusicHost {
+		return youTubeLink{}, false
+	}
+
+	switch {
+	case u.Path == "/playlist" && u.Query().Get("list") != "":
+		return youTubeLink{playlist: u.Query().Get("list")}, true
+	case u.Path == "/watch" && u.Query().Get("v") != "":
+		return youTubeLink{video: u.Query().Get("v")}, true
+	case strings.HasPrefix(u.Path, "/browse/MPREb_"):
+		return youTubeLink{album: strings.TrimPrefix(u.Path, "/browse/")}, true
+	}
+	return youTubeLink{}, false
+}
+
+func (y *youTubeResolver) Match(link string) bool {
+	_, ok := parseYouTubeLink(link)
+	return ok
+}
+
+func (y *youTubeResolver) Resolve(ctx context.Context, link string) (*Resolution, error) {
+	parsed, ok := parseYouTubeLink(link)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	if parsed.video != "" {
+		video, err := y.api.Video(ctx, parsed.video)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get youtube video: %w", err)
+		}
+		track := youTubeTrack(*video)
+		return &Resolution{
+			Name:       track.Artist + " - " + track.Title,
+			TrackCount: 1,
+			Tracks:     []spotify.TrackMetadata{track},
+		}, nil
+	}
+
+	playlistID := parsed.playlist
+	if parsed.album != "" {
+		id, err := y.api.AlbumPlaylistID(ctx, parsed.album)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find youtube album playlist: %w", err)
+		}
+		playlistID = id
+	}
+
+	title, videos, err := y.api.Playlist(ctx, playlistID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get youtube playlist: %w", err)
+	}
+
+	res := &Resolution{Name: strings.TrimPrefix(title, youTubeAlbumPrefix), TrackCount: len(videos)}
+	for _, video := range videos {
+		res.Tracks = append(res.Tracks, youTubeTrack(video))
+	}
+	return res, nil
+}
+
+// youTubeTrack takes the artist from an auto-generated "<artist> - Topic" channel,
+// otherwise from an "Artist - Title" video title, otherwise from the uploader.
+func youTubeTrack(v YouTubeVideo) spotify.TrackMetadata {
+	if artist, ok := strings.CutSuffix(v.Channel, youTubeTopicSuffix); ok {
+		return spotify.TrackMetadata{Artist: artist, Title: v.Title}
+	}
+	if artist, title, ok := strings.Cut(v.Title, " - "); ok {
+		return spotify.TrackMetadata{Artist: strings.TrimSpace(artist), Title: strings.TrimSpace(title)}
+	}
+	return spotify.TrackMetadata{Artist: v.Channel, Title: v.Title}
+}
+
+// YouTubeClient calls the YouTube Data API v3 with an API key
+type YouTubeClient struct {
+	key    string
+	client *http.Client
+	// APIURL and MusicURL are overridden in tests
+	APIURL   string
+	MusicURL string
+}
+
+func NewYouTubeClient(key string) *YouTubeClient {
+	return &YouTubeClient{
+		key:      key,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		APIURL:   youTubeDataAPIURL,
+		MusicURL: youTubeMusicURL,
+	}
+}
+
+// youTubeSnippet is the snippet part shared by playlists, playlist items and videos
+type youTubeSnippet struct {
+	Title                  string `json:"title"`
+	ChannelTitle           string `json:"channelTitle"`
+	VideoOwnerChannelTitle string `json:"videoOwnerChannelTitle"`
+}
+
+type youTubeList struct {
+	NextPageToken string `json:"nextPageToken"`
+	Items         []struct {
+		Snippet youTubeSnippet `json:"snippet"`
+	} `json:"items"`
+}
+
+func (c *YouTubeClient) list(ctx context.Context, resource string, params url.Values) (*youTubeList, error) {
+	params.Set("part", "snippet")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.APIURL+"/"+resource+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	// The key goes in a header, request errors quote the URL and end up in the logs
+	req.Header.Set("X-Goog-Api-Key", c.key)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", resource, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list %s: status %d", resource, resp.StatusCode)
+	}
+
+	var list youTubeList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", resource, err)
+	}
+	return &list, nil
+}
+
+func (c *YouTubeClient) Playlist(ctx context.Context, id string) (string, []YouTubeVideo, error) {
+	playlists, err := c.list(ctx, "playlists", url.Values{"id": {id}})
+	if err != nil {
+		return "", nil, err
+	}
+	if len(playlists.Items) == 0 {
+		return "", nil, fmt.Errorf("playlist %s not found", id)
+	}
+
+	var videos []YouTubeVideo
+	page := ""
+	for {
+		params := url.Values{"playlistId": {id}, "maxResults": {"50"}}
+		if page != "" {
+			params.Set("pageToken", page)
+		}
+		items, err := c.list(ctx, "playlistItems", params)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, item := range items.Items {
+			videos = append(videos, YouTubeVideo{Title: item.Snippet.Title, Channel: item.Snippet.VideoOwnerChannelTitle})
+		}
+
+		if items.NextPageToken == "" {
+			break
+		}
+		page = items.NextPageToken
+	}
+
+	return playlists.Items[0].Snippet.Title, videos, nil
+}
+
+func (c *YouTubeClient) Video(ctx context.Context, id string) (*YouTubeVideo, error) {
+	videos, err := c.list(ctx, "videos", url.Values{"id": {id}})
+	if err != nil {
+		return nil, err
+	}
+	if len(videos.Items) == 0 {
+		return nil, fmt.Errorf("video %s not found", id)
+	}
+
+	snippet := videos.Items[0].Snippet
+	return &YouTubeVideo{Title: snippet.Title, Channel: snippet.ChannelTitle}, nil
+}
+
+// AlbumPlaylistID reads the album page, the Data API has no notion of albums
+func (c *YouTubeClient) AlbumPlaylistID(ctx context.Context, browseID string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.MusicURL+"/browse/"+url.PathEscape(browseID), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get album page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get album page: status %d", resp.StatusCode)
+	}
+
+	page, err := readPage(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read album page: %w", err)
+	}
+
+	id := youTubeAlbumPlaylist.Find(page)
+	if id == nil {
+		return "", fmt.Errorf("no playlist found for album %s", browseID)
+	}
+	return string(id), nil
+}
@@ -0,0 +1,205 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+func TestYouTubeMusic_Match(t *testing.T) {
+	tests := []struct {
+		name     string
+		link     string
+		expected bool
+	}{
+		{"playlist", "https://music.youtube.com/playlist?list=PL123", true},
+		{"album", "https://music.youtube.com/browse/MPREb_abc", true},
+		{"watch", "https://music.youtube.com/watch?v=dQw4w9WgXcQ&list=RDAMVM", true},
+		{"playlist without list", "https://music.youtube.com/playlist", false},
+		{"artist page", "https://music.youtube.com/browse/UC123", false},
+		{"plain youtube", "https://www.youtube.com/watch?v=dQw4w9WgXcQ", false},
+		{"spotify", "https://open.spotify.com/album/123", false},
+		{"not a url", "hello", false},
+	}
+
+	resolver := NewYouTubeMusic(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolver.Match(tt.link); got != tt.expected {
+				t.Errorf("Match(%q) = %v, want %v", tt.link, got, tt.expected)
+			}
+		})
+	}
+}
+
+// newYouTubeServer serves a two-page album playlist, a video and the album page
+func newYouTubeServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	item := func(title, channel string) map[string]any {
+		return map[string]any{"snippet": map[string]any{"title": title, "videoOwnerChannelTitle": channel}}
+	}
+	pages := map[string]map[string]any{
+		"": {
+			"nextPageToken": "page2",
+			"items":         []any{item("Intro", "Boards of Canada - Topic")},
+		},
+		"page2": {
+			"items": []any{item("Artist - Song (Official Video)", "Some Uploader")},
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/playlists", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Goog-Api-Key") != "key" || r.URL.Query().Has("key") || r.URL.Query().Get("id") != "OLAK5uy_album" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"items": []any{map[string]any{"snippet": map[string]any{"title": "Album - Geogaddi"}}},
+		})
+	})
+	mux.HandleFunc("/v3/playlistItems", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(pages[r.URL.Query().Get("pageToken")])
+	})
+	mux.HandleFunc("/v3/videos", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"items": []any{map[string]any{"snippet": map[string]any{"title": "Roygbiv", "channelTitle": "Boards of Canada - Topic"}}},
+		})
+	})
+	mux.HandleFunc("/browse/MPREb_geogaddi", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<script>var data = {"playlistId":"OLAK5uy_album","x":1};</script>`))
+	})
+	mux.HandleFunc("/browse/MPREb_huge", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat(" ", maxPageBytes) + `"playlistId":"OLAK5uy_album"`))
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestYouTubeMusic_Resolve(t *testing.T) {
+	srv := newYouTubeServer(t)
+	client := NewYouTubeClient("key")
+	client.APIURL = srv.URL + "/v3"
+	client.MusicURL = srv.URL
+	resolver := NewYouTubeMusic(client)
+
+	album := &Resolution{
+		Name:       "Geogaddi",
+		TrackCount: 2,
+		Tracks: []spotify.TrackMetadata{
+			{Artist: "Boards of Canada", Title: "Intro"},
+			{Artist: "Artist", Title: "Song (Official Video)"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		link     string
+		expected *Resolution
+		wantErr  bool
+	}{
+		{
+			name:     "playlist is paged through",
+			link:     "https://music.youtube.com/playlist?list=OLAK5uy_album",
+			expected: album,
+		},
+		{
+			name:     "album resolves to its playlist",
+			link:     "https://music.youtube.com/browse/MPREb_geogaddi",
+			expected: album,
+		},
+		{
+			name: "watch link is a single track",
+			link: "https://music.youtube.com/watch?v=abc",
+			expected: &Resolution{
+				Name:       "Boards of Canada - Roygbiv",
+				TrackCount: 1,
+				Tracks:     []spotify.TrackMetadata{{Artist: "Boards of Canada", Title: "Roygbiv"}},
+			},
+		},
+		{
+			name:    "unknown playlist",
+			link:    "https://music.youtube.com/playlist?list=PLmissing",
+			wantErr: true,
+		},
+		{
+			name:    "album page without playlist",
+			link:    "https://music.youtube.com/browse/MPREb_missing",
+			wantErr: true,
+		},
+		{
+			name:    "album page over the size cap",
+			link:    "https://music.youtube.com/browse/MPREb_huge",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolver.Resolve(context.Background(), tt.link)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestYouTubeClient_ErrorsHideKey(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	client := NewYouTubeClient("secret-key")
+	client.APIURL = srv.URL
+	_, err := client.Video(context.Background(), "abc")
+	if err == nil {
+		t.Fatal("Video() expected an error from a closed server")
+	}
+	if strings.Contains(err.Error(), "secret-key") {
+		t.Errorf("Video() error %q contains the API key", err)
+	}
+}
+
+func TestResolvers_For(t *testing.T) {
+	resolvers := Resolvers{NewSpotify(nil), NewYouTubeMusic(nil), NewBandcamp(nil)}
+
+	tests := []struct {
+		name     string
+		link     string
+		expected string
+	}{
+		{"spotify", "https://open.spotify.com/album/123", Spotify},
+		{"youtube music", "https://music.youtube.com/playlist?list=PL1", YouTubeMusic},
+		{"bandcamp", "https://artist.bandcamp.com/album/x", Bandcamp},
+		{"unsupported", "https://example.com/album", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, err := resolvers.For(tt.link)
+			if tt.expected == "" {
+				if err != ErrUnsupported {
+					t.Errorf("For(%q) error = %v, want ErrUnsupported", tt.link, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("For(%q) error = %v", tt.link, err)
+			}
+			if resolver.Name() != tt.expected {
+				t.Errorf("For(%q) = %s, want %s", tt.link, resolver.Name(), tt.expected)
+			}
+		})
+	}
+}
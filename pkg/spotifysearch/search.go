@@ -0,0 +1,187 @@
+// Package spotifysearch searches the Spotify catalogue. The shared spot-models service only
+// looks up links it is given, so search talks to the Web API directly with the same credentials.
+package spotifysearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	apiURL   = "https://api.spotify.com/v1"
+	tokenURL = "https://accounts.spotify.com/api/token"
+
+	// timeout bounds each search and token request
+	timeout = 10 * time.Second
+)
+
+// Kinds of objects a search can return
+const (
+	Album    = "album"
+	Track    = "track"
+	Playlist = "playlist"
+)
+
+// Result is one search hit, with enough detail to tell similar releases apart
+type Result struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Artist joins the artists, or is the owner's name for playlists
+	Artist string `json:"artist"`
+	URL    string `json:"url"`
+	// ImageURL is the largest cover image, empty when there is none
+	ImageURL    string `json:"image_url,omitempty"`
+	ReleaseDate string `json:"release_date,omitempty"`
+	// TrackCount is unknown (0) for tracks
+	TrackCount int `json:"track_count,omitempty"`
+}
+
+// Client calls the Spotify search endpoint with client credentials
+type Client struct {
+	http   *http.Client
+	apiURL string
+}
+
+func New(ctx context.Context, clientID, clientSecret string) *Client {
+	cfg := &clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     tokenURL,
+	}
+	// The context client is used for token requests, the returned one wraps its transport
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Timeout: timeout})
+	client := cfg.Client(ctx)
+	client.Timeout = timeout
+	return &Client{http: client, apiURL: apiURL}
+}
+
+type image struct {
+	URL string `json:"url"`
+}
+
+type artist struct {
+	Name string `json:"name"`
+}
+
+type item struct {
+	Name         string            `json:"name"`
+	ExternalURLs map[string]string `json:"external_urls"`
+	Images       []image           `json:"images"`
+	Artists      []artist          `json:"artists"`
+	ReleaseDate  string            `json:"release_date"`
+	TotalTracks  int               `json:"total_tracks"`
+	// Album is set on tracks
+	Album *item `json:"album"`
+	// Owner and Tracks are set on playlists
+	Owner *struct {
+		DisplayName string `json:"display_name"`
+	} `json:"owner"`
+	Tracks *struct {
+		Total int `json:"total"`
+	} `json:"tracks"`
+}
+
+type page struct {
+	// Items can hold nulls for objects that are no longer available
+	Items []*item `json:"items"`
+}
+
+type searchResponse struct {
+	Albums    *page `json:"albums"`
+	Tracks    *page `json:"tracks"`
+	Playlists *page `json:"playlists"`
+}
+
+// Search returns up to limit results of each kind, grouped in the order kinds are given
+func (c *Client) Search(ctx context.Context, query string, kinds []string, limit int) ([]Result, error) {
+	params := url.Values{
+		"q":     {query},
+		"type":  {strings.Join(kinds, ",")},
+		"limit": {strconv.Itoa(limit)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiURL+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search spotify: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to search spotify: status %d", resp.StatusCode)
+	}
+
+	var body searchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode search results: %w", err)
+	}
+
+	var results []Result
+	for _, kind := range kinds {
+		var p *page
+		switch kind {
+		case Album:
+			p = body.Albums
+		case Track:
+			p = body.Tracks
+		case Playlist:
+			p = body.Playlists
+		}
+		if p == nil {
+			continue
+		}
+		for _, it := range p.Items {
+			if it != nil {
+				results = append(results, it.result(kind))
+			}
+		}
+	}
+
+	return results, nil
+}
+
+func (it *item) result(kind string) Result {
+	r := Result{
+		Kind:        kind,
+		Name:        it.Name,
+		URL:         it.ExternalURLs["spotify"],
+		ReleaseDate: it.ReleaseDate,
+		TrackCount:  it.TotalTracks,
+	}
+
+	names := make([]string, 0, len(it.Artists))
+	for _, a := range it.Artists {
+		names = append(names, a.Name)
+	}
+	r.Artist = strings.Join(names, ", ")
+
+	images := it.Images
+	if it.Album != nil {
+		images = it.Album.Images
+		r.ReleaseDate = it.Album.ReleaseDate
+	}
+	if it.Owner != nil {
+		r.Artist = it.Owner.DisplayName
+	}
+	if it.Tracks != nil {
+		r.TrackCount = it.Tracks.Total
+	}
+	// Spotify lists images widest first
+	if len(images) > 0 {
+		r.ImageURL = images[0].URL
+	}
+
+	return r
+}
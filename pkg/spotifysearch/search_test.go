@@ -0,0 +1,65 @@
+package spotifysearch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestClient_Search(t *testing.T) {
+	body, err := os.ReadFile("testdata/search.json")
+	if err != nil {
+		t.Fatalf("ReadFile() unexpected error: %v", err)
+	}
+
+	var query, types, limit string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query, types, limit = r.URL.Query().Get("q"), r.URL.Query().Get("type"), r.URL.Query().Get("limit")
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	c := &Client{http: srv.Client(), apiURL: srv.URL}
+	results, err := c.Search(context.Background(), "radiohead ok computer", []string{Playlist, Album, Track}, 2)
+	if err != nil {
+		t.Fatalf("Search() unexpected error: %v", err)
+	}
+
+	if query != "radiohead ok computer" || types != "playlist,album,track" || limit != "2" {
+		t.Errorf("request q=%q type=%q limit=%q", query, types, limit)
+	}
+
+	expected := []Result{
+		{Kind: Playlist, Name: "This Is Radiohead", Artist: "Spotify", URL: "https://open.spotify.com/playlist/mix", TrackCount: 50},
+		{
+			Kind: Album, Name: "OK Computer", Artist: "Radiohead", URL: "https://open.spotify.com/album/6dVIqQ8qmQ5GBnJ9shOYGE",
+			ImageURL: "https://i.scdn.co/image/large", ReleaseDate: "1997-05-21", TrackCount: 12,
+		},
+		{
+			Kind: Track, Name: "Airbag", Artist: "Radiohead, Guest", URL: "https://open.spotify.com/track/airbag",
+			ImageURL: "https://i.scdn.co/image/large", ReleaseDate: "1997-05-21",
+		},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Search() = %+v, want %+v", results, expected)
+	}
+}
+
+func TestClient_SearchError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := &Client{http: srv.Client(), apiURL: srv.URL}
+	if _, err := c.Search(context.Background(), "x", []string{Album}, 1); err == nil {
+		t.Error("Search() expected an error on 429")
+	}
+}
@@ -0,0 +1,97 @@
+// Package spotifytest provides a scriptable stand-in for the Spotify service.
+package spotifytest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+// Fake answers GetObjectName and GetTrackCount from canned data keyed by URL.
+// Unknown URLs return an error, like a Spotify 404 would.
+type Fake struct {
+	mu sync.Mutex
+
+	names     map[string]string
+	tracks    map[string][]spotify.TrackMetadata
+	nameErrs  map[string]error
+	trackErrs map[string]error
+	calls     []string
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		names:     make(map[string]string),
+		tracks:    make(map[string][]spotify.TrackMetadata),
+		nameErrs:  make(map[string]error),
+		trackErrs: make(map[string]error),
+	}
+}
+
+// AddObject registers an album, playlist or track with its tracks
+func (f *Fake) AddObject(url, name string, tracks ...spotify.TrackMetadata) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.names[url] = name
+	f.tracks[url] = tracks
+	return f
+}
+
+// FailName makes GetObjectName fail for url
+func (f *Fake) FailName(url string, err error) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nameErrs[url] = err
+	return f
+}
+
+// FailTracks makes GetTrackCount fail for url
+func (f *Fake) FailTracks(url string, err error) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.trackErrs[url] = err
+	return f
+}
+
+// Calls lists the calls made so far as "Method url"
+func (f *Fake) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.calls...)
+}
+
+func (f *Fake) GetObjectName(ctx context.Context, url string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, "GetObjectName "+url)
+	if err := f.nameErrs[url]; err != nil {
+		return "", err
+	}
+	name, ok := f.names[url]
+	if !ok {
+		return "", fmt.Errorf("spotify object %s not found", url)
+	}
+	return name, nil
+}
+
+func (f *Fake) GetTrackCount(ctx context.Context, url string) (int, []spotify.TrackMetadata, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, "GetTrackCount "+url)
+	if err := f.trackErrs[url]; err != nil {
+		return 0, nil, err
+	}
+	tracks, ok := f.tracks[url]
+	if !ok {
+		return 0, nil, fmt.Errorf("spotify object %s not found", url)
+	}
+	return len(tracks), append([]spotify.TrackMetadata(nil), tracks...), nil
+}
@@ -0,0 +1,205 @@
+package telegram
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+// secretTokenHeader carries the secret_token Telegram was given in setWebhook
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// setWebhookClient uploads the certificate, telebot's own client is used for everything else
+var setWebhookClient = &http.Client{Timeout: 30 * time.Second}
+
+// WebhookPoller is a telebot.Poller that receives updates over HTTP instead of
+// long polling. Unlike telebot.Webhook it doesn't open its own listener: it is
+// an http.Handler meant to be mounted on the service's existing HTTP server,
+// and it verifies the secret-token header on every update.
+type WebhookPoller struct {
+	// PublicURL is the HTTPS address Telegram posts updates to
+	PublicURL string
+	// SecretToken is sent to Telegram and expected back in every update request.
+	// Change it with RotateSecret once polling has started.
+	SecretToken string
+	// Certificate is an optional path to a self-signed public certificate to upload
+	Certificate string
+	// MaxConnections limits concurrent update deliveries, 0 leaves Telegram's default
+	MaxConnections int
+
+	log *zap.Logger
+
+	mu   sync.RWMutex
+	dest chan telebot.Update
+}
+
+func NewWebhookPoller(log *zap.Logger, publicURL, secretToken, certificate string, maxConnections int) *WebhookPoller {
+	return &WebhookPoller{
+		PublicURL:      publicURL,
+		SecretToken:    secretToken,
+		Certificate:    certificate,
+		MaxConnections: maxConnections,
+		log:            log,
+	}
+}
+
+// Poll registers the webhook with Telegram and forwards updates until stop is closed
+func (w *WebhookPoller) Poll(b *telebot.Bot, dest chan telebot.Update, stop chan struct{}) {
+	if err := w.register(b, w.secret()); err != nil {
+		w.log.Error("Failed to register telegram webhook", zap.Error(err))
+	} else {
+		w.log.Info("Telegram webhook registered", zap.String("url", w.PublicURL))
+	}
+
+	w.mu.Lock()
+	w.dest = dest
+	w.mu.Unlock()
+
+	<-stop
+
+	w.mu.Lock()
+	w.dest = nil
+	w.mu.Unlock()
+}
+
+func (w *WebhookPoller) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The handler shares a public port with /health and /metrics, so without the secret
+	// anyone could post an update as a whitelisted user. An unset secret rejects everything.
+	secret, got := w.secret(), r.Header.Get(secretTokenHeader)
+	if secret == "" || subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+		w.log.Warn("Rejected telegram update with invalid secret token", zap.String("remote_addr", r.RemoteAddr))
+		http.Error(rw, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var update telebot.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		w.log.Error("Failed to decode telegram update", zap.Error(err))
+		http.Error(rw, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	// Send without holding the lock, a slow bot would otherwise stall RotateSecret and shutdown
+	w.mu.RLock()
+	dest := w.dest
+	w.mu.RUnlock()
+
+	if dest == nil {
+		// Not polling yet or already stopped, Telegram will redeliver
+		http.Error(rw, "Bot not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	select {
+	case dest <- update:
+		rw.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+	}
+}
+
+// RotateSecret re-registers the webhook with a new secret token and starts
+// expecting it. Updates Telegram sends in between are rejected and redelivered.
+func (w *WebhookPoller) RotateSecret(b *telebot.Bot, secret string) error {
+	if err := w.register(b, secret); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.SecretToken = secret
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *WebhookPoller) secret() string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.SecretToken
+}
+
+func (w *WebhookPoller) register(b *telebot.Bot, secret string) error {
+	params := map[string]string{"url": w.PublicURL}
+	if secret != "" {
+		params["secret_token"] = secret
+	}
+	if w.MaxConnections > 0 {
+		params["max_connections"] = strconv.Itoa(w.MaxConnections)
+	}
+
+	if w.Certificate == "" {
+		_, err := b.Raw("setWebhook", params)
+		return err
+	}
+
+	return w.registerWithCertificate(b, params)
+}
+
+// registerWithCertificate uploads the certificate as multipart form data,
+// which telebot v2 only supports through its own listener.
+func (w *WebhookPoller) registerWithCertificate(b *telebot.Bot, params map[string]string) error {
+	cert, err := os.Open(w.Certificate)
+	if err != nil {
+		return fmt.Errorf("failed to open webhook certificate: %w", err)
+	}
+	defer cert.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for k, v := range params {
+		if err := form.WriteField(k, v); err != nil {
+			return err
+		}
+	}
+	part, err := form.CreateFormFile("certificate", filepath.Base(w.Certificate))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, cert); err != nil {
+		return fmt.Errorf("failed to read webhook certificate: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	resp, err := setWebhookClient.Post(b.URL+"/bot"+b.Token+"/setWebhook", form.FormDataContentType(), &body)
+	if err != nil {
+		// The request URL holds the bot token, keep it out of the error that gets logged
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to call setWebhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode setWebhook response: %w", err)
+	}
+	if !result.OK {
+		return fmt.Errorf("setWebhook failed: %s", result.Description)
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package telegram
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"gopkg.in/tucnak/telebot.v2"
+)
+
+func TestWebhookPoller_ServeHTTP(t *testing.T) {
+	body := `{"update_id": 1, "message": {"message_id": 2, "text": "/queue"}}`
+
+	tests := []struct {
+		name     string
+		method   string
+		unset    bool
+		secret   string
+		running  bool
+		expected int
+	}{
+		{
+			name:     "valid update",
+			method:   http.MethodPost,
+			secret:   "s3cret",
+			running:  true,
+			expected: http.StatusOK,
+		},
+		{
+			name:     "wrong secret",
+			method:   http.MethodPost,
+			secret:   "nope",
+			running:  true,
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "missing secret",
+			method:   http.MethodPost,
+			running:  true,
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "no secret configured",
+			method:   http.MethodPost,
+			unset:    true,
+			running:  true,
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "not polling",
+			method:   http.MethodPost,
+			secret:   "s3cret",
+			expected: http.StatusServiceUnavailable,
+		},
+		{
+			name:     "wrong method",
+			method:   http.MethodGet,
+			secret:   "s3cret",
+			running:  true,
+			expected: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configured := "s3cret"
+			if tt.unset {
+				configured = ""
+			}
+			w := NewWebhookPoller(zap.NewNop(), "https://example.com/telegram", configured, "", 0)
+			dest := make(chan telebot.Update, 1)
+			if tt.running {
+				w.dest = dest
+			}
+
+			req := httptest.NewRequest(tt.method, "/telegram", strings.NewReader(body))
+			if tt.secret != "" {
+				req.Header.Set(secretTokenHeader, tt.secret)
+			}
+			rec := httptest.NewRecorder()
+			w.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expected {
+				t.Errorf("ServeHTTP() code = %d, want %d", rec.Code, tt.expected)
+			}
+			if tt.expected == http.StatusOK {
+				upd := <-dest
+				if upd.ID != 1 || upd.Message == nil || upd.Message.Text != "/queue" {
+					t.Errorf("unexpected update forwarded: %+v", upd)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookPoller_RotateSecret(t *testing.T) {
+	var registered string
+	api := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var params map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&params)
+		registered = params["secret_token"]
+		_, _ = rw.Write([]byte(`{"ok": true, "result": true}`))
+	}))
+	defer api.Close()
+
+	bot, err := telebot.NewBot(telebot.Settings{URL: api.URL, Token: "token", Offline: true})
+	if err != nil {
+		t.Fatalf("NewBot() unexpected error: %v", err)
+	}
+
+	w := NewWebhookPoller(zap.NewNop(), "https://example.com/telegram", "old", "", 0)
+	w.dest = make(chan telebot.Update, 1)
+
+	if err := w.RotateSecret(bot, "new"); err != nil {
+		t.Fatalf("RotateSecret() unexpected error: %v", err)
+	}
+	if registered != "new" {
+		t.Errorf("setWebhook secret_token = %q, want %q", registered, "new")
+	}
+
+	for secret, want := range map[string]int{"old": http.StatusForbidden, "new": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(`{"update_id": 1}`))
+		req.Header.Set(secretTokenHeader, secret)
+		rec := httptest.NewRecorder()
+		w.ServeHTTP(rec, req)
+
+		if rec.Code != want {
+			t.Errorf("ServeHTTP() with %q secret code = %d, want %d", secret, rec.Code, want)
+		}
+	}
+}
+
+func TestWebhookPoller_RegisterHidesToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	cert := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(cert, []byte("certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	w := NewWebhookPoller(zap.NewNop(), "https://bot.example.com/telegram/webhook", "secret", cert, 0)
+
+	err := w.registerWithCertificate(&telebot.Bot{URL: srv.URL, Token: "123:bot-token"}, nil)
+	if err == nil {
+		t.Fatal("registerWithCertificate() expected an error from a closed server")
+	}
+	if strings.Contains(err.Error(), "bot-token") {
+		t.Errorf("registerWithCertificate() error %q contains the bot token", err)
+	}
+}
@@ -1,9 +1,32 @@
 package utils
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+
+	models "github.com/supperdoggy/spot-models"
+)
+
+// Request statuses derived from the stored request fields
+const (
+	StatusActive      = "active"
+	StatusCompleted   = "completed"
+	StatusErrored     = "errored"
+	StatusDeactivated = "deactivated"
+)
+
+// Sources stored on each request, so the downloader knows how to fetch it. They live here
+// rather than in pkg/source so storage and backups can name them without the resolvers.
+const (
+	SourceSpotify      = "spotify"
+	SourceYouTubeMusic = "youtube_music"
+	SourceBandcamp     = "bandcamp"
 )
 
 func IsValidSpotifyURL(url string) bool {
@@ -25,3 +48,87 @@ func SendDoneWebhook(webhookURL string) error {
 
 	return nil
 }
+
+// RequestStatus reports where a download request is in its lifecycle
+func RequestStatus(r models.DownloadQueueRequest) string {
+	switch {
+	case r.Active && r.Errored:
+		return StatusErrored
+	case r.Active:
+		return StatusActive
+	case r.ExpectedTrackCount > 0 && r.FoundTrackCount >= r.ExpectedTrackCount:
+		return StatusCompleted
+	default:
+		return StatusDeactivated
+	}
+}
+
+// ParseSince turns a stats window into its start time. It accepts relative
+// windows such as "24h", "7d" or "4w", and absolute dates in 2006-01-02 or RFC 3339 form.
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, fmt.Errorf("empty window")
+	}
+
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	unit := s[len(s)-1]
+	if unit == 'd' || unit == 'w' {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil || n <= 0 {
+			return time.Time{}, fmt.Errorf("invalid window %q", s)
+		}
+		if unit == 'w' {
+			n *= 7
+		}
+		return now.AddDate(0, 0, -n), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return time.Time{}, fmt.Errorf("invalid window %q", s)
+	}
+
+	return now.Add(-d), nil
+}
+
+// spotifyKinds are the open.spotify.com object types the bot accepts
+var spotifyKinds = []string{"album", "playlist", "track", "artist"}
+
+// SpotifyID returns the canonical Spotify URI, e.g. spotify:album:<id>, for an
+// open.spotify.com link. Query strings and intl-xx locale prefixes are ignored.
+func SpotifyID(link string) (string, bool) {
+	u, err := url.Parse(link)
+	if err != nil || u.Host != "open.spotify.com" {
+		return "", false
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) > 0 && strings.HasPrefix(parts[0], "intl-") {
+		parts = parts[1:]
+	}
+	if len(parts) < 2 || !slices.Contains(spotifyKinds, parts[0]) || parts[1] == "" {
+		return "", false
+	}
+
+	return "spotify:" + parts[0] + ":" + parts[1], true
+}
+
+// MatchKey normalizes an artist and title into the key used to match requested
+// tracks against indexed music files: lowercased, punctuation dropped, whitespace collapsed.
+func MatchKey(artist, title string) string {
+	return normalize(artist) + "|" + normalize(title)
+}
+
+func normalize(s string) string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	return strings.Join(fields, " ")
+}
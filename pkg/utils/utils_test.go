@@ -1,6 +1,11 @@
 package utils
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	models "github.com/supperdoggy/spot-models"
+)
 
 func TestIsValidSpotifyURL(t *testing.T) {
 	tests := []struct {
@@ -96,3 +101,202 @@ func TestInWhiteList_EmptyList(t *testing.T) {
 		t.Error("InWhiteList should return false for empty whitelist")
 	}
 }
+
+func TestRequestStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  models.DownloadQueueRequest
+		expected string
+	}{
+		{
+			name:     "active request",
+			request:  models.DownloadQueueRequest{Active: true, ExpectedTrackCount: 10, FoundTrackCount: 3},
+			expected: StatusActive,
+		},
+		{
+			name:     "active errored request",
+			request:  models.DownloadQueueRequest{Active: true, Errored: true},
+			expected: StatusErrored,
+		},
+		{
+			name:     "completed request",
+			request:  models.DownloadQueueRequest{Active: false, ExpectedTrackCount: 10, FoundTrackCount: 10},
+			expected: StatusCompleted,
+		},
+		{
+			name:     "deactivated before completion",
+			request:  models.DownloadQueueRequest{Active: false, ExpectedTrackCount: 10, FoundTrackCount: 4},
+			expected: StatusDeactivated,
+		},
+		{
+			name:     "deactivated without track data",
+			request:  models.DownloadQueueRequest{Active: false},
+			expected: StatusDeactivated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := RequestStatus(tt.request)
+			if result != tt.expected {
+				t.Errorf("RequestStatus() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "days",
+			input:    "7d",
+			expected: time.Date(2024, 3, 8, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "weeks",
+			input:    "2w",
+			expected: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "hours",
+			input:    "24h",
+			expected: time.Date(2024, 3, 14, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "date",
+			input:    "2024-01-01",
+			expected: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "rfc3339",
+			input:    "2024-02-01T10:00:00Z",
+			expected: time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "empty",
+			input:   "",
+			wantErr: true,
+		},
+		{
+			name:    "zero days",
+			input:   "0d",
+			wantErr: true,
+		},
+		{
+			name:    "garbage",
+			input:   "yesterday",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseSince(tt.input, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseSince(%q) expected error, got %v", tt.input, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSince(%q) unexpected error: %v", tt.input, err)
+			}
+			if !result.Equal(tt.expected) {
+				t.Errorf("ParseSince(%q) = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSpotifyID(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+		ok       bool
+	}{
+		{
+			name:     "album",
+			url:      "https://open.spotify.com/album/6dVIqQ8qmQ5GBnJ9shOYGE",
+			expected: "spotify:album:6dVIqQ8qmQ5GBnJ9shOYGE",
+			ok:       true,
+		},
+		{
+			name:     "playlist with share query",
+			url:      "https://open.spotify.com/playlist/37i9dQZF1DXcBWIGoYBM5M?si=abc123",
+			expected: "spotify:playlist:37i9dQZF1DXcBWIGoYBM5M",
+			ok:       true,
+		},
+		{
+			name:     "track with locale prefix",
+			url:      "https://open.spotify.com/intl-de/track/3n3Ppam7vgaVa1iaRUc9Lp",
+			expected: "spotify:track:3n3Ppam7vgaVa1iaRUc9Lp",
+			ok:       true,
+		},
+		{
+			name: "unknown kind",
+			url:  "https://open.spotify.com/show/123",
+		},
+		{
+			name: "missing id",
+			url:  "https://open.spotify.com/album/",
+		},
+		{
+			name: "other host",
+			url:  "https://music.youtube.com/playlist?list=123",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, ok := SpotifyID(tt.url)
+			if result != tt.expected || ok != tt.ok {
+				t.Errorf("SpotifyID(%q) = %q, %v, want %q, %v", tt.url, result, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMatchKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		artist   string
+		title    string
+		expected string
+	}{
+		{
+			name:     "lowercases",
+			artist:   "Radiohead",
+			title:    "Paranoid Android",
+			expected: "radiohead|paranoid android",
+		},
+		{
+			name:     "drops punctuation and extra spaces",
+			artist:   " AC/DC ",
+			title:    "Highway  to Hell!",
+			expected: "ac dc|highway to hell",
+		},
+		{
+			name:     "keeps non latin letters",
+			artist:   "Океан Ельзи",
+			title:    "Обійми",
+			expected: "океан ельзи|обійми",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := MatchKey(tt.artist, tt.title)
+			if result != tt.expected {
+				t.Errorf("MatchKey(%q, %q) = %q, want %q", tt.artist, tt.title, result, tt.expected)
+			}
+		})
+	}
+}